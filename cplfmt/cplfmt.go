@@ -0,0 +1,523 @@
+// Package cplfmt writes a parsed CPL program back as CPL source in one canonical layout:
+// a statement on every line, blocks opened on the line of their if, while or for, an
+// indentation level for every nested statement and case, single spaces around
+// operators and only the parentheses that the precedence of the operators needs.
+//
+// The syntax tree keeps neither comments nor the shorthands the parser expands, so
+// a += 2 and a++ are written as a = a + 2 and a = a + 1, but a[i] += 2 and a[i]++ as
+// a[i] += 2 and a[i] += 1, whose index is computed once. Case labels are written as in
+// the source, by the name of an enum value or a constant. Formatting a program does not
+// change the QUAD program it compiles to.
+package cplfmt
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/nof-sh/CPL-to-QUAD-compiler/cpq"
+)
+
+//layout of the formatted source
+type Config struct {
+	Indent string // one level of indentation, four spaces when empty
+}
+
+//returned by Source for a program with comments, which formatting would remove
+var ErrComments = errors.New("the program has comments, which formatting would remove")
+
+// Format returns the CPL source of a program, which parses to the same syntax tree.
+func Format(program *cpq.Program, config Config) string {
+	p := newPrinter(program, config)
+	p.program(program)
+	return p.out.String()
+}
+
+// Source returns the formatted CPL source src. The error has the first syntax error of
+// src, or is ErrComments when src has comments.
+func Source(src string, config Config) (string, error) {
+	program, errors := cpq.Parse(src)
+	if len(errors) > 0 {
+		cpq.SortErrors(errors)
+		return "", &errors[0]
+	}
+	if HasComments(src) {
+		return "", ErrComments
+	}
+	return Format(program, config), nil
+}
+
+// HasComments reports whether there is a comment between the tokens of src.
+func HasComments(src string) bool {
+	end := 0
+	for token := range cpq.Tokens(src) {
+		if strings.TrimSpace(src[end:token.Position.Offset]) != "" {
+			return true
+		}
+		end = token.End.Offset
+	}
+	return strings.TrimSpace(src[end:]) != ""
+}
+
+//spelling of the operators
+var operators = map[cpq.Operator]string{
+	cpq.Add: "+", cpq.Subtract: "-", cpq.Multiply: "*", cpq.Divide: "/", cpq.Modulo: "%",
+	cpq.EqualTo: "==", cpq.NotEqualTo: "!=", cpq.GreaterThan: ">", cpq.LessThan: "<",
+	cpq.GreaterThanOrEqualTo: ">=", cpq.LessThenOrEqualTo: "<=",
+}
+
+//precedence of the arithmetic operators and of the operands, which need no parentheses
+const (
+	sumPrecedence = iota + 1
+	productPrecedence
+	operandPrecedence
+)
+
+//precedence of || and &&
+const (
+	orPrecedence = iota + 1
+	andPrecedence
+	factorPrecedence
+)
+
+//a struct field as a variable, the field x of p is the variable p_x
+type field struct {
+	variable string
+	name     string
+	array    bool // the variable is an array of structs, pts[i].x
+}
+
+type printer struct {
+	indent string
+	depth  int
+	out    strings.Builder
+	fields map[string]field     // the fields of the structs by their variable
+	enums  map[string]*cpq.Enum // the enums of the enum variables
+}
+
+func newPrinter(program *cpq.Program, config Config) *printer {
+	p := &printer{indent: config.Indent, fields: map[string]field{}, enums: map[string]*cpq.Enum{}}
+	if p.indent == "" {
+		p.indent = "    "
+	}
+	p.learn(program.Declarations)
+	for _, function := range program.Functions {
+		p.learn(function.Declarations)
+	}
+	return p
+}
+
+//records the struct fields and the enum variables of declarations
+func (p *printer) learn(declarations []cpq.Declaration) {
+	for _, d := range declarations {
+		if d.Struct != nil {
+			for i, name := range d.Struct.Names {
+				for _, f := range d.Struct.Fields {
+					for _, fieldName := range f.Names {
+						p.fields[name+"_"+fieldName] = field{name, fieldName, i < len(d.Struct.Sizes) && d.Struct.Sizes[i] > 0}
+					}
+				}
+			}
+		} else if d.Enum != nil && !d.Const {
+			for _, name := range d.Names {
+				p.enums[name] = d.Enum
+			}
+		}
+	}
+}
+
+//starts a line at the indentation of depth
+func (p *printer) start() {
+	for i := 0; i < p.depth; i++ {
+		p.out.WriteString(p.indent)
+	}
+}
+
+func (p *printer) line(text string) {
+	p.start()
+	p.out.WriteString(text)
+	p.out.WriteByte('\n')
+}
+
+func (p *printer) program(program *cpq.Program) {
+	p.declarations(program.Declarations)
+	for _, function := range program.Functions {
+		if p.out.Len() > 0 {
+			p.out.WriteByte('\n')
+		}
+		p.function(function)
+	}
+	if p.out.Len() > 0 {
+		p.out.WriteByte('\n')
+	}
+	p.block(program.StatementsBlock)
+}
+
+func (p *printer) function(function *cpq.Function) {
+	params := make([]string, len(function.Params))
+	for i, param := range function.Params {
+		params[i] = param.Name + " : " + param.Type.String()
+	}
+	head := "func " + function.Name + "(" + strings.Join(params, ", ") + ")"
+	if function.ReturnType != cpq.Unknown {
+		head += " : " + function.ReturnType.String()
+	}
+	p.line(head)
+	p.depth++
+	p.declarations(function.Declarations)
+	p.depth--
+	p.block(function.Body)
+}
+
+//writes declarations as they were written: the declarations of the fields of a struct
+//as the struct, and the enum values after an enum not at all
+func (p *printer) declarations(declarations []cpq.Declaration) {
+	for i := 0; i < len(declarations); i++ {
+		d := &declarations[i]
+		switch {
+		case d.Struct != nil:
+			for i+1 < len(declarations) && declarations[i+1].Struct == d.Struct {
+				i++
+			}
+			fields := make([]string, len(d.Struct.Fields))
+			for j := range d.Struct.Fields {
+				field := &d.Struct.Fields[j]
+				fields[j] = idList(field.Names, field.Sizes) + " : " + field.Type.String() + ";"
+			}
+			p.line(idList(d.Struct.Names, d.Struct.Sizes) + " : struct { " + strings.Join(fields, " ") + " };")
+		case d.Enum != nil && d.Const:
+		case d.Enum != nil:
+			p.line(idList(d.Names, d.Sizes) + " : enum { " + strings.Join(d.Enum.Values, ", ") + " };")
+		case d.Const:
+			p.line(idList(d.Names, d.Sizes) + " : const " + d.Type.String() + " = " + constant(d.Value) + ";")
+		default:
+			p.line(idList(d.Names, d.Sizes) + " : " + d.Type.String() + ";")
+		}
+	}
+}
+
+//returns the names of a declaration with the sizes of the arrays, a, b[10]
+func idList(names []string, sizes []int64) string {
+	list := make([]string, len(names))
+	for i, name := range names {
+		list[i] = name
+		if i < len(sizes) && sizes[i] > 0 {
+			list[i] += "[" + strconv.FormatInt(sizes[i], 10) + "]"
+		}
+	}
+	return strings.Join(list, ", ")
+}
+
+//returns the value of a constant, which may have a sign
+func constant(value cpq.NodeExpression) string {
+	switch v := value.(type) {
+	case *cpq.IntNum:
+		return strconv.FormatInt(v.Value, 10)
+	case *cpq.FloatNum:
+		return float(v.Value)
+	}
+	return operand(value)
+}
+
+//returns a float literal, which has a '.'
+func float(value float64) string {
+	text := strconv.FormatFloat(value, 'f', -1, 64)
+	if !strings.ContainsRune(text, '.') {
+		text += ".0"
+	}
+	return text
+}
+
+func (p *printer) block(block *cpq.Block) {
+	p.line("{")
+	p.statements(block.Statements)
+	p.line("}")
+}
+
+//writes statements one level deeper
+func (p *printer) statements(statements []cpq.Statement) {
+	p.depth++
+	for _, statement := range statements {
+		p.statement(statement)
+	}
+	p.depth--
+}
+
+func (p *printer) statement(statement cpq.Statement) {
+	switch s := statement.(type) {
+	case *cpq.Block:
+		p.block(s)
+	case *cpq.Assignment:
+		p.line(p.assignment(s) + ";")
+	case *cpq.Input:
+		text := "input(" + p.reference(s.Variable, s.Index)
+		if s.Min != nil {
+			text += " in " + constant(s.Min) + ".." + constant(s.Max)
+		}
+		p.line(text + ");")
+	case *cpq.Output:
+		p.line("output(" + p.value(s.Value) + ");")
+	case *cpq.Call:
+		p.line(p.call(s) + ";")
+	case *cpq.Return:
+		if s.Value == nil {
+			p.line("return;")
+		} else {
+			p.line("return " + p.value(s.Value) + ";")
+		}
+	case *cpq.Break:
+		p.line("break;")
+	case *cpq.Continue:
+		p.line("continue;")
+	case *cpq.Fallthrough:
+		p.line("fallthrough;")
+	case *cpq.IfStatement:
+		p.start()
+		p.ifStatement(s)
+	case *cpq.WhileStatement:
+		p.start()
+		p.out.WriteString("while (" + p.boolean(s.Condition, 0) + ")")
+		p.body(s.Body, "\n")
+	case *cpq.ForStatement:
+		head := "for ("
+		if s.Init != nil {
+			head += p.assignment(s.Init.(*cpq.Assignment))
+		}
+		head += "; " + p.boolean(s.Condition, 0) + ";"
+		if s.Step != nil {
+			head += " " + p.assignment(s.Step.(*cpq.Assignment))
+		}
+		p.start()
+		p.out.WriteString(head + ")")
+		p.body(s.Body, "\n")
+	case *cpq.DoWhileStatement:
+		p.start()
+		p.out.WriteString("do")
+		tail := "while (" + p.boolean(s.Condition, 0) + ");"
+		if !p.body(s.Body, " "+tail+"\n") {
+			p.line(tail)
+		}
+	case *cpq.Switch:
+		p.switchStatement(s)
+	}
+}
+
+//writes the body of an if, a loop or an else after its head: a block on the line of the
+//head, ended by end after its }, and another statement on the next lines; it reports
+//whether the body was a block
+func (p *printer) body(body cpq.Statement, end string) bool {
+	if block, ok := body.(*cpq.Block); ok {
+		p.out.WriteString(" {\n")
+		p.statements(block.Statements)
+		p.start()
+		p.out.WriteString("}" + end)
+		return true
+	}
+	p.out.WriteByte('\n')
+	p.depth++
+	p.statement(body)
+	p.depth--
+	return false
+}
+
+//writes an if statement on the started line, and an else if chain after it
+func (p *printer) ifStatement(s *cpq.IfStatement) {
+	p.out.WriteString("if (" + p.boolean(s.Condition, 0) + ")")
+	branch := s.IfBranch
+	if s.ElseBranch != nil && dangling(branch) {
+		// without braces the else would belong to the if inside the branch
+		branch = &cpq.Block{Statements: []cpq.Statement{branch}}
+	}
+	if s.ElseBranch == nil {
+		p.body(branch, "\n")
+		return
+	}
+	if !p.body(branch, " else") {
+		p.start()
+		p.out.WriteString("else")
+	}
+	if elseIf, ok := s.ElseBranch.(*cpq.IfStatement); ok {
+		p.out.WriteByte(' ')
+		p.ifStatement(elseIf)
+		return
+	}
+	p.body(s.ElseBranch, "\n")
+}
+
+//reports whether a statement ends with an if without else, which would take an else
+//written after it
+func dangling(statement cpq.Statement) bool {
+	switch s := statement.(type) {
+	case *cpq.IfStatement:
+		return s.ElseBranch == nil || dangling(s.ElseBranch)
+	case *cpq.WhileStatement:
+		return dangling(s.Body)
+	case *cpq.ForStatement:
+		return dangling(s.Body)
+	}
+	return false
+}
+
+func (p *printer) switchStatement(s *cpq.Switch) {
+	enum := p.enumOf(s.Expression)
+	p.line("switch (" + p.expression(s.Expression, 0) + ") {")
+	for _, c := range s.Cases {
+		labels := make([]string, len(c.Labels))
+		for i, label := range c.Labels {
+			if label.Text != "" {
+				labels[i] = label.Text
+				continue
+			}
+			labels[i] = caseValue(label.Min, enum)
+			if label.Max != label.Min {
+				labels[i] += ".." + caseValue(label.Max, enum)
+			}
+		}
+		p.line("case " + strings.Join(labels, ", ") + ":")
+		p.statements(c.Statements)
+	}
+	p.line("default:")
+	p.statements(s.DefaultCase)
+	p.line("}")
+}
+
+//returns the enum of an enum variable, or nil
+func (p *printer) enumOf(exp cpq.NodeExpression) *cpq.Enum {
+	switch e := exp.(type) {
+	case *cpq.Variable:
+		return p.enums[e.Variable]
+	case *cpq.Element:
+		return p.enums[e.Array]
+	}
+	return nil
+}
+
+//returns a case value of a label without its text, by its name when it is a value of enum
+func caseValue(value int64, enum *cpq.Enum) string {
+	if enum != nil && value >= 0 && value < int64(len(enum.Values)) {
+		return enum.Values[value]
+	}
+	return strconv.FormatInt(value, 10)
+}
+
+//returns an assignment without its ';'. A compound assignment to an element keeps its
+//operator, as a[i()] = a[i()] + 2 would compute the index twice.
+func (p *printer) assignment(a *cpq.Assignment) string {
+	if compound, ok := a.Val.(*cpq.Arithmetic); ok && a.Index != nil {
+		if element, ok := compound.LHS.(*cpq.Element); ok && element.Index == a.Index {
+			return p.reference(a.Variable, a.Index) + " " + operators[compound.Operator] + "= " + p.expression(compound.RHS, 0)
+		}
+	}
+	return p.reference(a.Variable, a.Index) + " = " + p.value(a.Val)
+}
+
+//returns a variable or an element as the source names it, p.x for the variable p_x
+func (p *printer) reference(variable string, index cpq.NodeExpression) string {
+	f, isField := p.fields[variable]
+	switch {
+	case index == nil && isField:
+		return f.variable + "." + f.name
+	case index == nil:
+		return variable
+	case isField && f.array:
+		return f.variable + "[" + p.expression(index, 0) + "]." + f.name
+	case isField:
+		return f.variable + "." + f.name + "[" + p.expression(index, 0) + "]"
+	}
+	return variable + "[" + p.expression(index, 0) + "]"
+}
+
+func (p *printer) call(c *cpq.Call) string {
+	args := make([]string, len(c.Args))
+	for i, arg := range c.Args {
+		args[i] = p.value(arg)
+	}
+	return c.Function + "(" + strings.Join(args, ", ") + ")"
+}
+
+//returns a value, which may be a condition, a ?: or the assignment of a chain
+func (p *printer) value(exp cpq.NodeExpression) string {
+	switch e := exp.(type) {
+	case *cpq.Condition:
+		return p.boolean(e.Value, 0)
+	case *cpq.Conditional:
+		return p.boolean(e.Condition, 0) + " ? " + p.value(e.Then) + " : " + p.value(e.Else)
+	case *cpq.Assignment:
+		return p.assignment(e)
+	}
+	return p.expression(exp, 0)
+}
+
+//returns an arithmetic expression, in parentheses when its precedence is below min
+func (p *printer) expression(exp cpq.NodeExpression, min int) string {
+	text, precedence := "", operandPrecedence
+	switch e := exp.(type) {
+	case *cpq.Arithmetic:
+		precedence = sumPrecedence
+		if e.Operator != cpq.Add && e.Operator != cpq.Subtract {
+			precedence = productPrecedence
+		}
+		text = p.expression(e.LHS, precedence) + " " + operators[e.Operator] + " " + p.expression(e.RHS, precedence+1)
+	case *cpq.Variable:
+		text = p.reference(e.Variable, nil)
+	case *cpq.Element:
+		text = p.reference(e.Array, e.Index)
+	case *cpq.Call:
+		text = p.call(e)
+	case *cpq.Cast:
+		text = "static_cast(" + e.Type.String() + ")(" + p.expression(e.Value, 0) + ")"
+	case *cpq.IntNum:
+		// a factor has no sign, and a folded constant may be negative
+		if text = constant(e); e.Value < 0 {
+			text, precedence = "0 - "+text[1:], sumPrecedence
+		}
+	case *cpq.FloatNum:
+		if text = constant(e); e.Value < 0 {
+			text, precedence = "0.0 - "+text[1:], sumPrecedence
+		}
+	case *cpq.Condition, *cpq.Conditional, *cpq.Assignment:
+		return "(" + p.value(exp) + ")"
+	default:
+		text = operand(exp)
+	}
+	if precedence < min {
+		return "(" + text + ")"
+	}
+	return text
+}
+
+//returns a literal
+func operand(exp cpq.NodeExpression) string {
+	switch e := exp.(type) {
+	case *cpq.BoolLiteral:
+		return strconv.FormatBool(e.Value)
+	case *cpq.CharLiteral:
+		return strconv.QuoteRune(e.Value)
+	case *cpq.StringLiteral:
+		return strconv.Quote(e.Value)
+	}
+	return ""
+}
+
+//returns a condition, in parentheses when its precedence is below min
+func (p *printer) boolean(b cpq.Boolean, min int) string {
+	text, precedence := "", factorPrecedence
+	switch e := b.(type) {
+	case *cpq.Or:
+		precedence = orPrecedence
+		text = p.boolean(e.LHS, precedence) + " || " + p.boolean(e.RHS, precedence+1)
+	case *cpq.And:
+		precedence = andPrecedence
+		text = p.boolean(e.LHS, precedence) + " && " + p.boolean(e.RHS, precedence+1)
+	case *cpq.Not:
+		text = "!(" + p.boolean(e.Value, 0) + ")"
+	case *cpq.Compare:
+		text = p.expression(e.LHS, 0) + " " + operators[e.Operator] + " " + p.expression(e.RHS, 0)
+	case *cpq.BoolTest:
+		text = p.expression(e.Value, 0)
+	}
+	if precedence < min {
+		return "(" + text + ")"
+	}
+	return text
+}
@@ -0,0 +1,157 @@
+package cplfmt
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nof-sh/CPL-to-QUAD-compiler/cpq"
+)
+
+//case labels are written back as the source names them, not as their values
+func TestCaseLabels(t *testing.T) {
+	src := `c : enum { RED, GREEN, BLUE };
+k : const int = 7;
+z : const int = 'z';
+a : int;
+
+{
+    c = GREEN;
+    input(a);
+    switch (a) {
+    case RED:
+        output(0);
+        break;
+    case GREEN..BLUE, k:
+        output(1);
+        break;
+    case 'a'..z, -1:
+        output(2);
+        break;
+    default:
+        output(c);
+    }
+    switch (c) {
+    case BLUE:
+        output(3);
+    default:
+        output(4);
+    }
+}
+`
+	formatted, err := Source(src, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if formatted != src {
+		t.Errorf("formatted:\n%s\nwant:\n%s", formatted, src)
+	}
+	if _, err := cpq.Compile(src, cpq.Options{}); err != nil {
+		t.Errorf("compile: %v", err)
+	}
+	again, err := Source(formatted, Config{})
+	if err != nil || again != formatted {
+		t.Errorf("formatting again gave %q, %v", again, err)
+	}
+}
+
+//a compound assignment to an element keeps its operator, and computes its index once
+func TestCompoundElement(t *testing.T) {
+	src := "a[3] : int;\ni : int;\n\n{\n    i = 1;\n    a[i] += 2;\n    a[i + 1] *= a[i];\n    a[i] = a[i] - 1;\n    i += 1;\n}\n"
+	want := strings.Replace(src, "i += 1;", "i = i + 1;", 1)
+	formatted, err := Source(src, Config{})
+	if err != nil || formatted != want {
+		t.Errorf("formatted:\n%s\nwant:\n%s", formatted, want)
+	}
+	formatted, _ = Source(strings.Replace(src, "a[i] += 2;", "a[i]++;", 1), Config{})
+	if want := strings.Replace(want, "a[i] += 2;", "a[i] += 1;", 1); formatted != want {
+		t.Errorf("formatted a[i]++:\n%s\nwant:\n%s", formatted, want)
+	}
+}
+
+//a program with most statements and operators, as Format writes it
+const formattedProgram = `n : const int = 3;
+p : struct { x : float; v[2] : int; };
+a[4] : int;
+i, j : int;
+b : bool;
+y : float;
+
+func f(k : int) : int
+{
+    return k * (2 + k);
+}
+
+{
+    input(i);
+    b = i > 2 && !(i == 4) || false;
+    y = static_cast(float)(i) / 2;
+    if (b)
+        output(y);
+    else {
+        output(0 - y);
+        output((y - 1) * (y + 1));
+    }
+    while (i < 10)
+        i = i + 1;
+    do {
+        i = i - 1;
+        if (i == 6)
+            continue;
+        else
+            a[i % 4] += 1;
+    } while (i > 5);
+    for (j = 0; j < n; j = j + 1) {
+        a[j] = f(j) + 'a';
+        p.v[j % 2] = j - (j - 1);
+    }
+    i = b ? 1 : 2;
+    p.x = y;
+    output("done");
+}
+`
+
+//formatting keeps the QUAD program, and formatting the result changes nothing
+func TestFormatKeepsQuad(t *testing.T) {
+	src := `n:const int=3;p:struct{x:float;v[2]:int;};a[4]:int;i,j:int;b:bool;y:float;
+func f(k:int):int{return k*(2+k);}
+{input(i);b=i>2&&!(i==4)||false;y=static_cast(float)(i)/2;
+if(b)output(y);else{output(-y);output((y-1)*(y+1));}
+while(i<10)i++;do{i--;if(i==6)continue;else a[i%4]+=1;}while(i>5);
+for(j=0;j<n;j++){a[j]=f(j)+'a';p.v[j%2]=j-(j-1);}
+i=b?1:2;p.x=y;output("done");}
+`
+	want, err := cpq.Compile(src, cpq.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	formatted, err := Source(src, Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := cpq.Compile(formatted, cpq.Options{})
+	if err != nil {
+		t.Fatalf("%v\n%s", err, formatted)
+	}
+	if got.Quad != want.Quad {
+		t.Errorf("the formatted program compiles to other code:\n%s", formatted)
+	}
+	if again, _ := Source(formatted, Config{}); again != formatted {
+		t.Errorf("formatting again:\n%s\nwant:\n%s", again, formatted)
+	}
+	if formatted != formattedProgram {
+		t.Errorf("formatted:\n%s\nwant:\n%s", formatted, formattedProgram)
+	}
+}
+
+func TestFormatConfig(t *testing.T) {
+	formatted, err := Source("a:int;{if(a>1){a=1;}else a=2;}", Config{Indent: "\t"})
+	if want := "a : int;\n\n{\n\tif (a > 1) {\n\t\ta = 1;\n\t} else\n\t\ta = 2;\n}\n"; err != nil || formatted != want {
+		t.Errorf("formatted with tabs:\n%s\nwant:\n%s", formatted, want)
+	}
+	if _, err := Source("a : int; /* the count */\n{ a = 1; }\n", Config{}); err != ErrComments {
+		t.Errorf("a program with comments: %v", err)
+	}
+	if _, err := Source("a : int;\n{ a = ; }\n", Config{}); err == nil {
+		t.Errorf("a program with a syntax error was formatted")
+	}
+}
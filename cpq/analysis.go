@@ -0,0 +1,259 @@
+package cpq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//analyses of the generated instructions, whose jumps are the control flow graph of the
+//program: a call is a JUMP to the function and its return a JMPZ to every call site
+
+//a variable of the program as it was declared
+type declaredVariable struct {
+	name     string // as written in the source, p.x for a field
+	kind     string // variable, parameter or field
+	pos      Position
+	function *functionInfo // nil for a global
+	size     int64         // elements of an array, 0 for a scalar
+}
+
+//records a variable for the analyses under its QUAD name
+func (c *CodeGen) declare(qname string, v *declaredVariable) {
+	if c.declared == nil {
+		c.declared = map[string]*declaredVariable{}
+	}
+	c.declared[qname] = v
+	c.declaredOrder = append(c.declaredOrder, qname)
+}
+
+//returns the declared variable of a declaration, with the source name of a struct field
+func (c *CodeGen) declaredOf(declaration *Declaration, name string, size int64) *declaredVariable {
+	v := &declaredVariable{name: name, kind: "variable", pos: declaration.Pos, function: c.function, size: size}
+	if field, isField := fieldName(declaration, name); isField {
+		v.name, v.kind = field, "field"
+	}
+	return v
+}
+
+//returns p.x for the variable p_x of a struct declaration
+func fieldName(declaration *Declaration, name string) (string, bool) {
+	if declaration.Struct == nil {
+		return name, false
+	}
+	for _, variable := range declaration.Struct.Names {
+		if strings.HasPrefix(name, variable+"_") {
+			return variable + "." + name[len(variable)+1:], true
+		}
+	}
+	return name, false
+}
+
+//returns the operands an instruction reads and the variable it writes, "" for none
+func operands(ins Instruction) ([]string, string) {
+	switch {
+	case ins.Label != "":
+		return nil, ""
+	case writesFirst[ins.Op]:
+		return ins.Args[1:], ins.Args[0]
+	case ins.Op == "IINP" || ins.Op == "RINP":
+		return nil, ins.Args[0]
+	case ins.Op == "JMPZ":
+		return ins.Args[1:], ""
+	case ins.Op == "JUMP":
+		return nil, ""
+	}
+	return ins.Args, ""
+}
+
+//returns the instructions that can run after every instruction
+func (c *CodeGen) successors() [][]int {
+	labels := c.labelLines()
+	next := make([][]int, len(c.code))
+	for n, ins := range c.code {
+		switch ins.Op {
+		case "HALT":
+		case "JUMP":
+			next[n] = []int{labels[ins.Args[0]]}
+		case "JMPZ":
+			next[n] = []int{labels[ins.Args[0]], n + 1}
+		default:
+			next[n] = []int{n + 1}
+		}
+		if len(next[n]) > 0 && next[n][len(next[n])-1] == len(c.code) {
+			next[n] = next[n][:len(next[n])-1]
+		}
+	}
+	return next
+}
+
+//returns the QUAD names of the elements of an array, or the name of a scalar
+func elementNames(qname string, size int64) []string {
+	if size == 0 {
+		return []string{qname}
+	}
+	names := make([]string, size)
+	for k := range names {
+		names[k] = qname + "_" + strconv.Itoa(k)
+	}
+	return names
+}
+
+//warns about the variables that no instruction reads, before unreachable code is removed,
+//so that a variable read only there is not reported twice. Returns the QUAD names of the
+//scalar variables reported.
+func (c *CodeGen) checkUnusedVariables() map[string]bool {
+	read := map[string]bool{}
+	for _, ins := range c.code {
+		reads, _ := operands(ins)
+		for _, arg := range reads {
+			read[arg] = true
+		}
+	}
+	unused := map[string]bool{}
+	for _, qname := range c.declaredOrder {
+		v := c.declared[qname]
+		used := false
+		for _, name := range elementNames(qname, v.size) {
+			used = used || read[name]
+		}
+		if used {
+			continue
+		}
+		unused[qname] = true
+		message := fmt.Sprintf("%s %s is never read", v.kind, v.name)
+		if v.function != nil {
+			message = fmt.Sprintf("%s %s of %s is never read", v.kind, v.name, v.function.Name)
+		}
+		c.warn(WarnUnused, ErrorType{Code: CodeWarnUnused, Message: message, Pos: v.pos})
+	}
+	return unused
+}
+
+//warns about the assignments to scalar variables whose value no instruction reads before
+//the variable is assigned again or the program halts, found by a liveness analysis.
+//Inputs and the arguments of calls are not reported, nor the variables in skip.
+func (c *CodeGen) checkDeadStores(skip map[string]bool) {
+	index := map[string]int{}
+	for _, qname := range c.declaredOrder {
+		if v := c.declared[qname]; v.size == 0 && v.kind != "parameter" && !skip[qname] {
+			index[qname] = len(index)
+		}
+	}
+	if len(index) == 0 {
+		return
+	}
+	words := (len(index) + 63) / 64
+	next := c.successors()
+	live := make([][]uint64, len(c.code)) // variables whose value may be read after every instruction
+	for n := range live {
+		live[n] = make([]uint64, words)
+	}
+	//returns the variables whose value may be read from instruction n on
+	in := make([]uint64, words)
+	liveIn := func(n int) []uint64 {
+		copy(in, live[n])
+		reads, write := operands(c.code[n])
+		if k, ok := index[write]; ok {
+			in[k/64] &^= 1 << uint(k%64)
+		}
+		for _, arg := range reads {
+			if k, ok := index[arg]; ok {
+				in[k/64] |= 1 << uint(k%64)
+			}
+		}
+		return in
+	}
+	for changed := true; changed; {
+		changed = false
+		for n := len(c.code) - 1; n >= 0; n-- {
+			for _, s := range next[n] {
+				for w, bits := range liveIn(s) {
+					if live[n][w]|bits != live[n][w] {
+						live[n][w] |= bits
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	for n, ins := range c.code {
+		_, write := operands(ins)
+		k, ok := index[write]
+		if !ok || ins.Op == "IINP" || ins.Op == "RINP" || live[n][k/64]&(1<<uint(k%64)) != 0 {
+			continue
+		}
+		c.warn(WarnUnused, ErrorType{
+			Code:    CodeWarnDeadStore,
+			Message: fmt.Sprintf("value assigned to %s is never read", c.declared[write].name),
+			Pos:     ins.Pos,
+		})
+	}
+}
+
+//warns about the reads of scalar variables that some path from the start of the program
+//reaches before any assignment or input of the variable. Along the return of a call, a
+//variable is only unassigned if it was before the call, as the return jumps to every
+//call site of the function.
+func (c *CodeGen) checkUninitialized() {
+	index := map[string]int{}
+	for _, qname := range c.declaredOrder {
+		if c.declared[qname].size == 0 {
+			index[qname] = len(index)
+		}
+	}
+	if len(index) == 0 || len(c.code) == 0 {
+		return
+	}
+	words := (len(index) + 63) / 64
+	returns := map[string]bool{}
+	for _, info := range c.functionOrder {
+		for _, label := range info.returns {
+			returns[label] = true
+		}
+	}
+	next := c.successors()
+	unassigned := make([][]uint64, len(c.code)) // variables that may be unassigned before every instruction
+	for n := range unassigned {
+		unassigned[n] = make([]uint64, words)
+	}
+	for k := range index {
+		unassigned[0][index[k]/64] |= 1 << uint(index[k]%64)
+	}
+	out := make([]uint64, words)
+	for changed := true; changed; {
+		changed = false
+		for n, ins := range c.code {
+			copy(out, unassigned[n])
+			if _, write := operands(ins); write != "" {
+				if k, ok := index[write]; ok {
+					out[k/64] &^= 1 << uint(k%64)
+				}
+			}
+			for _, s := range next[n] {
+				for w, bits := range out {
+					if returns[c.code[s].Label] {
+						// the call before the return label
+						bits &= unassigned[s-1][w]
+					}
+					if unassigned[s][w]|bits != unassigned[s][w] {
+						unassigned[s][w] |= bits
+						changed = true
+					}
+				}
+			}
+		}
+	}
+	for n, ins := range c.code {
+		reads, _ := operands(ins)
+		for _, arg := range reads {
+			if k, ok := index[arg]; ok && unassigned[n][k/64]&(1<<uint(k%64)) != 0 {
+				c.warn(WarnUninitialized, ErrorType{
+					Code:    CodeWarnUninitialized,
+					Message: fmt.Sprintf("%s may be read before it is assigned", c.declared[arg].name),
+					Pos:     ins.Pos,
+				})
+			}
+		}
+	}
+}
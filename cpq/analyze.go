@@ -0,0 +1,905 @@
+package cpq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//semantic analysis: the names and types of a parsed program are checked before any code
+//is generated. It is the only phase that reports these errors; the code generator skips
+//what it cannot generate without repeating them
+
+//the state of the semantic analysis, which mirrors the symbol table of CodeGen
+type analyzer struct {
+	Errors    []ErrorType
+	std       Standard
+	reported  map[reportedError]bool
+	undefined map[string]bool
+	variables map[string]DataType
+	functions map[string]*Function
+	order     []*Function
+	calls     map[string][]*Call // calls in the body of every function, to find recursion
+	function  *Function          // function being analyzed, nil in the main block
+	locals    map[string]DataType
+	arrays    map[string]int64       // elements of every array, by QUAD name
+	quadNames map[string]string      // what every QUAD variable of the program is, see declareQuadName
+	constants map[string]*Expression // values of constants, by QUAD name
+	breaks    int                    // enclosing loops and switches
+	loops     int                    // enclosing loops
+
+	switchBreak bool // switch cases end with an implicit break, Options.SwitchBreak
+
+	diagnostics     *Diagnostics
+	symbols         *SymbolTable       // nil when it is not built
+	variableSymbols map[string]*Symbol // by QUAD name
+	functionSymbols map[string]*Symbol
+}
+
+// Analyze checks a parsed program: every name is declared once and defined where it is
+// used, and every statement and expression has operands of the types it needs. The
+// returned errors are the semantic errors Codegen reports; without them the program
+// can be generated.
+func Analyze(program *Program) []ErrorType {
+	return AnalyzeWithOptions(program, Options{})
+}
+
+//analyzes a program with the options of the compilation; only Std changes the result
+func AnalyzeWithOptions(program *Program, opts Options) []ErrorType {
+	a := newAnalyzer(opts)
+	a.analyzeProgram(program)
+	return a.Errors
+}
+
+func newAnalyzer(opts Options) *analyzer {
+	return &analyzer{
+		Errors:          []ErrorType{},
+		std:             opts.Std,
+		switchBreak:     opts.SwitchBreak,
+		diagnostics:     opts.Diagnostics,
+		reported:        map[reportedError]bool{},
+		undefined:       map[string]bool{},
+		variables:       map[string]DataType{},
+		functions:       map[string]*Function{},
+		calls:           map[string][]*Call{},
+		arrays:          map[string]int64{},
+		quadNames:       map[string]string{},
+		constants:       map[string]*Expression{},
+		variableSymbols: map[string]*Symbol{},
+		functionSymbols: map[string]*Symbol{},
+	}
+}
+
+//records a semantic error, once per message and position
+func (a *analyzer) addError(e ErrorType) {
+	key := reportedError{message: e.Text(), pos: e.Pos}
+	if a.reported[key] {
+		return
+	}
+	a.reported[key] = true
+	if a.diagnostics.Add(e) {
+		a.Errors = append(a.Errors, e)
+	}
+}
+
+//reports an undefined variable once, so its later uses do not repeat the error
+func (a *analyzer) undefinedVariable(name string, pos Position) {
+	if a.undefined[name] {
+		return
+	}
+	a.undefined[name] = true
+	a.addError(ErrorType{Code: CodeUndefinedVariable, Message: undefinedVariableMessage(name, a.locals, a.variables), Pos: pos})
+}
+
+//checks the parts of a program in the order their code is generated
+func (a *analyzer) analyzeProgram(program *Program) {
+	a.declarations(program.Declarations)
+	a.declareFunctions(program.Functions)
+	if program.StatementsBlock != nil {
+		a.statement(program.StatementsBlock)
+	}
+	a.analyzeFunctions()
+}
+
+//adds declared variables to the symbol table
+func (a *analyzer) declarations(declarations []Declaration) {
+	for _, declaration := range declarations {
+		for i, name := range declaration.Names {
+			if _, exists := a.variables[name]; exists {
+				a.addError(ErrorType{Code: CodeVariableDefined, Message: fmt.Sprintf("variable %s already defined", name), Pos: declaration.Pos})
+				continue
+			}
+			a.variables[name] = declaration.Type
+			a.declareQuadName(&declaration, i, name, describeVariable(&declaration, name))
+			a.declarationSymbol(&declaration, i, name)
+			a.declareVariable(&declaration, i, name)
+		}
+	}
+}
+
+//adds functions to the symbol table, so that calls can be checked before their bodies
+func (a *analyzer) declareFunctions(functions []*Function) {
+	for _, function := range functions {
+		_, isVariable := a.variables[function.Name]
+		if _, exists := a.functions[function.Name]; exists || isVariable {
+			a.addError(ErrorType{Code: CodeNameDefined, Message: fmt.Sprintf("%s already defined", function.Name), Pos: function.Pos})
+			continue
+		}
+		a.functions[function.Name] = function
+		a.order = append(a.order, function)
+		if a.symbols != nil {
+			symbol := &Symbol{Name: function.Name, Kind: SymbolFunction, Type: function.ReturnType, Pos: function.Pos}
+			a.symbols.Symbols = append(a.symbols.Symbols, symbol)
+			a.functionSymbols[function.Name] = symbol
+		}
+	}
+}
+
+//checks the bodies of the functions after the main block, and their calls for recursion
+func (a *analyzer) analyzeFunctions() {
+	for _, function := range a.order {
+		a.analyzeFunction(function)
+	}
+	a.function, a.locals = nil, nil
+	a.checkRecursion()
+}
+
+//records the size of an array or the value of a constant, like CodeGen.declareVariable
+func (a *analyzer) declareVariable(declaration *Declaration, i int, name string) {
+	size := declaration.Size(i)
+	if !declaration.Const {
+		if size > 0 {
+			a.arrays[name] = size
+		}
+		return
+	}
+	if size > 0 {
+		a.addError(ErrorType{Code: CodeConstantArray, Message: fmt.Sprintf("constant %s cannot be an array", declaration.Names[i]), Pos: declaration.Pos})
+		return
+	}
+	value := declaration.Value
+	if number, ok := value.(*IntNum); ok && declaration.Type == Float {
+		value = &FloatNum{Value: float64(number.Value), Position: number.Position}
+	}
+	exp := a.expression(value)
+	if exp == nil || declaration.Type == Unknown {
+		return
+	}
+	if !assignable(declaration.Type, exp.Type) {
+		a.addError(ErrorType{
+			Code:    CodeConstantType,
+			Message: fmt.Sprintf("cannot initialize %s constant %s with a %s value", declaration.Type, declaration.Names[i], exp.Type),
+			Pos:     declaration.Pos,
+		})
+		return
+	}
+	a.constants[name] = cast(exp, declaration.Type)
+}
+
+//records the QUAD variables of a declared variable, the elements too when it is an
+//array. The names of the program are joined with '_' into QUAD names, f_x for the local
+//x of f, p_x for the field x of p and a_0 for an element of a, so different variables
+//may get the same name: the local u of a function p and the field u of a struct p.
+func (a *analyzer) declareQuadName(declaration *Declaration, i int, quad, description string) {
+	if declaration.Const || !a.claimQuadName(quad, description, declaration.Pos) {
+		return
+	}
+	for k := int64(0); k < declaration.Size(i); k++ {
+		element := fmt.Sprintf("element %d of %s", k, description)
+		if !a.claimQuadName(quad+"_"+strconv.FormatInt(k, 10), element, declaration.Pos) {
+			return
+		}
+	}
+}
+
+//records what a QUAD variable is, reporting whether no other variable has it
+func (a *analyzer) claimQuadName(quad, description string, pos Position) bool {
+	if other, taken := a.quadNames[quad]; taken {
+		a.addError(ErrorType{Code: CodeNameClash, Message: fmt.Sprintf("%s and %s are both the QUAD variable %s", other, description, quad), Pos: pos})
+		return false
+	}
+	a.quadNames[quad] = description
+	return true
+}
+
+//returns how an error names a declared variable, whose name is NAME_field for a field
+func describeVariable(declaration *Declaration, name string) string {
+	if declaration.Struct != nil {
+		if i := strings.IndexByte(name, '_'); i >= 0 {
+			return fmt.Sprintf("field %s of %s", name[i+1:], name[:i])
+		}
+	}
+	return "variable " + name
+}
+
+//checks the parameters, local declarations and body of a function
+func (a *analyzer) analyzeFunction(function *Function) {
+	a.function = function
+	a.locals = map[string]DataType{}
+	for _, param := range function.Params {
+		if _, exists := a.locals[param.Name]; exists {
+			a.addError(ErrorType{Code: CodeParameterDefined, Message: fmt.Sprintf("parameter %s already defined", param.Name), Pos: param.Pos})
+			continue
+		}
+		a.locals[param.Name] = param.Type
+		a.claimQuadName(function.Name+"_"+param.Name, fmt.Sprintf("parameter %s of function %s", param.Name, function.Name), param.Pos)
+		a.declareSymbol(function.Name+"_"+param.Name, &Symbol{
+			Name:     param.Name,
+			Kind:     SymbolParameter,
+			Type:     param.Type,
+			Function: function.Name,
+			Pos:      param.Pos,
+		})
+	}
+	for _, declaration := range function.Declarations {
+		for i, name := range declaration.Names {
+			if _, exists := a.locals[name]; exists {
+				a.addError(ErrorType{Code: CodeVariableDefined, Message: fmt.Sprintf("variable %s already defined", name), Pos: declaration.Pos})
+				continue
+			}
+			a.locals[name] = declaration.Type
+			a.declareQuadName(&declaration, i, function.Name+"_"+name, describeVariable(&declaration, name)+" of function "+function.Name)
+			a.declarationSymbol(&declaration, i, function.Name+"_"+name)
+			a.declareVariable(&declaration, i, function.Name+"_"+name)
+		}
+	}
+	a.statement(function.Body)
+	if function.ReturnType != Unknown && function.Body != nil && !a.returns(function.Body) {
+		a.addError(ErrorType{Code: CodeMissingReturn, Message: fmt.Sprintf("missing return at the end of function %s", function.Name), Pos: function.Pos})
+	}
+}
+
+//reports whether every path through a statement ends with a return, so a function
+//cannot run past the end of its body; a loop may always end without one
+func (a *analyzer) returns(node Statement) bool {
+	switch s := node.(type) {
+	case *Return:
+		return true
+	case *Block:
+		return a.returnsAll(s.Statements)
+	case *IfStatement:
+		return s.ElseBranch != nil && a.returns(s.IfBranch) && a.returns(s.ElseBranch)
+	case *DoWhileStatement:
+		return a.returns(s.Body) && !breaks(s.Body)
+	case *Switch:
+		// every case, and the default, must return; a case that does not goes on into the
+		// next one, unless it breaks
+		next := a.returnsAll(s.DefaultCase) && !breaks(&Block{Statements: s.DefaultCase})
+		all := next
+		for i := len(s.Cases) - 1; i >= 0; i-- {
+			statements, continues := caseStatements(s.Cases[i].Statements)
+			falls := !a.switchBreak || continues
+			next = !breaks(&Block{Statements: statements}) && (a.returnsAll(statements) || falls && next)
+			all = all && next
+		}
+		return all
+	}
+	return false
+}
+
+//reports whether one of a list of statements returns on every path
+func (a *analyzer) returnsAll(statements []Statement) bool {
+	for _, statement := range statements {
+		if a.returns(statement) {
+			return true
+		}
+	}
+	return false
+}
+
+//reports whether a statement has a break that leaves it, one not in a loop or switch of its own
+func breaks(node Statement) bool {
+	switch s := node.(type) {
+	case *Break:
+		return true
+	case *Block:
+		for _, statement := range s.Statements {
+			if breaks(statement) {
+				return true
+			}
+		}
+	case *IfStatement:
+		return breaks(s.IfBranch) || s.ElseBranch != nil && breaks(s.ElseBranch)
+	}
+	return false
+}
+
+//reports calls that can reach the function they are in
+func (a *analyzer) checkRecursion() {
+	for _, function := range a.order {
+		visited := map[string]bool{}
+		var reaches func(name string) bool
+		reaches = func(name string) bool {
+			if name == function.Name {
+				return true
+			}
+			if visited[name] {
+				return false
+			}
+			visited[name] = true
+			for _, call := range a.calls[name] {
+				if reaches(call.Function) {
+					return true
+				}
+			}
+			return false
+		}
+		for _, call := range a.calls[function.Name] {
+			if reaches(call.Function) {
+				a.addError(ErrorType{
+					Code:    CodeRecursion,
+					Message: fmt.Sprintf("recursive call to %s is not supported", call.Function),
+					Pos:     call.Position,
+				})
+			}
+		}
+	}
+}
+
+//returns the QUAD name and type of a variable, a local of the function or a global
+func (a *analyzer) variable(name string) (string, DataType, bool) {
+	if varType, ok := a.locals[name]; ok {
+		return a.function.Name + "_" + name, varType, true
+	}
+	varType, ok := a.variables[name]
+	return name, varType, ok
+}
+
+//reports an array used without an index, or an index on a scalar
+func (a *analyzer) checkIndex(variable, name string, index NodeExpression, pos Position) bool {
+	_, isArray := a.arrays[name]
+	if isArray && index == nil {
+		a.addError(ErrorType{Code: CodeMissingIndex, Message: fmt.Sprintf("array %s needs an index", variable), Pos: pos})
+		return false
+	}
+	if !isArray && index != nil {
+		a.addError(ErrorType{Code: CodeNotArray, Message: fmt.Sprintf("%s is not an array", variable), Pos: pos})
+		return false
+	}
+	return true
+}
+
+//checks the index of array[index]: a constant index must be in range, any other must be an int
+func (a *analyzer) checkElement(array, name string, index NodeExpression, pos Position) bool {
+	if number, ok := index.(*IntNum); ok {
+		if size := a.arrays[name]; number.Value < 0 || number.Value >= size {
+			a.addError(ErrorType{
+				Code:    CodeIndexRange,
+				Message: fmt.Sprintf("index %d is out of range of %s[%d]", number.Value, array, size),
+				Pos:     pos,
+			})
+			return false
+		}
+		return true
+	}
+	exp := a.expression(index)
+	if exp == nil {
+		return false
+	}
+	if exp.Type != Integer {
+		a.addError(ErrorType{Code: CodeIndexType, Message: "array index must be an integer", Pos: pos})
+		return false
+	}
+	return true
+}
+
+func (a *analyzer) statement(node Statement) {
+	if a.diagnostics.Full() {
+		return
+	}
+	switch s := node.(type) {
+	case *Assignment:
+		a.expression(s)
+	case *Input:
+		a.input(s)
+	case *Output:
+		if _, ok := s.Value.(*StringLiteral); !ok {
+			a.expression(s.Value)
+		}
+	case *IfStatement:
+		a.boolean(s.Condition)
+		a.statement(s.IfBranch)
+		if s.ElseBranch != nil {
+			a.statement(s.ElseBranch)
+		}
+	case *WhileStatement:
+		a.boolean(s.Condition)
+		a.loopBody(s.Body)
+	case *ForStatement:
+		if s.Init != nil {
+			a.statement(s.Init)
+		}
+		a.boolean(s.Condition)
+		a.loopBody(s.Body)
+		if s.Step != nil {
+			a.statement(s.Step)
+		}
+	case *DoWhileStatement:
+		a.loopBody(s.Body)
+		a.boolean(s.Condition)
+	case *Switch:
+		a.switchStatement(s)
+	case *Break:
+		if a.breaks == 0 {
+			a.addError(ErrorType{Code: CodeBreakOutside, Message: "break statement must be inside a loop or a switch case", Pos: s.Position})
+		}
+	case *Continue:
+		if a.loops == 0 {
+			a.addError(ErrorType{Code: CodeContinueOutside, Message: "continue statement must be inside a loop", Pos: s.Position})
+		}
+	case *Fallthrough:
+		a.addError(ErrorType{
+			Code:    CodeFallthroughOutside,
+			Message: "fallthrough statement must be the last statement of a switch case",
+			Pos:     s.Position,
+		})
+	case *Call:
+		if exp := a.call(s, false); exp != nil {
+			annotate(s, exp.Type)
+		}
+	case *Return:
+		a.returnStatement(s)
+	case *Block:
+		for _, statement := range s.Statements {
+			a.statement(statement)
+		}
+	}
+}
+
+//checks the body of a loop, where break and continue are allowed
+func (a *analyzer) loopBody(body Statement) {
+	a.breaks++
+	a.loops++
+	a.statement(body)
+	a.breaks--
+	a.loops--
+}
+
+//checks an assignment and returns the value assigned, before its conversion to the type
+//of the variable
+func (a *analyzer) assignment(node *Assignment) *Expression {
+	exp := a.expression(node.Val)
+	name, varType, exists := a.variable(node.Variable)
+	if !exists {
+		a.undefinedVariable(node.Variable, node.Pos)
+		return nil
+	}
+	a.use(name, node.Pos)
+	if exp == nil || !a.checkIndex(node.Variable, name, node.Index, node.Pos) {
+		return nil
+	}
+	if _, isConstant := a.constants[name]; isConstant {
+		a.addError(ErrorType{Code: CodeAssignConstant, Message: fmt.Sprintf("cannot assign to constant %s", node.Variable), Pos: node.Pos})
+		return nil
+	}
+	if varType == Unknown {
+		return nil
+	}
+	if !assignable(varType, exp.Type) {
+		a.addError(ErrorType{
+			Code:    CodeAssignType,
+			Message: fmt.Sprintf("cannot assign %s value to %s variable %s", exp.Type, varType, node.Variable),
+			Pos:     node.Pos,
+		})
+		return nil
+	}
+	if node.Index != nil && !a.checkElement(node.Variable, name, node.Index, node.Pos) {
+		return nil
+	}
+	return exp
+}
+
+func (a *analyzer) input(node *Input) {
+	// input of no variable, a syntax error
+	if node.Variable == "" {
+		return
+	}
+	name, varType, exists := a.variable(node.Variable)
+	if !exists {
+		a.undefinedVariable(node.Variable, node.Pos)
+		return
+	}
+	a.use(name, node.Pos)
+	if !a.checkIndex(node.Variable, name, node.Index, node.Pos) || varType == Unknown {
+		return
+	}
+	if _, isConstant := a.constants[name]; isConstant {
+		a.addError(ErrorType{Code: CodeInputConstant, Message: fmt.Sprintf("cannot input into constant %s", node.Variable), Pos: node.Pos})
+		return
+	}
+	if varType == Bool {
+		a.addError(ErrorType{Code: CodeInputBool, Message: fmt.Sprintf("cannot input into bool variable %s", node.Variable), Pos: node.Pos})
+		return
+	}
+	if node.Min != nil && node.Max != nil {
+		min, max := a.expression(node.Min), a.expression(node.Max)
+		if min != nil && max != nil && varType == Integer && (min.Type == Float || max.Type == Float) {
+			a.addError(ErrorType{
+				Code:    CodeRangeBounds,
+				Message: fmt.Sprintf("range of int variable %s must have int bounds", node.Variable),
+				Pos:     node.Pos,
+			})
+		}
+	}
+	if node.Index != nil {
+		a.checkElement(node.Variable, name, node.Index, node.Pos)
+	}
+}
+
+func (a *analyzer) switchStatement(node *Switch) {
+	exp := a.expression(node.Expression)
+	if exp == nil {
+		return
+	}
+	if exp.Type != Integer {
+		a.addError(ErrorType{Code: CodeSwitchType, Message: "switch expression must be an integer", Pos: node.Position})
+	}
+	for _, switchCase := range node.Cases {
+		for _, label := range switchCase.Labels {
+			if label.Min > label.Max {
+				a.addError(ErrorType{
+					Code:    CodeEmptyCaseRange,
+					Message: fmt.Sprintf("case range %d..%d is empty", label.Min, label.Max),
+					Pos:     switchCase.Position,
+				})
+			}
+		}
+	}
+	a.breaks++
+	for _, switchCase := range node.Cases {
+		statements, _ := caseStatements(switchCase.Statements)
+		a.statement(&Block{Statements: statements})
+	}
+	a.statement(&Block{Statements: node.DefaultCase})
+	a.breaks--
+}
+
+func (a *analyzer) returnStatement(node *Return) {
+	if a.function == nil {
+		a.addError(ErrorType{Code: CodeReturnOutside, Message: "return statement must be inside a function", Pos: node.Position})
+		return
+	}
+	returnType := a.function.ReturnType
+	if node.Value == nil {
+		if returnType != Unknown {
+			a.addError(ErrorType{Code: CodeReturnNoValue, Message: fmt.Sprintf("function %s must return a value", a.function.Name), Pos: node.Position})
+		}
+		return
+	}
+	if returnType == Unknown {
+		a.addError(ErrorType{Code: CodeProcedureReturnValue, Message: fmt.Sprintf("procedure %s cannot return a value", a.function.Name), Pos: node.Position})
+		return
+	}
+	exp := a.expression(node.Value)
+	if exp != nil && !assignable(returnType, exp.Type) {
+		a.addError(ErrorType{
+			Code:    CodeReturnType,
+			Message: fmt.Sprintf("cannot return %s value from %s function %s", exp.Type, returnType, a.function.Name),
+			Pos:     node.Position,
+		})
+	}
+}
+
+//checks a call of a function, a procedure when value is false, or a builtin
+func (a *analyzer) call(node *Call, value bool) *Expression {
+	function, ok := a.functions[node.Function]
+	if _, isBuiltin := builtins[node.Function]; isBuiltin && !ok {
+		return a.builtin(node)
+	}
+	if !ok {
+		a.addError(ErrorType{Code: CodeUndefinedFunction, Message: fmt.Sprintf("undefined function %s", node.Function), Pos: node.Position})
+		return nil
+	}
+	if symbol := a.functionSymbols[node.Function]; symbol != nil {
+		symbol.Uses = append(symbol.Uses, node.Position)
+	}
+	if value && function.ReturnType == Unknown {
+		a.addError(ErrorType{Code: CodeProcedureValue, Message: fmt.Sprintf("procedure %s has no value", node.Function), Pos: node.Position})
+		return nil
+	}
+	if len(node.Args) != len(function.Params) {
+		a.addError(ErrorType{
+			Code:    CodeArgumentCount,
+			Message: fmt.Sprintf("%s takes %d arguments, found %d", node.Function, len(function.Params), len(node.Args)),
+			Pos:     node.Position,
+		})
+		return nil
+	}
+	for i, arg := range node.Args {
+		exp := a.expression(arg)
+		param := function.Params[i]
+		if exp == nil || param.Type == Unknown {
+			return nil
+		}
+		if !assignable(param.Type, exp.Type) {
+			a.addError(ErrorType{
+				Code:    CodeArgumentType,
+				Message: fmt.Sprintf("cannot pass %s value to %s parameter %s of %s", exp.Type, param.Type, param.Name, node.Function),
+				Pos:     node.Position,
+			})
+			return nil
+		}
+	}
+	if a.function != nil {
+		a.calls[a.function.Name] = append(a.calls[a.function.Name], node)
+	}
+	return &Expression{Type: function.ReturnType}
+}
+
+//checks a call of sqrt or pow
+func (a *analyzer) builtin(node *Call) *Expression {
+	if a.std == StdCPL {
+		a.addError(ErrorType{Code: CodeExtension, Message: fmt.Sprintf("the %s builtin is not part of standard CPL", node.Function), Pos: node.Position})
+	}
+	if len(node.Args) != builtins[node.Function] {
+		a.addError(ErrorType{
+			Code:    CodeArgumentCount,
+			Message: fmt.Sprintf("%s takes %d arguments, found %d", node.Function, builtins[node.Function], len(node.Args)),
+			Pos:     node.Position,
+		})
+		return nil
+	}
+	args := make([]*Expression, len(node.Args))
+	for i, arg := range node.Args {
+		if args[i] = a.expression(arg); args[i] == nil {
+			return nil
+		}
+		if args[i].Type == Bool {
+			a.addError(ErrorType{Code: CodeBuiltinBool, Message: fmt.Sprintf("cannot pass bool value to %s", node.Function), Pos: node.Position})
+			return nil
+		}
+	}
+	if node.Function == "sqrt" {
+		return &Expression{Type: Float}
+	}
+	if args[1].Type != Integer {
+		a.addError(ErrorType{Code: CodePowExponent, Message: "the exponent of pow must be an int", Pos: node.Position})
+		return nil
+	}
+	return &Expression{Type: args[0].Type}
+}
+
+//returns the type of an expression, with the literal of its value in Code when it is
+//known before the program runs; nil when the expression has an error. The type is also
+//recorded in the node.
+func (a *analyzer) expression(node Node) *Expression {
+	exp := a.check(node)
+	if exp != nil {
+		annotate(node, exp.Type)
+	}
+	return exp
+}
+
+func (a *analyzer) check(node Node) *Expression {
+	switch e := node.(type) {
+	case *Arithmetic:
+		return a.arithmetic(e)
+	case *Call:
+		return a.call(e, true)
+	case *Variable:
+		name, varType, exists := a.variable(e.Variable)
+		if !exists {
+			a.undefinedVariable(e.Variable, e.Position)
+			return nil
+		}
+		a.use(name, e.Position)
+		if varType == Unknown || !a.checkIndex(e.Variable, name, nil, e.Position) {
+			return nil
+		}
+		if constant, isConstant := a.constants[name]; isConstant {
+			return constant
+		}
+		return &Expression{Type: varType}
+	case *Element:
+		name, varType, exists := a.variable(e.Array)
+		if !exists {
+			a.undefinedVariable(e.Array, e.Position)
+			return nil
+		}
+		a.use(name, e.Position)
+		if varType == Unknown || !a.checkIndex(e.Array, name, e.Index, e.Position) {
+			return nil
+		}
+		if !a.checkElement(e.Array, name, e.Index, e.Position) {
+			return nil
+		}
+		return &Expression{Type: varType}
+	case *IntNum:
+		return &Expression{Code: strconv.FormatInt(e.Value, 10), Type: Integer}
+	case *FloatNum:
+		return &Expression{Code: strconv.FormatFloat(e.Value, 'f', 6, 64), Type: Float}
+	case *BoolLiteral:
+		return &Expression{Type: Bool}
+	case *CharLiteral:
+		return &Expression{Code: strconv.Itoa(int(e.Value)), Type: Integer}
+	case *Condition:
+		if !a.boolean(e.Value) {
+			return nil
+		}
+		return &Expression{Type: Bool}
+	case *Cast:
+		exp := a.expression(e.Value)
+		if exp == nil || e.Type == Unknown {
+			return nil
+		}
+		if exp.Type != e.Type && (exp.Type == Bool || e.Type == Bool) {
+			a.addError(ErrorType{Code: CodeBoolCast, Message: "static_cast cannot convert bool values", Pos: e.Position})
+			return nil
+		}
+		return cast(exp, e.Type)
+	case *Conditional:
+		return a.conditional(e)
+	case *Assignment:
+		return a.assignment(e)
+	case *StringLiteral:
+		a.addError(ErrorType{Code: CodeStringValue, Message: "a string can only be written by output", Pos: e.Position})
+	}
+	return nil
+}
+
+func (a *analyzer) arithmetic(node *Arithmetic) *Expression {
+	lhs := a.expression(node.LHS)
+	rhs := a.expression(node.RHS)
+	if lhs == nil || rhs == nil {
+		return nil
+	}
+	if lhs.Type == Bool || rhs.Type == Bool {
+		a.addError(ErrorType{Code: CodeBoolArithmetic, Message: "cannot use bool values in arithmetic", Pos: node.Position})
+		return nil
+	}
+	if node.Operator == Modulo && (lhs.Type == Float || rhs.Type == Float) {
+		a.addError(ErrorType{Code: CodeModuloType, Message: "operator % needs int operands", Pos: node.Position})
+		return nil
+	}
+	resultType := calculateExpressionType(lhs.Type, rhs.Type)
+	lhs, rhs = cast(lhs, resultType), cast(rhs, resultType)
+	if (node.Operator == Divide || node.Operator == Modulo) && zeroLiteral(rhs) {
+		a.addError(ErrorType{Code: CodeDivisionByZero, Message: "division by zero", Pos: node.Position})
+		return nil
+	}
+	if folded := foldArithmetic(node.Operator, resultType, lhs, rhs); folded != nil {
+		return folded
+	}
+	return &Expression{Type: resultType}
+}
+
+func (a *analyzer) conditional(node *Conditional) *Expression {
+	thenType, elseType := a.expressionType(node.Then), a.expressionType(node.Else)
+	resultType := conditionalType(thenType, elseType)
+	if resultType == Unknown && thenType != Unknown && elseType != Unknown {
+		a.addError(ErrorType{
+			Code:    CodeConditionalTypes,
+			Message: fmt.Sprintf("the values of ?: have different types %s and %s", thenType, elseType),
+			Pos:     node.Position,
+		})
+		return nil
+	}
+	if !a.boolean(node.Condition) {
+		return nil
+	}
+	if a.expression(node.Then) == nil || resultType == Unknown || a.expression(node.Else) == nil {
+		return nil
+	}
+	return &Expression{Type: resultType}
+}
+
+//returns the type of an expression without checking it
+func (a *analyzer) expressionType(node NodeExpression) DataType {
+	return expressionType(node, func(name string) DataType {
+		_, t, _ := a.variable(name)
+		return t
+	}, func(name string) DataType {
+		if function, ok := a.functions[name]; ok {
+			return function.ReturnType
+		}
+		return Unknown
+	})
+}
+
+//checks a condition of if, a loop or ?:; the operands of && and || are both checked
+func (a *analyzer) boolean(node Boolean) bool {
+	switch b := node.(type) {
+	case *Or:
+		lhs := a.boolean(b.LHS)
+		return a.boolean(b.RHS) && lhs
+	case *And:
+		lhs := a.boolean(b.LHS)
+		return a.boolean(b.RHS) && lhs
+	case *Not:
+		return a.boolean(b.Value)
+	case *Compare:
+		return a.compare(b)
+	case *BoolTest:
+		exp := a.expression(b.Value)
+		if exp == nil {
+			return false
+		}
+		if exp.Type != Bool {
+			a.addError(ErrorType{Code: CodeConditionType, Message: "condition must be a comparison or a bool value", Pos: b.Position})
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+//checks that the operands of a comparison are both bool, compared with == or !=, or both numbers
+func (a *analyzer) compare(node *Compare) bool {
+	lhs := a.expression(node.LHS)
+	rhs := a.expression(node.RHS)
+	if lhs == nil || rhs == nil {
+		return false
+	}
+	if (lhs.Type == Bool) != (rhs.Type == Bool) {
+		a.addError(ErrorType{
+			Code:    CodeCompareTypes,
+			Message: fmt.Sprintf("cannot compare %s value with %s value", lhs.Type, rhs.Type),
+			Pos:     node.Position,
+		})
+		return false
+	}
+	if lhs.Type == Bool && node.Operator != EqualTo && node.Operator != NotEqualTo {
+		a.addError(ErrorType{Code: CodeBoolOrder, Message: "bool values can only be compared with == and !=", Pos: node.Position})
+		return false
+	}
+	return true
+}
+
+//returns the type and literal of a value converted to t
+func cast(exp *Expression, t DataType) *Expression {
+	if exp.Type == t {
+		return exp
+	}
+	if folded := foldCast(exp, t); folded != nil {
+		return folded
+	}
+	return &Expression{Type: t}
+}
+
+//sets the type of an expression node that records it
+func annotate(node Node, t DataType) {
+	switch e := node.(type) {
+	case *Variable:
+		e.Type = t
+	case *Element:
+		e.Type = t
+	case *Call:
+		e.Type = t
+	case *Arithmetic:
+		e.Type = t
+	case *Conditional:
+		e.Type = t
+	case *Assignment:
+		e.Type = t
+	}
+}
+
+// TypeOf returns the type of an expression of a program checked by Analyze, or compiled,
+// for tools that show or use the types of expressions. Literals and casts have their type
+// even before the analysis; an expression with an error, a string or a procedure call is
+// Unknown.
+func TypeOf(node NodeExpression) DataType {
+	switch e := node.(type) {
+	case *IntNum, *CharLiteral:
+		return Integer
+	case *FloatNum:
+		return Float
+	case *BoolLiteral, *Condition:
+		return Bool
+	case *Cast:
+		return e.Type
+	case *Variable:
+		return e.Type
+	case *Element:
+		return e.Type
+	case *Call:
+		return e.Type
+	case *Arithmetic:
+		return e.Type
+	case *Conditional:
+		return e.Type
+	case *Assignment:
+		return e.Type
+	}
+	return Unknown
+}
@@ -0,0 +1,178 @@
+package cpq
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+//analyzes a program that parses without errors and returns the texts of its errors
+func analyzeSource(t *testing.T, src string, opts Options) []string {
+	t.Helper()
+	program, errors := Parse(src)
+	if len(errors) > 0 {
+		t.Fatalf("parse errors: %v", errors)
+	}
+	texts := []string{}
+	for _, e := range AnalyzeWithOptions(program, opts) {
+		texts = append(texts, e.Text())
+	}
+	return texts
+}
+
+func TestMissingReturn(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		missing bool
+	}{
+		{"no return", "{ output(a); }", true},
+		{"return at the end", "{ output(a); return a; }", false},
+		{"if without else", "{ if (a > 0) return 1; }", true},
+		{"if and else", "{ if (a > 0) return 1; else return 2; }", false},
+		{"return after if", "{ if (a > 0) return 1; return 2; }", false},
+		{"while", "{ while (a > 0) return 1; }", true},
+		{"do while", "{ do { return 1; } while (a > 0); }", false},
+		{"do while with break", "{ do { if (a > 0) break; return 1; } while (a > 0); }", true},
+		{"switch", "{ switch (a) { case 1: return 1; default: return 2; } }", false},
+		{"switch falling into a return", "{ switch (a) { case 1: output(1); default: return 2; } }", false},
+		{"switch with break", "{ switch (a) { case 1: break; default: return 2; } }", true},
+		{"switch without return in default", "{ switch (a) { case 1: return 1; default: output(2); } }", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			src := "x : int;\nfunc f(a : int) : int\n" + test.body + "\n{ x = f(1); output(x); }\n"
+			errors := analyzeSource(t, src, Options{})
+			found := false
+			for _, e := range errors {
+				if strings.Contains(e, "missing return at the end of function f") {
+					found = true
+				} else {
+					t.Errorf("unexpected error %q", e)
+				}
+			}
+			if found != test.missing {
+				t.Errorf("missing return reported: %v, want %v", found, test.missing)
+			}
+		})
+	}
+}
+
+func TestMissingReturnSwitchBreak(t *testing.T) {
+	//with --switch=break a case that does not return ends the switch
+	src := "x : int;\nfunc f(a : int) : int\n{ switch (a) { case 1: output(1); default: return 2; } }\n{ x = f(1); output(x); }\n"
+	errors := analyzeSource(t, src, Options{SwitchBreak: true})
+	if len(errors) != 1 || !strings.Contains(errors[0], "missing return") {
+		t.Errorf("errors = %q, want a missing return", errors)
+	}
+}
+
+func TestProcedureNeedsNoReturn(t *testing.T) {
+	src := "x : int;\nfunc p(a : int)\n{ output(a); }\n{ p(1); }\n"
+	if errors := analyzeSource(t, src, Options{}); len(errors) > 0 {
+		t.Errorf("errors = %q, want none", errors)
+	}
+}
+
+func TestCodegenReportsTheAnalysis(t *testing.T) {
+	//every error is found by the analysis alone, and the generator keeps a placeholder
+	//for every statement it skipped
+	src := "a : int; b : bool;\n{ a = b + 1; c = 2; input(b); output(a); }\n"
+	program, errors := Parse(src)
+	if len(errors) > 0 {
+		t.Fatalf("parse errors: %v", errors)
+	}
+	analysis := AnalyzeWithOptions(program, Options{})
+	code, codegenErrors, _ := CodegenInstructions(program, Options{})
+	if len(analysis) != 3 || len(codegenErrors) != len(analysis) {
+		t.Fatalf("analysis %v, code generation %v", analysis, codegenErrors)
+	}
+	for i := range analysis {
+		if codegenErrors[i].Error() != analysis[i].Error() {
+			t.Errorf("error %d = %q, want %q", i, codegenErrors[i].Error(), analysis[i].Error())
+		}
+	}
+	placeholders := 0
+	for _, ins := range code {
+		if ins.Op == ErrorPlaceholder {
+			placeholders++
+		}
+	}
+	if placeholders != 3 {
+		t.Errorf("%d placeholders, want 3", placeholders)
+	}
+}
+
+//any integer value can be switched on, and a float one is rejected
+func TestSwitchExpressionType(t *testing.T) {
+	tests := []struct {
+		expression string
+		rejected   bool
+	}{
+		{"a * 2 + 1", false},
+		{"b[a]", false},
+		{"f(a)", false},
+		{"static_cast<int>(x)", false},
+		{"x", true},
+		{"a + 0.5", true},
+		{"a / 2.0", true},
+		{"static_cast<float>(a)", true},
+	}
+	for _, test := range tests {
+		src := "a : int; b[3] : int; x : float;\nfunc f(p : int) : int { return p; }\n{ a = 1; x = 1; b[0] = 1; " +
+			"switch (" + test.expression + ") { case 1: output(1); default: output(0); } }\n"
+		errors := analyzeSource(t, src, Options{})
+		want := []string{}
+		if test.rejected {
+			want = []string{"switch expression must be an integer"}
+		}
+		if strings.Join(errors, "\n") != strings.Join(want, "\n") {
+			t.Errorf("switch (%s): errors = %q, want %q", test.expression, errors, want)
+		}
+	}
+}
+
+//the parameter u of p and the field p.u would both be the QUAD variable p_u
+func TestFunctionNamedLikeStruct(t *testing.T) {
+	src := `r : int;
+p : struct { u : int; };
+func %s(u : int) : int { return u; }
+{ p.u = 10; r = %s(5); output(p.u); output(r); }`
+	result, err := Compile(fmt.Sprintf(src, "p", "p"), Options{})
+	want := "field u of p and parameter u of function p are both the QUAD variable p_u"
+	if err == nil || len(result.Errors) != 1 || result.Errors[0].Code != CodeNameClash || result.Errors[0].Text() != want {
+		t.Errorf("function p: errors = %v", result.Errors)
+	}
+	output, err := crossCheck(fmt.Sprintf(src, "f", "f"), "", Options{})
+	if err != nil || output != "10\n5\n" {
+		t.Errorf("function f printed %q, %v", output, err)
+	}
+}
+
+//the program names joined into QUAD names clash only when they really are the same
+func TestQuadNameClash(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"p : struct { u : int; };\nfunc p() : int u : int; { u = 1; return u; }\n{ output(p()); }",
+			[]string{"field u of p and variable u of function p are both the QUAD variable p_u"}},
+		{"p : struct { u : int; };\nfunc p(u : int) : int { return u; }\n{ output(p(1)); }",
+			[]string{"field u of p and parameter u of function p are both the QUAD variable p_u"}},
+		{"p[2] : struct { u : int; };\nfunc p() : int u[2] : int; { u[0] = 1; return u[0]; }\n{ output(p()); }",
+			[]string{"field u of p and variable u of function p are both the QUAD variable p_u"}},
+		{"p : struct { u[2] : int; };\nfunc p() : int u[2] : int; { u[1] = 1; return u[1]; }\n{ output(p()); }",
+			[]string{"field u of p and variable u of function p are both the QUAD variable p_u"}},
+		{"a[2] : int;\nfunc a() : int { return 1; }\n{ output(1); }",
+			[]string{"a already defined"}},
+		{"p : struct { u : int; };\nfunc f(u : int) : int p : int; { p = u; return p; }\n{ p.u = f(1); output(p.u); }", []string{}},
+		{"a[2] : int; b : int;\nfunc a0() : int b : int; { b = 1; return b; }\n{ a[0] = a0(); output(a[0]); }", []string{}},
+		{"p : struct { u[2] : int; };\nfunc f() : int p : int; pu[2] : int; { p = 1; return p; }\n{ p.u[1] = f(); output(p.u[1]); }", []string{}},
+	}
+	for _, test := range tests {
+		errors := analyzeSource(t, test.src, Options{})
+		if strings.Join(errors, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s\nerrors = %q, want %q", test.src, errors, test.want)
+		}
+	}
+}
@@ -0,0 +1,280 @@
+package cpq
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+//The JSON form of a syntax tree has an object for every struct, with the fields of the
+//struct under their names starting in lower case. The object of a node also has a "kind",
+//the name of its type, which tells which node an expression, condition or statement is:
+//
+//	{"kind": "Arithmetic", "lhs": {"kind": "Variable", "variable": "a", ...}, "operator": "+", ...}
+//
+//Types are written as "int", "float", "bool" or "unknown", operators as in CPL, and nil
+//nodes and slices as null. A compound assignment to an element, a[i] += 2, also has
+//"compound": true, as its element shares the index of the assignment.
+
+//the types of the nodes, by kind
+var astKinds = map[string]reflect.Type{}
+
+func init() {
+	for _, node := range []Node{
+		&Program{}, &Function{}, &Declaration{}, &SwitchCase{},
+		&Assignment{}, &Input{}, &Output{}, &IfStatement{}, &WhileStatement{}, &DoWhileStatement{},
+		&ForStatement{}, &Switch{}, &Break{}, &Continue{}, &Fallthrough{}, &Call{}, &Return{}, &Block{},
+		&Variable{}, &Element{}, &BoolLiteral{}, &Condition{}, &Conditional{}, &BoolTest{}, &Cast{},
+		&StringLiteral{}, &CharLiteral{}, &IntNum{}, &FloatNum{}, &Arithmetic{},
+		&Or{}, &And{}, &Not{}, &Compare{},
+	} {
+		t := reflect.TypeOf(node)
+		astKinds[t.Elem().Name()] = t
+	}
+}
+
+//spelling of the operators in CPL
+var operatorSymbols = map[Operator]string{
+	Add: "+", Subtract: "-", Multiply: "*", Divide: "/", Modulo: "%",
+	EqualTo: "==", NotEqualTo: "!=", GreaterThan: ">", LessThan: "<",
+	GreaterThanOrEqualTo: ">=", LessThenOrEqualTo: "<=",
+}
+
+var (
+	dataTypeType = reflect.TypeOf(Unknown)
+	operatorType = reflect.TypeOf(Add)
+	nodeType     = reflect.TypeOf((*Node)(nil)).Elem()
+)
+
+// MarshalAST returns the JSON form of a syntax tree, for tools that inspect it outside
+// of Go. UnmarshalAST reads it back.
+func MarshalAST(program *Program) ([]byte, error) {
+	return json.MarshalIndent(encodeAST(reflect.ValueOf(program)), "", "  ")
+}
+
+// UnmarshalAST returns the syntax tree of its JSON form, as written by MarshalAST or
+// built by another tool. The declarations of the same enum share one Enum, as they do
+// after parsing.
+func UnmarshalAST(data []byte) (*Program, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var tree interface{}
+	if err := decoder.Decode(&tree); err != nil {
+		return nil, err
+	}
+	d := astDecoder{shared: map[string]reflect.Value{}}
+	program := reflect.New(reflect.TypeOf(&Program{})).Elem()
+	if err := d.decode(tree, program, "program"); err != nil {
+		return nil, err
+	}
+	return program.Interface().(*Program), nil
+}
+
+//returns the JSON name of a field
+func jsonName(field string) string {
+	first, size := utf8.DecodeRuneInString(field)
+	return string(unicode.ToLower(first)) + field[size:]
+}
+
+//returns the value of the JSON form of v
+func encodeAST(v reflect.Value) interface{} {
+	switch v.Type() {
+	case dataTypeType:
+		return DataType(v.Int()).String()
+	case operatorType:
+		return operatorSymbols[Operator(v.Int())]
+	}
+	switch v.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		if v.IsNil() {
+			return nil
+		}
+		if v.Kind() == reflect.Interface {
+			return encodeAST(v.Elem())
+		}
+		object := encodeAST(v.Elem()).(map[string]interface{})
+		if v.Type().Implements(nodeType) {
+			object["kind"] = v.Type().Elem().Name()
+		}
+		if a, ok := v.Interface().(*Assignment); ok && a.compoundElement() != nil {
+			object["compound"] = true
+		}
+		return object
+	case reflect.Struct:
+		object := map[string]interface{}{}
+		if reflect.PointerTo(v.Type()).Implements(nodeType) {
+			object["kind"] = v.Type().Name()
+		}
+		for i := 0; i < v.NumField(); i++ {
+			if field := v.Type().Field(i); field.PkgPath == "" {
+				object[jsonName(field.Name)] = encodeAST(v.Field(i))
+			}
+		}
+		return object
+	case reflect.Slice:
+		if v.IsNil() {
+			return nil
+		}
+		items := make([]interface{}, v.Len())
+		for i := range items {
+			items[i] = encodeAST(v.Index(i))
+		}
+		return items
+	}
+	return v.Interface()
+}
+
+//gives the element of a compound assignment the index of the assignment
+func shareIndex(a *Assignment, data interface{}, path string) error {
+	if compound, _ := data.(map[string]interface{})["compound"].(bool); !compound {
+		return nil
+	}
+	if arithmetic, ok := a.Val.(*Arithmetic); ok && a.Index != nil {
+		if element, ok := arithmetic.LHS.(*Element); ok && element.Array == a.Variable {
+			element.Index = a.Index
+			return nil
+		}
+	}
+	return fmt.Errorf("%s: a compound assignment needs an element of %s on the left of its value", path, a.Variable)
+}
+
+//reads the JSON form of a syntax tree
+type astDecoder struct {
+	shared map[string]reflect.Value // enums and structs by their JSON form
+}
+
+//sets v from the JSON value data; path names the value in errors, like
+//program.statementsBlock.statements[2]
+func (d *astDecoder) decode(data interface{}, v reflect.Value, path string) error {
+	switch v.Type() {
+	case dataTypeType:
+		name, _ := data.(string)
+		for _, t := range []DataType{Unknown, Float, Integer, Bool} {
+			if t.String() == name {
+				v.SetInt(int64(t))
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: unknown type %v", path, data)
+	case operatorType:
+		for operator, symbol := range operatorSymbols {
+			if symbol == data {
+				v.SetInt(int64(operator))
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: unknown operator %v", path, data)
+	}
+	if data == nil {
+		switch v.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Slice:
+			v.Set(reflect.Zero(v.Type()))
+			return nil
+		}
+		return fmt.Errorf("%s: missing value", path)
+	}
+	switch v.Kind() {
+	case reflect.Interface:
+		object, _ := data.(map[string]interface{})
+		kind, _ := object["kind"].(string)
+		t, ok := astKinds[kind]
+		if !ok || !t.Implements(v.Type()) {
+			return fmt.Errorf("%s: %q is not a kind of %s", path, kind, v.Type().Name())
+		}
+		node := reflect.New(t).Elem()
+		if err := d.decode(data, node, path); err != nil {
+			return err
+		}
+		v.Set(node)
+		return nil
+	case reflect.Ptr:
+		key := ""
+		if t := v.Type().Elem(); t == reflect.TypeOf(Enum{}) || t == reflect.TypeOf(Struct{}) {
+			text, _ := json.Marshal(data)
+			key = t.Name() + string(text)
+			if shared, ok := d.shared[key]; ok {
+				v.Set(shared)
+				return nil
+			}
+		}
+		v.Set(reflect.New(v.Type().Elem()))
+		if key != "" {
+			d.shared[key] = reflect.ValueOf(v.Interface())
+		}
+		if err := d.decode(data, v.Elem(), path); err != nil {
+			return err
+		}
+		if a, ok := v.Interface().(*Assignment); ok {
+			return shareIndex(a, data, path)
+		}
+		return nil
+	case reflect.Struct:
+		object, ok := data.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an object", path)
+		}
+		if kind, hasKind := object["kind"]; hasKind && kind != v.Type().Name() {
+			return fmt.Errorf("%s: expected %s, found %v", path, v.Type().Name(), kind)
+		}
+		for i := 0; i < v.NumField(); i++ {
+			field := v.Type().Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			name := jsonName(field.Name)
+			if value, ok := object[name]; ok {
+				if err := d.decode(value, v.Field(i), path+"."+name); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	case reflect.Slice:
+		items, ok := data.([]interface{})
+		if !ok {
+			return fmt.Errorf("%s: expected an array", path)
+		}
+		v.Set(reflect.MakeSlice(v.Type(), len(items), len(items)))
+		for i, item := range items {
+			if err := d.decode(item, v.Index(i), path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.String:
+		text, ok := data.(string)
+		if !ok {
+			return fmt.Errorf("%s: expected a string", path)
+		}
+		v.SetString(text)
+		return nil
+	case reflect.Bool:
+		value, ok := data.(bool)
+		if !ok {
+			return fmt.Errorf("%s: expected true or false", path)
+		}
+		v.SetBool(value)
+		return nil
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		number, _ := data.(json.Number)
+		value, err := strconv.ParseInt(string(number), 10, 64)
+		if err != nil || v.OverflowInt(value) {
+			return fmt.Errorf("%s: expected an integer, found %v", path, data)
+		}
+		v.SetInt(value)
+		return nil
+	case reflect.Float64:
+		number, _ := data.(json.Number)
+		value, err := number.Float64()
+		if err != nil {
+			return fmt.Errorf("%s: expected a number, found %v", path, data)
+		}
+		v.SetFloat(value)
+		return nil
+	}
+	return fmt.Errorf("%s: cannot decode a %s", path, v.Type())
+}
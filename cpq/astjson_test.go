@@ -0,0 +1,77 @@
+package cpq
+
+import (
+	"strings"
+	"testing"
+)
+
+//every kind of node
+const everyNode = `n : const int = 3; c : enum { red, green }; p : struct { x : float; v[2] : int; };
+a[4] : int; i, j : int; b : bool; y : float;
+func f(k : int) : int { return k * 2; }
+{
+  input(i); b = i > 2 && !(i == 4) || false; y = static_cast(float)(i) / 2;
+  if (b) output(y); else output(-y);
+  while (i < 10) i = i + 1;
+  do { i--; if (i == 6) continue; else a[i % 4] += 1; } while (i > 5);
+  for (j = 0; j < n; j++) { a[j] = f(j) + 'a'; p.v[j % 2] = j; }
+  switch (i) { case 1..2, red: output(1); break; case green: output(2); fallthrough; default: output(3); break; }
+  c = green; i = b ? 1 : 2; p.x = y; output("done");
+}
+`
+
+func TestASTRoundTrip(t *testing.T) {
+	program, errors := Parse(everyNode)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	data, err := MarshalAST(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, kind := range []string{`"kind": "Conditional"`, `"kind": "Cast"`, `"kind": "Element"`, `"operator": "%"`, `"type": "float"`} {
+		if !strings.Contains(string(data), kind) {
+			t.Errorf("the JSON has no %s", kind)
+		}
+	}
+	read, err := UnmarshalAST(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := MarshalAST(read)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(again) != string(data) {
+		t.Errorf("the JSON of the read tree is not the JSON it was read from")
+	}
+	//the element of a[i % 4] += 1 shares the index of the assignment, which is computed once
+	if want, got := codegenText(t, everyNode, Options{}), programCode(t, read); got != want {
+		t.Errorf("the code of the read tree:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+//the QUAD of a syntax tree, without the labels resolved
+func programCode(t *testing.T, program *Program) string {
+	t.Helper()
+	code, errors, _ := CodegenInstructions(program, Options{})
+	if len(errors) > 0 {
+		t.Fatalf("errors: %v", errors)
+	}
+	return FormatInstructions(code, nil)
+}
+
+func TestUnmarshalASTErrors(t *testing.T) {
+	for _, test := range []struct{ data, want string }{
+		{`[1]`, "program: expected an object"},
+		{`{"kind": "Block"}`, "program: expected Program, found Block"},
+		{`{"kind": "Program", "statementsBlock": {"kind": "Block", "statements": [{"kind": "Nothing"}]}}`, `program.statementsBlock.statements[0]: "Nothing" is not a kind of Statement`},
+		{`{"kind": "Program", "statementsBlock": {"kind": "Block", "statements": [{"kind": "Output", "value": {"kind": "Block"}}]}}`, `program.statementsBlock.statements[0].value: "Block" is not a kind of NodeExpression`},
+		{`{"kind": "Program", "statementsBlock": {"kind": "Block", "statements": [{"kind": "Output", "value": {"kind": "Arithmetic", "operator": "^"}}]}}`, "program.statementsBlock.statements[0].value.operator: unknown operator ^"},
+		{`{"kind": "Program", "statementsBlock": {"kind": "Block", "statements": [{"kind": "Assignment", "variable": "a", "compound": true, "val": {"kind": "IntNum", "value": 1}}]}}`, "program.statementsBlock.statements[0]: a compound assignment needs an element of a on the left of its value"},
+	} {
+		if _, err := UnmarshalAST([]byte(test.data)); err == nil || err.Error() != test.want {
+			t.Errorf("%s: error %v, want %s", test.data, err, test.want)
+		}
+	}
+}
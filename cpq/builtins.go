@@ -0,0 +1,141 @@
+package cpq
+
+//number of arguments of every builtin function. QUAD has no math instructions, so
+//every call is expanded inline into a loop; a function of the program with the same
+//name is called instead.
+var builtins = map[string]int{
+	"sqrt": 1,
+	"pow":  2,
+}
+
+//generates a call of a builtin function
+func (c *CodeGen) codegenBuiltin(node *Call) *Expression {
+	if c.Std == StdCPL || len(node.Args) != builtins[node.Function] {
+		c.fail()
+		return nil
+	}
+	args := make([]*Expression, len(node.Args))
+	for i, arg := range node.Args {
+		if args[i] = c.CodegenExpression(arg); args[i] == nil {
+			return nil
+		}
+		if args[i].Type == Bool {
+			c.fail()
+			return nil
+		}
+	}
+	if node.Function == "sqrt" {
+		return c.codegenSqrt(c.codegenCastExpression(args[0], Float))
+	}
+	if args[1].Type != Integer {
+		c.fail()
+		return nil
+	}
+	return c.codegenPow(args[0], args[1])
+}
+
+//generates the Newton iteration g = (g + x / g) / 2 from a guess above the root, which
+//stops when g no longer decreases; sqrt of a value <= 0 is 0. Same as newtonSqrt.
+func (c *CodeGen) codegenSqrt(x *Expression) *Expression {
+	result := &Expression{Code: c.getTemp(), Type: Float}
+	next, test := c.getTemp(), c.getTemp()
+	loopLabel := c.getNewLabel()
+	zeroLabel := c.getNewLabel()
+	doneLabel := c.getNewLabel()
+	c.emit("RGRT", test, x.Code, "0.0")
+	c.emit("JMPZ", zeroLabel, test)
+	c.emit("RASN", result.Code, "1.0")
+	c.emit("RGRT", test, x.Code, "1.0")
+	c.emit("JMPZ", loopLabel, test)
+	c.emit("RASN", result.Code, x.Code)
+	c.emitLabel(loopLabel)
+	c.emit("RDIV", next, x.Code, result.Code)
+	c.emit("RADD", next, next, result.Code)
+	c.emit("RDIV", next, next, "2.0")
+	c.emit("RLSS", test, next, result.Code)
+	c.emit("JMPZ", doneLabel, test)
+	c.emit("RASN", result.Code, next)
+	c.emit("JUMP", loopLabel)
+	c.emitLabel(zeroLabel)
+	c.emit("RASN", result.Code, "0.0")
+	c.emitLabel(doneLabel)
+	return result
+}
+
+//generates x to the power of the int n by squaring, with 1 / x^-n for a negative n.
+//Same as power.
+func (c *CodeGen) codegenPow(x, n *Expression) *Expression {
+	prefix := opcodePrefix(x.Type)
+	one := "1"
+	if x.Type == Float {
+		one = "1.0"
+	}
+	result := &Expression{Code: c.getTemp(), Type: x.Type}
+	base, exponent, half, test := c.getTemp(), c.getTemp(), c.getTemp(), c.getTemp()
+	loopLabel := c.getNewLabel()
+	evenLabel := c.getNewLabel()
+	doneLabel := c.getNewLabel()
+	positiveLabel := c.getNewLabel()
+	c.emit(prefix+"ASN", result.Code, one)
+	c.emit(prefix+"ASN", base, x.Code)
+	c.emit("IASN", exponent, n.Code)
+	c.emit("ILSS", test, exponent, "0")
+	c.emit("JMPZ", loopLabel, test)
+	c.emit("ISUB", exponent, "0", exponent)
+	c.emitLabel(loopLabel)
+	c.emit("IGRT", test, exponent, "0")
+	c.emit("JMPZ", doneLabel, test)
+	c.emit("IDIV", half, exponent, "2")
+	c.emit("IMLT", test, half, "2")
+	c.emit("INQL", test, exponent, test)
+	c.emit("JMPZ", evenLabel, test)
+	c.emit(prefix+"MLT", result.Code, result.Code, base)
+	c.emitLabel(evenLabel)
+	c.emit(prefix+"MLT", base, base, base)
+	c.emit("IASN", exponent, half)
+	c.emit("JUMP", loopLabel)
+	c.emitLabel(doneLabel)
+	c.emit("ILSS", test, n.Code, "0")
+	c.emit("JMPZ", positiveLabel, test)
+	c.emit(prefix+"DIV", result.Code, one, result.Code)
+	c.emitLabel(positiveLabel)
+	return result
+}
+
+//the square root computed as codegenSqrt does, so that both give the same digits
+func newtonSqrt(x float64) float64 {
+	if !(x > 0) {
+		return 0
+	}
+	g := 1.0
+	if x > 1 {
+		g = x
+	}
+	for {
+		next := (x/g + g) / 2
+		if !(next < g) {
+			return g
+		}
+		g = next
+	}
+}
+
+//x to the power of n computed as codegenPow does
+func power(x value, n int64) (value, error) {
+	one := value{Type: x.Type, Int: 1, Float: 1}
+	result, base, exponent := one, x, n
+	if exponent < 0 {
+		exponent = -exponent
+	}
+	for exponent > 0 {
+		if exponent%2 != 0 {
+			result, _ = arithmetic(Multiply, result, base)
+		}
+		base, _ = arithmetic(Multiply, base, base)
+		exponent /= 2
+	}
+	if n < 0 {
+		return arithmetic(Divide, one, result)
+	}
+	return result, nil
+}
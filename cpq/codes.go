@@ -0,0 +1,98 @@
+package cpq
+
+//stable codes of the errors and warnings, for test suites and tools that check which
+//error was reported without matching its text. Every error gets its code where it is
+//created, and a code keeps its meaning when the text changes; new messages get new codes.
+const (
+	//semantic errors
+	CodeUndefinedVariable    = "CPQ0001" // undefined variable %s
+	CodeVariableDefined      = "CPQ0002" // variable %s already defined
+	CodeNameDefined          = "CPQ0003" // %s already defined
+	CodeParameterDefined     = "CPQ0004" // parameter %s already defined
+	CodeUndefinedFunction    = "CPQ0005" // undefined function %s
+	CodeConstantArray        = "CPQ0006" // constant %s cannot be an array
+	CodeConstantType         = "CPQ0007" // cannot initialize %s constant %s with a %s value
+	CodeMissingIndex         = "CPQ0008" // array %s needs an index
+	CodeNotArray             = "CPQ0009" // %s is not an array
+	CodeIndexRange           = "CPQ0010" // index %d is out of range of %s[%d]
+	CodeIndexType            = "CPQ0011" // array index must be an integer
+	CodeAssignType           = "CPQ0012" // cannot assign %s value to %s variable %s
+	CodeAssignConstant       = "CPQ0013" // cannot assign to constant %s
+	CodeInputConstant        = "CPQ0014" // cannot input into constant %s
+	CodeInputBool            = "CPQ0015" // cannot input into bool variable %s
+	CodeRangeBounds          = "CPQ0016" // range of int variable %s must have int bounds
+	CodeSwitchType           = "CPQ0017" // switch expression must be an integer
+	CodeEmptyCaseRange       = "CPQ0018" // case range %d..%d is empty
+	CodeBreakOutside         = "CPQ0019" // break statement must be inside a loop or a switch case
+	CodeContinueOutside      = "CPQ0020" // continue statement must be inside a loop
+	CodeFallthroughOutside   = "CPQ0021" // fallthrough statement must be the last statement of a switch case
+	CodeReturnOutside        = "CPQ0022" // return statement must be inside a function
+	CodeReturnNoValue        = "CPQ0023" // function %s must return a value
+	CodeProcedureReturnValue = "CPQ0024" // procedure %s cannot return a value
+	CodeReturnType           = "CPQ0025" // cannot return %s value from %s function %s
+	CodeProcedureValue       = "CPQ0026" // procedure %s has no value
+	CodeArgumentCount        = "CPQ0027" // %s takes %d arguments, found %d
+	CodeArgumentType         = "CPQ0028" // cannot pass %s value to %s parameter %s of %s
+	CodeRecursion            = "CPQ0029" // recursive call to %s is not supported
+	CodeStringValue          = "CPQ0030" // a string can only be written by output
+	CodeBoolArithmetic       = "CPQ0031" // cannot use bool values in arithmetic
+	CodeModuloType           = "CPQ0032" // operator % needs int operands
+	CodeDivisionByZero       = "CPQ0033" // division by zero
+	CodeBoolCast             = "CPQ0034" // static_cast cannot convert bool values
+	CodeConditionalTypes     = "CPQ0035" // the values of ?: have different types %s and %s
+	CodeConditionType        = "CPQ0036" // condition must be a comparison or a bool value
+	CodeCompareTypes         = "CPQ0037" // cannot compare %s value with %s value
+	CodeBoolOrder            = "CPQ0038" // bool values can only be compared with == and !=
+	CodeBuiltinBool          = "CPQ0039" // cannot pass bool value to %s
+	CodePowExponent          = "CPQ0040" // the exponent of pow must be an int
+	CodeMissingReturn        = "CPQ0041" // missing return at the end of function %s
+	CodeNameClash            = "CPQ0042" // %s and %s are both the QUAD variable %s
+
+	//syntax errors
+	CodeSyntax                    = "CPQ0100" // found %s, expected %s
+	CodeExtension                 = "CPQ0101" // %s is not part of standard CPL
+	CodeFieldType                 = "CPQ0102" // a field must be an int, float or bool variable
+	CodeArrayOfStructsField       = "CPQ0103" // field %s of the array of structs %s cannot be an array
+	CodeArraySize                 = "CPQ0104" // array size %s must be a positive int
+	CodeAssignTarget              = "CPQ0105" // only a variable can be assigned
+	CodeNotNumber                 = "CPQ0106" // %s is not a number
+	CodeNotInt                    = "CPQ0107" // %s is not an int
+	CodeNotEnumValue              = "CPQ0108" // %s is not an enum value or an int constant
+	CodeStringEscape              = "CPQ0109" // invalid escape sequence in string %s
+	CodeCharLiteral               = "CPQ0110" // %s is not a single character
+	CodeNotStruct                 = "CPQ0111" // %s is not a struct
+	CodeNoField                   = "CPQ0112" // %s has no field %s
+	CodeArrayOfStructsArray       = "CPQ0113" // an array of structs has no array fields
+	CodeUnterminatedComment       = "CPQ0114" // unterminated comment
+	CodeMalformedNumber           = "CPQ0115" // malformed number %s
+	CodeNonASCIIIdentifier        = "CPQ0116" // non-ASCII identifier %s
+	CodeReservedWord              = "CPQ0117" // cannot use reserved word '%s' as identifier
+	CodeInputExpression           = "CPQ0118" // input needs a variable, not an expression
+	CodeDeclarationAfterStatement = "CPQ0119" // a declaration must come before the statements
+
+	//limits of the input, the output and the target interpreter
+	CodeInputTooLarge       = "CPQ0200" // input too large: %s
+	CodeProgramTemps        = "CPQ0201" // program needs more than %d temporaries
+	CodeSpillScratch        = "CPQ0202" // spilling temporaries needs at least %d of them, the limit is %d
+	CodeProfileInstructions = "CPQ0203" // program has %d instructions, the %s profile allows %d; %s
+	CodeProfileOpcode       = "CPQ0204" // line %d: the %s profile does not support %s
+	CodeProfileInteger      = "CPQ0205" // line %d: integer constant %s does not fit in the %d bits of the %s profile
+	CodeProfileVariables    = "CPQ0206" // program uses %d variables and temporaries, the %s profile allows %d; %s
+	CodeTempFileCreate      = "CPQ0207" // cannot create temporary file: %s
+	CodeTempFileWrite       = "CPQ0208" // cannot write temporary file: %s
+	CodeOutputWrite         = "CPQ0209" // cannot write output: %s
+	CodeInternal            = "CPQ0210" // a failure of the compiler itself, such as an unresolved label
+
+	//warnings
+	CodeWarnPromotion      = "CPQ1001" // int operand converted to float in float arithmetic
+	CodeWarnTruncation     = "CPQ1002" // static_cast(int) drops the fraction of %s
+	CodeWarnFloatEqual     = "CPQ1003" // comparing float values for exact equality; consider --float-epsilon
+	CodeWarnEnumAssign     = "CPQ1004" // assigning a value that is not of its enum to %s
+	CodeWarnEnumIntCompare = "CPQ1005" // comparing an enum value with an int value
+	CodeWarnEnumCompare    = "CPQ1006" // comparing values of the enums of %s and %s
+	CodeWarnUnreachable    = "CPQ1007" // unreachable code
+	CodeWarnUncalled       = "CPQ1008" // function %s is never called
+	CodeWarnUnused         = "CPQ1009" // %s %s is never read
+	CodeWarnDeadStore      = "CPQ1010" // value assigned to %s is never read
+	CodeWarnUninitialized  = "CPQ1011" // %s may be read before it is assigned
+)
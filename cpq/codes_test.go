@@ -0,0 +1,76 @@
+package cpq
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+//every error is created with its code, including the messages that also fit the
+//format of another code
+func TestErrorCodes(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		code string
+	}{
+		{"syntax", "a : int;\n{ a = ; }\n", CodeSyntax},
+		{"undefined variable", "a : int;\n{ b = 1; }\n", CodeUndefinedVariable},
+		{"variable defined twice", "a : int; a : int;\n{ a = 1; }\n", CodeVariableDefined},
+		{"function defined twice", "a : int;\nfunc a() { output(1); }\n{ a = 1; }\n", CodeNameDefined},
+		{"parameter defined twice", "a : int;\nfunc f(p : int, p : int) { output(p); }\n{ f(1, 2); }\n", CodeParameterDefined},
+		{"missing return", "a : int;\nfunc f(p : int) : int { output(p); }\n{ a = f(1); }\n", CodeMissingReturn},
+		{"name clash", "p : struct { u : int; };\nfunc p(u : int) { output(u); }\n{ p(1); }\n", CodeNameClash},
+		{"reserved word", "int : int;\n{ output(1); }\n", CodeReservedWord},
+		{"unterminated comment", "a : int; /* open\n{ a = 1; }\n", CodeUnterminatedComment},
+		{"dead store", "a : int;\n{ a = 1; a = 2; output(a); }\n", CodeWarnDeadStore},
+		{"unused variable", "a, u : int;\n{ a = 1; output(a); }\n", CodeWarnUnused},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result, _ := Compile(test.src, Options{})
+			found := false
+			for _, e := range append(result.Errors, result.Warnings...) {
+				if e.Code == "" {
+					t.Errorf("%q has no code", e.Error())
+				}
+				if e.Code == test.code {
+					found = true
+				}
+			}
+			if !found {
+				t.Errorf("no %s in %v %v", test.code, result.Errors, result.Warnings)
+			}
+		})
+	}
+}
+
+//a writer that fails after accepting a number of bytes
+type failingWriter struct {
+	left int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if len(p) > w.left {
+		n := w.left
+		w.left = 0
+		return n, errors.New("disk full")
+	}
+	w.left -= len(p)
+	return len(p), nil
+}
+
+func TestCompileStreamWriteError(t *testing.T) {
+	src := "a : int;\n{ input(a); while (a < 10) a = a + 1; output(a); }\n"
+	for _, left := range []int{0, 10} {
+		errors, _ := CompileStream(strings.NewReader(src), &failingWriter{left: left}, Options{})
+		if len(errors) != 1 || errors[0].Code != CodeOutputWrite || errors[0].Text() != "cannot write output: disk full" {
+			t.Errorf("writer failing after %d bytes: errors = %v, want cannot write output", left, errors)
+		}
+	}
+	var out bytes.Buffer
+	if errors, _ := CompileStream(strings.NewReader(src), &out, Options{}); len(errors) > 0 || out.Len() == 0 {
+		t.Errorf("errors = %v, output %q", errors, out.String())
+	}
+}
@@ -0,0 +1,54 @@
+package cpq
+
+import "fmt"
+
+//everything a compilation by Compile produces
+type Result struct {
+	Program      *Program      // the syntax tree, with the types found by the analysis
+	Symbols      *SymbolTable  // the declared names and their uses
+	Instructions []Instruction // labeled, with the standard opcodes; nil when there are errors
+	Quad         string        // the QUAD program with opts.Opcodes, "" when there are errors
+	Errors       []ErrorType   // of every phase, ordered by position, with their End
+	Warnings     []ErrorType
+	Stats        *Stats // of every phase, when opts.Stats records them
+}
+
+// Compile runs every phase of the compiler on source: scanning and parsing, the
+// analysis, code generation and label resolution. The Result has the products of every
+// phase that ran, so tools need not call Parse, AnalyzeSymbols and CodegenInstructions
+// themselves. The error is not nil when the program has errors, which are in
+// Result.Errors; the signature line is left to the caller.
+func Compile(source string, opts Options) (*Result, error) {
+	result := &Result{Stats: opts.Stats}
+	program, errors := ParseWithOptions(source, opts)
+	result.Program = program
+	result.Errors = append(result.Errors, errors...)
+	if !opts.Diagnostics.Full() {
+		var analysis []ErrorType
+		opts.Stats.Measure("check", func() { result.Symbols, analysis = AnalyzeSymbols(program, opts) })
+		code, errors, warnings := codegenAnalyzed(program, analysis, opts)
+		result.Errors = append(result.Errors, errors...)
+		result.Warnings = warnings
+		if len(result.Errors) == 0 {
+			result.Instructions = code
+		}
+	}
+	if len(result.Errors) == 0 {
+		var err error
+		opts.Stats.Measure("emit", func() {
+			var resolved []Instruction
+			if resolved, err = ResolveLabels(result.Instructions); err == nil {
+				result.Quad = FormatInstructions(resolved, opts.Opcodes)
+			}
+		})
+		if err != nil {
+			return result, err
+		}
+		SetErrorEnds(source, result.Warnings)
+		return result, nil
+	}
+	SetErrorEnds(source, result.Errors)
+	SetErrorEnds(source, result.Warnings)
+	SortErrors(result.Errors)
+	return result, fmt.Errorf("%d errors, first: %s", len(result.Errors), result.Errors[0].Error())
+}
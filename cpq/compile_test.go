@@ -0,0 +1,138 @@
+package cpq
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files of TestGolden with the current output")
+
+//options of the golden files, by the suffix of their name; the second set goes through
+//the map-ordered parts of the generator: the binary search of the cases, the spilling
+//of temporaries and the float comparisons
+var goldenOptions = map[string]Options{
+	"":         {},
+	".options": {SwitchSearch: true, MaxTemps: 3, TempPolicy: TempsSpill, FloatEpsilon: 1e-9},
+}
+
+//compiling the same program again and again gives the same QUAD, byte for byte, which
+//is the one in its golden file; go test ./cpq -run Golden -update rewrites the files
+func TestGolden(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "golden", "*.ou"))
+	if err != nil || len(sources) == 0 {
+		t.Fatalf("no golden programs: %v", err)
+	}
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for suffix, opts := range goldenOptions {
+			golden := strings.TrimSuffix(source, ".ou") + suffix + ".qud"
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				result, err := Compile(string(src), opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for n := 0; n < 20; n++ {
+					again, _ := Compile(string(src), opts)
+					if again.Quad != result.Quad {
+						t.Fatalf("compilation %d differs:\n%s\nfirst was\n%s", n+2, again.Quad, result.Quad)
+					}
+				}
+				if *update {
+					if err := os.WriteFile(golden, []byte(result.Quad), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Quad != string(want) {
+					t.Errorf("output differs from %s:\n%s", golden, result.Quad)
+				}
+			})
+		}
+	}
+}
+
+//every phase is recorded once, in order, and the scan is the one the parser uses
+func TestCompileStats(t *testing.T) {
+	src := generateStressProgram(stressConfig{Statements: 500, Switches: 5})
+	opts := Options{Stats: &Stats{}}
+	result, err := Compile(src, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	phases := []string{}
+	for _, phase := range result.Stats.Phases {
+		phases = append(phases, phase.Phase)
+		if phase.Duration <= 0 {
+			t.Errorf("phase %s took %s", phase.Phase, phase.Duration)
+		}
+	}
+	if strings.Join(phases, " ") != "scan parse check codegen optimize emit" {
+		t.Errorf("phases = %v", phases)
+	}
+	plain, _ := Compile(src, Options{})
+	if plain.Stats != nil || plain.Quad != result.Quad {
+		t.Error("recording the stats changes the compilation")
+	}
+}
+
+//the parse of scanned tokens finds the same errors, the token limit included
+func TestParseWithStatsErrors(t *testing.T) {
+	sources := []string{
+		"a : int;\n{ a = ; b = 1 }\n",
+		"a : int; /* open\n{ a = 1; }\n",
+		"a : int;\n{ a = 1; // a comment\n output(a); }\n",
+		"a, b : int;\n{ a = 1; b = a + 2; output(b); }\n",
+	}
+	for _, src := range sources {
+		for _, opts := range []Options{{}, {Std: StdCPL}, {Limits: Limits{MaxTokens: 7}}} {
+			_, want := ParseWithOptions(src, opts)
+			opts.Stats = &Stats{}
+			_, got := ParseWithOptions(src, opts)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("%q: errors with stats = %v, want %v", src, got, want)
+			}
+		}
+	}
+}
+
+//the line terminators of the source, which differ between platforms, do not change the
+//output: a golden program written with CRLF compiles to its golden file
+func TestGoldenCRLF(t *testing.T) {
+	sources, err := filepath.Glob(filepath.Join("testdata", "golden", "*.ou"))
+	if err != nil || len(sources) == 0 {
+		t.Fatalf("no golden programs: %v", err)
+	}
+	for _, source := range sources {
+		src, err := os.ReadFile(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crlf := strings.ReplaceAll(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n", "\r\n")
+		for suffix, opts := range goldenOptions {
+			golden := strings.TrimSuffix(source, ".ou") + suffix + ".qud"
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				result, err := Compile(crlf, opts)
+				if err != nil {
+					t.Fatal(err)
+				}
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if result.Quad != string(want) {
+					t.Errorf("the CRLF source compiles to:\n%s", result.Quad)
+				}
+			})
+		}
+	}
+}
@@ -2,22 +2,66 @@ package cpq
 
 import (
 	"bufio"
-	"bytes"
 	"fmt"
 	"io"
+	"sort"
 	"strconv"
-	"strings"
 )
 
 type CodeGen struct {
 	Errors         []ErrorType
+	Warnings       []ErrorType
+	Std            Standard
+	FloatEpsilon   float64           // compare floats for equality within this distance, 0 for exact
+	HaltOnBadInput bool              // halt instead of reading again when input is out of range
+	SwitchBreak    bool              // cases end with a jump to the end of the switch, unless they end with fallthrough
+	SwitchSearch   bool              // find the case with a binary search of the case values instead of testing them in order
+	StringOpcode   string            // prints a quoted string, "" for IPRT of every character
+	MaxTemps       int               // limit on temporary names, 0 for no limit
+	Opcodes        map[string]string // spelling of opcodes in the target dialect
+	TempPolicy     TempPolicy
+	Severities     map[WarningKind]Severity // how every kind of warning is reported, SeverityWarning when missing
+	Werror         bool                     // report the warnings as errors
+	Diagnostics    *Diagnostics             // shared with the other phases, nil for no limit
+	Naming         CodegenOptions           // prefixes and first numbers of the temporaries and labels
+	writer         io.Writer                // given to NewCodeGenerator, closed by Close
 	output         *bufio.Writer
+	code           []Instruction // instructions not written to output yet
 	Variables      map[string]DataType
 	temporaryIndex int
 	labelIndex     int
 	breakStack     []string
+	continueStack  []string // where continue jumps in every enclosing loop; switches are skipped
+	reported       map[reportedError]bool
+	failures       int
+	lowering       bool
+	statementPos   Position
+	statementStart bool                         // the next instruction is the first one of the statement at statementPos
+	declared       map[string]*declaredVariable // variables by QUAD name, for the analyses
+	declaredOrder  []string
+	functions      map[string]*functionInfo
+	functionOrder  []*functionInfo
+	function       *functionInfo             // function being generated, nil in the main block
+	locals         map[string]DataType       // parameters and local variables of function
+	arrays         map[string]int64          // elements of every array, by QUAD name
+	constants      map[string]*Expression    // values of constants, by QUAD name
+	enums          map[string]*Enum          // enum of variables and enum values, by QUAD name
+	indexes        map[NodeExpression]string // temporaries holding indexes computed once, see codegenAssignment
 }
 
+//a declared function with the labels of its calling convention
+type functionInfo struct {
+	*Function
+	entry   string
+	exit    string   // where return jumps to, followed by the dispatch to the callers
+	returns []string // label after every call, the return address n is returns[n-1]
+	calls   []*Call  // calls in the body, to find recursion
+}
+
+//line emitted in place of a simple statement with semantic errors, so that listings
+//and source maps of erroneous programs stay aligned with the statements
+const ErrorPlaceholder = "# error"
+
 type Expression struct {
 	Code string
 	Type DataType
@@ -27,44 +71,367 @@ type Expression struct {
 func NewCodeGenerator(output io.Writer) *CodeGen {
 	return &CodeGen{
 		Errors:         []ErrorType{},
-		output:         bufio.NewWriterSize(output, 1),
+		writer:         output,
+		output:         bufio.NewWriter(output),
 		Variables:      map[string]DataType{},
 		temporaryIndex: 0,
 		labelIndex:     0,
 		breakStack:     []string{},
+		continueStack:  []string{},
+		reported:       map[reportedError]bool{},
+		functions:      map[string]*functionInfo{},
+		arrays:         map[string]int64{},
+		constants:      map[string]*Expression{},
+		enums:          map[string]*Enum{},
 	}
 }
 
 //generates code to output
 func Codegen(program *Program) (string, []ErrorType) {
-	buf := new(bytes.Buffer)
+	output, errors, _ := CodegenWithOptions(program, Options{})
+	return output, errors
+}
+
+//generates code with the options of the compilation, returning the output, errors and warnings
+func CodegenWithOptions(program *Program, opts Options) (string, []ErrorType, []ErrorType) {
+	code, errors, warnings := CodegenInstructions(program, opts)
+	return FormatInstructions(code, opts.Opcodes), errors, warnings
+}
+
+// CodegenInstructions generates code like CodegenWithOptions, returning the labeled
+// instructions instead of their text, for programs that inspect or rewrite them.
+// The opcodes are the standard ones whatever opts.Opcodes is.
+func CodegenInstructions(program *Program, opts Options) ([]Instruction, []ErrorType, []ErrorType) {
+	var analysis []ErrorType
+	opts.Stats.Measure("check", func() { analysis = AnalyzeWithOptions(program, opts) })
+	return codegenAnalyzed(program, analysis, opts)
+}
 
-	c := NewCodeGenerator(buf)
-	c.CodegenProgram(program)
+//generates the code of a program whose analysis found the errors analysis
+func codegenAnalyzed(program *Program, analysis []ErrorType, opts Options) ([]Instruction, []ErrorType, []ErrorType) {
+	c := newCodegen(nil, analysis, opts)
+	if c.Diagnostics.Full() {
+		return nil, c.Errors, c.Warnings
+	}
+	opts.Stats.Measure("codegen", func() { c.CodegenProgram(program) })
+	if len(c.Errors) == 0 {
+		opts.Stats.Measure("optimize", func() {
+			unused := c.checkUnusedVariables()
+			c.eliminateDeadCode()
+			c.checkDeadStores(unused)
+			c.checkUninitialized()
+			c.threadJumps()
+			c.peephole()
+			c.allocateTemps()
+			c.nameLabels()
+		})
+	}
+	return c.code, c.Errors, c.Warnings
+}
+
+//returns a code generator to output with the options of the compilation, holding the
+//errors the analysis found
+func newCodegen(output io.Writer, analysis []ErrorType, opts Options) *CodeGen {
+	c := NewCodeGenerator(output)
+	c.Std = opts.Std
+	c.FloatEpsilon = opts.FloatEpsilon
+	c.HaltOnBadInput = opts.HaltOnBadInput
+	c.SwitchBreak = opts.SwitchBreak
+	c.SwitchSearch = opts.SwitchSearch
+	c.StringOpcode = opts.StringOpcode
+	c.MaxTemps = opts.MaxTemps
+	c.TempPolicy = opts.TempPolicy
+	c.Severities = opts.Severities
+	c.Werror = opts.Werror
+	c.Diagnostics = opts.Diagnostics
+	c.Naming = opts.Codegen
+	c.Errors = append(c.Errors, analysis...)
+	return c
+}
 
-	return buf.String(), c.Errors
+//records that a construct cannot be generated. The analysis reports why, so the
+//generator only skips the construct and replaces its statement by ErrorPlaceholder.
+func (c *CodeGen) fail() {
+	c.failures++
+}
+
+type reportedError struct {
+	message string
+	pos     Position
+}
+
+//records an error found while generating, once per message and position
+func (c *CodeGen) addError(e ErrorType) {
+	c.failures++
+	key := reportedError{message: e.Text(), pos: e.Pos}
+	if c.reported[key] {
+		return
+	}
+	c.reported[key] = true
+	if c.Diagnostics.Add(e) {
+		c.Errors = append(c.Errors, e)
+	}
+}
+
+//writes the generated instructions and any buffered output to the underlying writer.
+//Returns the first error the writer reported, including errors of earlier writes.
+func (c *CodeGen) Flush() error {
+	c.writeCode()
+	return c.output.Flush()
+}
+
+//flushes the generator and closes the underlying writer when it is an io.Closer.
+//Returns the first error of the writes, the flush or the close.
+func (c *CodeGen) Close() error {
+	err := c.Flush()
+	if closer, ok := c.writer.(io.Closer); ok {
+		if closeErr := closer.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	return err
 }
 
 //generates code for CPL
 func (c *CodeGen) CodegenProgram(node *Program) {
-	for _, declaration := range node.Declarations {
-		for _, name := range declaration.Names {
+	c.CodegenDeclarations(node.Declarations)
+	c.DeclareFunctions(node.Functions)
+	c.CodegenStatement(node.StatementsBlock)
+	c.closingBrace(node.StatementsBlock.End)
+	c.emit("HALT")
+	c.CodegenFunctions()
+}
+
+//adds declared variables to the symbol table
+func (c *CodeGen) CodegenDeclarations(declarations []Declaration) {
+	for _, declaration := range declarations {
+		for i, name := range declaration.Names {
 			if _, exists := c.Variables[name]; exists {
-				c.Errors = append(c.Errors, ErrorType{
-					Message: fmt.Sprintf("variable %s already defined", name),
-					Pos:     declaration.Pos,
-				})
+				c.fail()
 				continue
 			}
 			c.Variables[name] = declaration.Type
+			c.declareVariable(&declaration, i, name)
+			if !declaration.Const {
+				c.declare(name, c.declaredOf(&declaration, name, declaration.Size(i)))
+			}
 		}
 	}
-	c.CodegenStatement(node.StatementsBlock)
-	c.output.WriteString("HALT\n")
+}
+
+//records the size of the i-th name of a declaration if it is an array, or its value
+//if it is a constant; uses of a constant are replaced by the value
+func (c *CodeGen) declareVariable(declaration *Declaration, i int, name string) {
+	if declaration.Enum != nil {
+		c.enums[name] = declaration.Enum
+	}
+	size := declaration.Size(i)
+	if !declaration.Const {
+		if size > 0 {
+			c.arrays[name] = size
+		}
+		return
+	}
+	if size > 0 {
+		c.fail()
+		return
+	}
+	value := declaration.Value
+	if number, ok := value.(*IntNum); ok && declaration.Type == Float {
+		value = &FloatNum{Value: float64(number.Value), Position: number.Position}
+	}
+	exp := c.CodegenExpression(value)
+	if exp == nil || declaration.Type == Unknown {
+		return
+	}
+	if !assignable(declaration.Type, exp.Type) {
+		c.fail()
+		return
+	}
+	c.constants[name] = c.codegenCastExpression(exp, declaration.Type)
+}
+
+//adds functions to the symbol table, so that calls can be generated before their bodies
+func (c *CodeGen) DeclareFunctions(functions []*Function) {
+	for _, function := range functions {
+		_, isVariable := c.Variables[function.Name]
+		if _, exists := c.functions[function.Name]; exists || isVariable {
+			c.fail()
+			continue
+		}
+		info := &functionInfo{Function: function, entry: c.getNewLabel(), exit: c.getNewLabel()}
+		c.functions[function.Name] = info
+		c.functionOrder = append(c.functionOrder, info)
+	}
+}
+
+//generates the functions after the HALT of the main block.
+//QUAD has no stack and no indirect jump, so parameters, the return value and the return
+//address of a function are global variables, and a return jumps to a chain that compares
+//the return address with every call site. Recursive calls are therefore rejected.
+func (c *CodeGen) CodegenFunctions() {
+	if len(c.functionOrder) == 0 {
+		return
+	}
+	for _, info := range c.functionOrder {
+		c.codegenFunction(info)
+	}
+	c.function, c.locals = nil, nil
+	c.checkRecursion()
+	for _, info := range c.functionOrder {
+		c.closingBrace(info.Body.End)
+		c.emitLabel(info.exit)
+		temp := c.getTemp()
+		for n, label := range info.returns {
+			c.emit("INQL", temp, "_ra_"+info.Name, strconv.Itoa(n+1))
+			c.emit("JMPZ", label, temp)
+		}
+		c.emit("HALT")
+	}
+}
+
+//generates the body of a function, whose parameters and locals are named function_name
+func (c *CodeGen) codegenFunction(info *functionInfo) {
+	c.function = info
+	c.locals = map[string]DataType{}
+	for _, param := range info.Params {
+		if _, exists := c.locals[param.Name]; exists {
+			c.fail()
+			continue
+		}
+		c.locals[param.Name] = param.Type
+		c.declare(info.Name+"_"+param.Name, &declaredVariable{name: param.Name, kind: "parameter", pos: param.Pos, function: info})
+	}
+	for _, declaration := range info.Declarations {
+		for i, name := range declaration.Names {
+			if _, exists := c.locals[name]; exists {
+				c.fail()
+				continue
+			}
+			c.locals[name] = declaration.Type
+			c.declareVariable(&declaration, i, info.Name+"_"+name)
+			if !declaration.Const {
+				c.declare(info.Name+"_"+name, c.declaredOf(&declaration, name, declaration.Size(i)))
+			}
+		}
+	}
+	c.emitLabel(info.entry)
+	c.CodegenStatement(info.Body)
+	c.closingBrace(info.Body.End)
+	c.emit("JUMP", info.exit)
+}
+
+//reports calls that can reach the function they are in, which would overwrite the
+//parameters and return address of the active call
+func (c *CodeGen) checkRecursion() {
+	for _, info := range c.functionOrder {
+		visited := map[string]bool{}
+		var reaches func(name string) bool
+		reaches = func(name string) bool {
+			if name == info.Name {
+				return true
+			}
+			if visited[name] {
+				return false
+			}
+			visited[name] = true
+			for _, call := range c.functions[name].calls {
+				if reaches(call.Function) {
+					return true
+				}
+			}
+			return false
+		}
+		for _, call := range info.calls {
+			if reaches(call.Function) {
+				c.fail()
+			}
+		}
+	}
+}
+
+//returns the QUAD name and type of a variable: a parameter or local of the function
+//being generated, or a global variable
+func (c *CodeGen) variable(name string) (string, DataType, bool) {
+	if varType, ok := c.locals[name]; ok {
+		return c.function.Name + "_" + name, varType, true
+	}
+	varType, ok := c.Variables[name]
+	return name, varType, ok
+}
+
+//reports an array used without an index, or an index on a scalar
+func (c *CodeGen) checkIndex(variable, name string, index NodeExpression, pos Position) bool {
+	_, isArray := c.arrays[name]
+	if isArray && index == nil {
+		c.fail()
+		return false
+	}
+	if !isArray && index != nil {
+		c.fail()
+		return false
+	}
+	return true
+}
+
+//generates code that passes the QUAD name of the element array[index] to fn. The elements
+//are the variables name_0, name_1 and so on: a constant index names its element directly,
+//any other index is compared with every element number, as QUAD has no indirect addressing,
+//and an index out of range halts the program.
+func (c *CodeGen) codegenElement(array, name string, index NodeExpression, pos Position, fn func(element string)) bool {
+	size := c.arrays[name]
+	if number, ok := index.(*IntNum); ok {
+		if number.Value < 0 || number.Value >= size {
+			c.fail()
+			return false
+		}
+		fn(name + "_" + strconv.FormatInt(number.Value, 10))
+		return true
+	}
+	exp := &Expression{Code: c.indexes[index], Type: Integer}
+	if exp.Code == "" {
+		exp = c.CodegenExpression(index)
+	}
+	if exp == nil {
+		return false
+	}
+	if exp.Type != Integer {
+		c.fail()
+		return false
+	}
+	endLabel := c.getNewLabel()
+	found := c.getTemp()
+	for k := int64(0); k < size; k++ {
+		nextLabel := c.getNewLabel()
+		c.emit("IEQL", found, exp.Code, strconv.FormatInt(k, 10))
+		c.emit("JMPZ", nextLabel, found)
+		fn(name + "_" + strconv.FormatInt(k, 10))
+		c.emit("JUMP", endLabel)
+		c.emitLabel(nextLabel)
+	}
+	c.emit("HALT")
+	c.emitLabel(endLabel)
+	return true
 }
 
 //generates code for CPL
 func (c *CodeGen) CodegenStatement(node Statement) {
+	if pos, ok := statementPosition(node); ok {
+		c.statementPos = pos
+		if _, block := node.(*Block); !block {
+			c.statementStart = true
+		}
+	}
+	failures := c.failures
+	switch node.(type) {
+	case *Assignment, *Input, *Output, *Break, *Continue, *Fallthrough, *Call, *Return:
+		// keep one line for a statement that failed its checks
+		defer func() {
+			if c.failures > failures {
+				c.emit(ErrorPlaceholder)
+			}
+		}()
+	}
 	switch s := node.(type) {
 	case *Assignment:
 		c.CodegenAssignmentStatement(s)
@@ -76,10 +443,23 @@ func (c *CodeGen) CodegenStatement(node Statement) {
 		c.CodegenIfStatement(s)
 	case *WhileStatement:
 		c.CodegenWhileStatement(s)
+	case *ForStatement:
+		c.CodegenForStatement(s)
+	case *DoWhileStatement:
+		c.CodegenDoWhileStatement(s)
 	case *Switch:
 		c.CodegenSwitchStatement(s)
 	case *Break:
 		c.CodegenBreakStatement(s)
+	case *Continue:
+		c.CodegenContinueStatement(s)
+	case *Fallthrough:
+		// a fallthrough at the end of a case is removed by CodegenSwitchStatement
+		c.fail()
+	case *Call:
+		c.codegenCall(s, false)
+	case *Return:
+		c.CodegenReturnStatement(s)
 	case *Block:
 		c.CodegenStatementsBlock(s)
 	}
@@ -87,151 +467,398 @@ func (c *CodeGen) CodegenStatement(node Statement) {
 
 //generates code for assignment
 func (c *CodeGen) CodegenAssignmentStatement(node *Assignment) {
-	exp := c.CodegenExpression(node)
-	if _, exists := c.Variables[node.Variable]; !exists {
-		c.Errors = append(c.Errors, ErrorType{
-			Message: fmt.Sprintf("undefined variable %s", node.Variable),
-			Pos:     node.Pos,
-		})
-		return
+	c.codegenAssignment(node)
+}
+
+//generates an assignment and returns the value assigned, before its conversion to the
+//type of the variable; in a = b = 1 every variable gets 1
+func (c *CodeGen) codegenAssignment(node *Assignment) *Expression {
+	c.computeIndex(node)
+	defer delete(c.indexes, node.Index)
+	exp := c.CodegenExpression(node.Val)
+	name, varType, exists := c.variable(node.Variable)
+	if !exists {
+		c.fail()
+		return nil
 	}
-	if exp == nil {
-		return
+	if exp == nil || !c.checkIndex(node.Variable, name, node.Index, node.Pos) {
+		return nil
+	}
+	if _, isConstant := c.constants[name]; isConstant {
+		c.fail()
+		return nil
 	}
-	if node.CastType != Unknown && node.CastType != exp.Type {
-		exp = c.codegenCastExpression(exp, node.CastType)
+	if varType == Unknown {
+		return nil
+	}
+	if !assignable(varType, exp.Type) {
+		c.fail()
+		return nil
 	}
-	if c.Variables[node.Variable] == Integer && exp.Type == Float {
-		c.Errors = append(c.Errors, ErrorType{
-			Message: fmt.Sprintf("cannot assign float value to int variable %s", node.Variable),
+	value := exp
+	exp = c.codegenCastExpression(exp, varType)
+	if enum := c.enums[name]; enum != nil && c.enumOf(node.Val) != enum {
+		c.warn(WarnEnum, ErrorType{
+			Code:    CodeWarnEnumAssign,
+			Message: fmt.Sprintf("assigning a value that is not of its enum to %s", node.Variable),
 			Pos:     node.Pos,
 		})
+	}
+	op := opcodePrefix(varType) + "ASN"
+	if node.Index == nil {
+		c.emit(op, name, exp.Code)
+		return value
+	}
+	if !c.codegenElement(node.Variable, name, node.Index, node.Pos, func(element string) {
+		c.emit(op, element, exp.Code)
+	}) {
+		return nil
+	}
+	return value
+}
+
+//computes the index of a compound assignment, a[i()] += 1, into a temporary before its
+//value, so that the element is loaded and stored with the same index and i is called once
+func (c *CodeGen) computeIndex(node *Assignment) {
+	if _, literal := node.Index.(*IntNum); node.compoundElement() == nil || literal {
+		return
+	}
+	exp := c.CodegenExpression(node.Index)
+	if exp == nil || exp.Type != Integer {
 		return
 	}
-	if c.Variables[node.Variable] == Float && exp.Type == Integer {
-		exp = c.codegenCastExpression(exp, Float)
+	if !temporary(exp.Code) {
+		temp := c.getTemp()
+		c.emit("IASN", temp, exp.Code)
+		exp.Code = temp
 	}
-	if c.Variables[node.Variable] == Integer {
-		c.output.WriteString(fmt.Sprintf("IASN %s %s\n", node.Variable, exp.Code))
-	} else if c.Variables[node.Variable] == Float {
-		c.output.WriteString(fmt.Sprintf("RASN %s %s\n", node.Variable, exp.Code))
+	if c.indexes == nil {
+		c.indexes = map[NodeExpression]string{}
 	}
+	c.indexes[node.Index] = exp.Code
 }
 
 //generates code for input
 func (c *CodeGen) CodegenInputStatement(node *Input) {
-	if _, exists := c.Variables[node.Variable]; !exists {
-		c.Errors = append(c.Errors, ErrorType{
-			Message: fmt.Sprintf("undefined variable %s", node.Variable),
-			Pos:     node.Pos,
+	// input of no variable, a syntax error
+	if node.Variable == "" {
+		return
+	}
+	name, varType, exists := c.variable(node.Variable)
+	if !exists {
+		c.fail()
+		return
+	}
+	if !c.checkIndex(node.Variable, name, node.Index, node.Pos) || varType == Unknown {
+		return
+	}
+	if _, isConstant := c.constants[name]; isConstant {
+		c.fail()
+		return
+	}
+	if varType == Bool {
+		c.fail()
+		return
+	}
+	prefix := opcodePrefix(varType)
+	// an element is read into a temporary and then stored through the index
+	target := name
+	if node.Index != nil {
+		target = c.getTemp()
+	}
+	if node.Min != nil && node.Max != nil {
+		c.codegenRangeInput(node, target, varType)
+	} else {
+		c.emit(prefix+"INP", target)
+	}
+	if node.Index != nil {
+		c.codegenElement(node.Variable, name, node.Index, node.Pos, func(element string) {
+			c.emit(prefix+"ASN", element, target)
 		})
+	}
+}
+
+//generates input(x in min..max): the value is read again, or the program halts,
+//until it is inside the range
+func (c *CodeGen) codegenRangeInput(node *Input, name string, varType DataType) {
+	if varType == Unknown {
+		return
+	}
+	min, max := c.CodegenExpression(node.Min), c.CodegenExpression(node.Max)
+	if min == nil || max == nil {
 		return
 	}
-	if c.Variables[node.Variable] == Integer {
-		c.output.WriteString(fmt.Sprintf("IINP %s\n", node.Variable))
-	} else if c.Variables[node.Variable] == Float {
-		c.output.WriteString(fmt.Sprintf("RINP %s\n", node.Variable))
+	if varType == Integer && (min.Type == Float || max.Type == Float) {
+		c.fail()
+		return
 	}
+	min, max = c.codegenCastExpression(min, varType), c.codegenCastExpression(max, varType)
+	prefix := opcodePrefix(varType)
+	readLabel := c.getNewLabel()
+	doneLabel := c.getNewLabel()
+	below, above := c.getTemp(), c.getTemp()
+	c.emitLabel(readLabel)
+	c.emit(prefix+"INP", name)
+	c.emit(prefix+"LSS", below, name, min.Code)
+	c.emit(prefix+"GRT", above, name, max.Code)
+	c.emit("IADD", below, below, above)
+	c.emit("JMPZ", doneLabel, below)
+	if c.HaltOnBadInput {
+		c.emit("HALT")
+	} else {
+		c.emit("JUMP", readLabel)
+	}
+	c.emitLabel(doneLabel)
 }
 
 //generates code for output
 func (c *CodeGen) CodegenOutputStatement(node *Output) {
-	exp := c.CodegenExpression(node)
+	if str, ok := node.Value.(*StringLiteral); ok {
+		c.codegenOutputString(str)
+		return
+	}
+	exp := c.CodegenExpression(node.Value)
 	if exp == nil {
 		return
 	}
-	if exp.Type == Integer {
-		c.output.WriteString(fmt.Sprintf("IPRT %s\n", exp.Code))
-	} else if exp.Type == Float {
-		c.output.WriteString(fmt.Sprintf("RPRT %s\n", exp.Code))
+	c.emit(opcodePrefix(exp.Type)+"PRT", exp.Code)
+}
+
+//generates output of a string: QUAD has no strings, so every character is printed as
+//its code unless the target interpreter has a string instruction
+func (c *CodeGen) codegenOutputString(node *StringLiteral) {
+	if c.StringOpcode != "" {
+		c.emit(c.StringOpcode, strconv.Quote(node.Value))
+		return
+	}
+	for _, ch := range node.Value {
+		c.emit("IPRT", strconv.Itoa(int(ch)))
 	}
 }
 
 //generates code for 'if'
 func (c *CodeGen) CodegenIfStatement(node *IfStatement) {
-	condition := c.CodegenBooleanExpression(node.Condition)
 	endIfLabel := c.getNewLabel()
 	var elseLabel string
 	if node.ElseBranch != nil {
 		elseLabel = c.getNewLabel()
-		c.output.WriteString(fmt.Sprintf("JMPZ %s %s\n", elseLabel, condition))
+		c.codegenJump(node.Condition, elseLabel, false)
 	} else {
-		c.output.WriteString(fmt.Sprintf("JMPZ %s %s\n", endIfLabel, condition))
+		c.codegenJump(node.Condition, endIfLabel, false)
 	}
 	c.CodegenStatement(node.IfBranch)
 	if node.ElseBranch != nil {
-		c.output.WriteString(fmt.Sprintf("JUMP %s\n", endIfLabel))
-		c.output.WriteString(fmt.Sprintf("%s:\n", elseLabel))
+		c.emit("JUMP", endIfLabel)
+		c.emitLabel(elseLabel)
 		c.CodegenStatement(node.ElseBranch)
 	}
-	c.output.WriteString(fmt.Sprintf("%s:\n", endIfLabel))
+	c.emitLabel(endIfLabel)
 }
 
 //generates code for while
 func (c *CodeGen) CodegenWhileStatement(node *WhileStatement) {
+	c.codegenLoop(node.Condition, node.Body, nil)
+}
+
+//generates code for for, as a while loop whose body ends with the step
+func (c *CodeGen) CodegenForStatement(node *ForStatement) {
+	if node.Init != nil {
+		c.CodegenStatement(node.Init)
+	}
+	c.codegenLoop(node.Condition, node.Body, node.Step)
+}
+
+//generates code for do-while, testing the condition after the body
+func (c *CodeGen) CodegenDoWhileStatement(node *DoWhileStatement) {
+	bodyLabel := c.getNewLabel()
 	conditionLabel := c.getNewLabel()
 	endLoopLabel := c.getNewLabel()
-	c.output.WriteString(fmt.Sprintf("%s:\n", conditionLabel))
-	condition := c.CodegenBooleanExpression(node.Condition)
-	c.output.WriteString(fmt.Sprintf("JMPZ %s %s\n", endLoopLabel, condition))
-	c.breakStack = append(c.breakStack, endLoopLabel)
-	c.CodegenStatement(node.Body)
-	if c.breakStack[len(c.breakStack)-1] == endLoopLabel {
+	c.emitLabel(bodyLabel)
+	c.codegenLoopBody(node.Body, endLoopLabel, conditionLabel)
+	c.emitLabel(conditionLabel)
+	c.codegenJump(node.Condition, bodyLabel, true)
+	c.emitLabel(endLoopLabel)
+}
+
+//generates a loop testing the condition before every iteration, with an optional step
+//after the body
+func (c *CodeGen) codegenLoop(conditionNode Boolean, body, step Statement) {
+	conditionLabel := c.getNewLabel()
+	endLoopLabel := c.getNewLabel()
+	c.emitLabel(conditionLabel)
+	c.codegenJump(conditionNode, endLoopLabel, false)
+	if step == nil {
+		c.codegenLoopBody(body, endLoopLabel, conditionLabel)
+	} else {
+		stepLabel := c.getNewLabel()
+		c.codegenLoopBody(body, endLoopLabel, stepLabel)
+		c.emitLabel(stepLabel)
+		c.CodegenStatement(step)
+	}
+	c.emit("JUMP", conditionLabel)
+	c.emitLabel(endLoopLabel)
+}
+
+//generates the body of a loop, where break jumps to endLabel and continue to continueLabel
+func (c *CodeGen) codegenLoopBody(body Statement, endLabel, continueLabel string) {
+	c.breakStack = append(c.breakStack, endLabel)
+	c.continueStack = append(c.continueStack, continueLabel)
+	c.CodegenStatement(body)
+	if c.breakStack[len(c.breakStack)-1] == endLabel {
 		c.breakStack = c.breakStack[:len(c.breakStack)-1]
 	}
-	c.output.WriteString(fmt.Sprintf("JUMP %s\n", conditionLabel))
-	c.output.WriteString(fmt.Sprintf("%s:\n", endLoopLabel))
+	if c.continueStack[len(c.continueStack)-1] == continueLabel {
+		c.continueStack = c.continueStack[:len(c.continueStack)-1]
+	}
 }
 
 //generates code for switch
 func (c *CodeGen) CodegenSwitchStatement(node *Switch) {
-	exp := c.CodegenExpression(node)
+	exp := c.CodegenExpression(node.Expression)
 	if exp == nil {
 		return
 	}
 	if exp.Type != Integer {
-		c.Errors = append(c.Errors, ErrorType{
-			Message: "switch expression must be an integer",
-			Pos:     node.Position,
-		})
+		c.fail()
 	}
-	temp := c.getTemp()
-	caseLabels := map[int]string{}
+	caseLabels := make([]string, len(node.Cases))
+	var ranges []caseRange
 	for i, switchCase := range node.Cases {
 		caseLabels[i] = c.getNewLabel()
-		c.output.WriteString(fmt.Sprintf("INQL %s %s %d\n", temp, exp.Code, switchCase.Value))
-		c.output.WriteString(fmt.Sprintf("JMPZ %s %s\n", caseLabels[i], temp))
+		for _, label := range switchCase.Labels {
+			if label.Min > label.Max {
+				c.fail()
+				continue
+			}
+			ranges = append(ranges, caseRange{label.Min, label.Max, caseLabels[i]})
+		}
 	}
 	defaultLabel := c.getNewLabel()
 	endSwitchLabel := c.getNewLabel()
-	c.output.WriteString(fmt.Sprintf("JUMP %s\n", defaultLabel))
+	if sorted, ok := sortCaseRanges(ranges); c.SwitchSearch && ok && len(sorted) >= minSearchRanges {
+		c.codegenCaseSearch(exp.Code, c.getTemp(), sorted, defaultLabel)
+	} else {
+		c.codegenCaseChain(exp.Code, ranges)
+		c.emit("JUMP", defaultLabel)
+	}
 	c.breakStack = append(c.breakStack, endSwitchLabel)
 	for i, switchCase := range node.Cases {
-		c.output.WriteString(fmt.Sprintf("%s:\n", caseLabels[i]))
+		c.emitLabel(caseLabels[i])
+		statements, falls := caseStatements(switchCase.Statements)
 		c.CodegenStatement(&Block{
-			Statements: switchCase.Statements,
+			Statements: statements,
 		})
+		if c.SwitchBreak && !falls {
+			c.emit("JUMP", endSwitchLabel)
+		}
 	}
-	c.output.WriteString(fmt.Sprintf("%s:\n", defaultLabel))
+	c.emitLabel(defaultLabel)
 	c.CodegenStatement(&Block{
 		Statements: node.DefaultCase,
 	})
 	if c.breakStack[len(c.breakStack)-1] == endSwitchLabel {
 		c.breakStack = c.breakStack[:len(c.breakStack)-1]
 	}
-	c.output.WriteString(fmt.Sprintf("%s:\n", endSwitchLabel))
+	c.emitLabel(endSwitchLabel)
+}
+
+//values of a switch case label, and the label of the case
+type caseRange struct {
+	min, max int64
+	label    string
+}
+
+//fewest ranges of case values that --switch-search finds with a binary search
+const minSearchRanges = 4
+
+//tests the value against every case in order, jumping to the first that has it
+func (c *CodeGen) codegenCaseChain(value string, ranges []caseRange) {
+	temp := c.getTemp()
+	for _, r := range ranges {
+		min, max := strconv.FormatInt(r.min, 10), strconv.FormatInt(r.max, 10)
+		if r.min == r.max {
+			c.emit("INQL", temp, value, min)
+			c.emit("JMPZ", r.label, temp)
+			continue
+		}
+		// the value is outside the range if it is below min or above max
+		above := c.getTemp()
+		c.emit("ILSS", temp, value, min)
+		c.emit("IGRT", above, value, max)
+		c.emit("IADD", temp, temp, above)
+		c.emit("JMPZ", r.label, temp)
+	}
+}
+
+//returns the ranges sorted by value, with neighbouring ranges of the same case merged,
+//and false when two cases share a value, which only the chain, trying the cases in
+//order, handles
+func sortCaseRanges(ranges []caseRange) ([]caseRange, bool) {
+	sorted := append([]caseRange(nil), ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].min < sorted[j].min })
+	merged := sorted[:0]
+	for _, r := range sorted {
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if r.min <= last.max {
+				return nil, false
+			}
+			if r.label == last.label && r.min == last.max+1 {
+				last.max = r.max
+				continue
+			}
+		}
+		merged = append(merged, r)
+	}
+	return merged, true
+}
+
+//finds the case of the value with a binary search of the sorted ranges, so that a switch
+//of n ranges tests about 2 log n conditions instead of up to 2n. QUAD has no indirect
+//jump, so a jump table indexed by the value cannot be generated.
+func (c *CodeGen) codegenCaseSearch(value, temp string, ranges []caseRange, defaultLabel string) {
+	if len(ranges) == 0 {
+		c.emit("JUMP", defaultLabel)
+		return
+	}
+	mid := len(ranges) / 2
+	r := ranges[mid]
+	notBelow := c.getNewLabel()
+	c.emit("ILSS", temp, value, strconv.FormatInt(r.min, 10))
+	c.emit("JMPZ", notBelow, temp)
+	c.codegenCaseSearch(value, temp, ranges[:mid], defaultLabel)
+	c.emitLabel(notBelow)
+	c.emit("IGRT", temp, value, strconv.FormatInt(r.max, 10))
+	c.emit("JMPZ", r.label, temp)
+	c.codegenCaseSearch(value, temp, ranges[mid+1:], defaultLabel)
+}
+
+//returns the statements of a case without a final fallthrough, and whether it had one
+func caseStatements(statements []Statement) ([]Statement, bool) {
+	if n := len(statements); n > 0 {
+		if _, ok := statements[n-1].(*Fallthrough); ok {
+			return statements[:n-1], true
+		}
+	}
+	return statements, false
 }
 
 // generates code for break
 func (c *CodeGen) CodegenBreakStatement(node *Break) {
 	if len(c.breakStack) == 0 {
-		c.Errors = append(c.Errors, ErrorType{
-			Message: "break statement must be inside a while loop or a switch case",
-			Pos:     node.Position,
-		})
+		c.fail()
+		return
+	}
+	c.emit("JUMP", c.breakStack[len(c.breakStack)-1])
+}
+
+//generates code for continue, which jumps to the next iteration of the innermost loop
+func (c *CodeGen) CodegenContinueStatement(node *Continue) {
+	if len(c.continueStack) == 0 {
+		c.fail()
 		return
 	}
-	c.output.WriteString(fmt.Sprintf("JUMP %s\n", c.breakStack[len(c.breakStack)-1]))
+	c.emit("JUMP", c.continueStack[len(c.continueStack)-1])
 }
 
 //generates code for block.
@@ -241,81 +868,244 @@ func (c *CodeGen) CodegenStatementsBlock(node *Block) {
 	}
 }
 
+//generates code for return
+func (c *CodeGen) CodegenReturnStatement(node *Return) {
+	if c.function == nil {
+		c.fail()
+		return
+	}
+	returnType := c.function.ReturnType
+	if node.Value == nil {
+		if returnType != Unknown {
+			c.fail()
+			return
+		}
+		c.emit("JUMP", c.function.exit)
+		return
+	}
+	if returnType == Unknown {
+		c.fail()
+		return
+	}
+	exp := c.CodegenExpression(node.Value)
+	if exp == nil {
+		return
+	}
+	if !assignable(returnType, exp.Type) {
+		c.fail()
+		return
+	}
+	exp = c.codegenCastExpression(exp, returnType)
+	c.emit(opcodePrefix(returnType)+"ASN", "_ret_"+c.function.Name, exp.Code)
+	c.emit("JUMP", c.function.exit)
+}
+
+//generates a call: the arguments are copied into the parameters and the number of the
+//call site into the return address. With value the result is copied into a temporary,
+//so a later call of the same function does not overwrite it.
+func (c *CodeGen) codegenCall(node *Call, value bool) *Expression {
+	info, ok := c.functions[node.Function]
+	if _, isBuiltin := builtins[node.Function]; isBuiltin && !ok {
+		return c.codegenBuiltin(node)
+	}
+	if !ok {
+		c.fail()
+		return nil
+	}
+	if value && info.ReturnType == Unknown {
+		c.fail()
+		return nil
+	}
+	if len(node.Args) != len(info.Params) {
+		c.fail()
+		return nil
+	}
+	// all arguments are evaluated before the parameters change, as an argument may call the function
+	args := make([]*Expression, len(node.Args))
+	for i, arg := range node.Args {
+		exp := c.CodegenExpression(arg)
+		param := info.Params[i]
+		if exp == nil || param.Type == Unknown {
+			return nil
+		}
+		if !assignable(param.Type, exp.Type) {
+			c.fail()
+			return nil
+		}
+		args[i] = c.codegenCastExpression(exp, param.Type)
+	}
+	if c.function != nil {
+		c.function.calls = append(c.function.calls, node)
+	}
+	for i, param := range info.Params {
+		c.emit(opcodePrefix(param.Type)+"ASN", node.Function+"_"+param.Name, args[i].Code)
+	}
+	returnLabel := c.getNewLabel()
+	info.returns = append(info.returns, returnLabel)
+	c.emit("IASN", "_ra_"+node.Function, strconv.Itoa(len(info.returns)))
+	c.emit("JUMP", info.entry)
+	c.emitLabel(returnLabel)
+	if !value {
+		return nil
+	}
+	result := &Expression{Code: c.getTemp(), Type: info.ReturnType}
+	c.emit(opcodePrefix(result.Type)+"ASN", result.Code, "_ret_"+node.Function)
+	return result
+}
+
 // generates code for CPL
 func (c *CodeGen) CodegenExpression(node Node) *Expression {
 	switch temp := node.(type) {
 	case *Arithmetic:
 		return c.CodegenArithmeticExpression(temp)
+	case *Call:
+		return c.codegenCall(temp, true)
 	case *Variable:
 		return c.CodegenVariableExpression(temp)
+	case *Element:
+		return c.CodegenElementExpression(temp)
 	case *FloatNum:
 		return c.CodegenFloatLiteral(temp)
 	case *IntNum:
 		return c.CodegenIntLiteral(temp)
+	case *BoolLiteral:
+		return c.CodegenBoolLiteral(temp)
+	case *Condition:
+		return c.CodegenConditionExpression(temp)
+	case *Cast:
+		return c.CodegenCastExpression(temp)
+	case *Conditional:
+		return c.CodegenConditionalExpression(temp)
+	case *Assignment:
+		return c.codegenAssignment(temp)
+	case *CharLiteral:
+		return &Expression{Code: strconv.Itoa(int(temp.Value)), Type: Integer}
+	case *StringLiteral:
+		c.fail()
 	}
 	return nil
 }
 
 //generates code for an arithmetic
 func (c *CodeGen) CodegenArithmeticExpression(aryth *Arithmetic) *Expression {
-	lhs := c.CodegenExpression(aryth)
-	rhs := c.CodegenExpression(aryth)
+	lhs := c.CodegenExpression(aryth.LHS)
+	rhs := c.CodegenExpression(aryth.RHS)
 	if lhs == nil || rhs == nil {
 		return nil
 	}
-	result := &Expression{
-		Code: c.getTemp(),
-		Type: calculateExpressionType(lhs.Type, rhs.Type),
+	if lhs.Type == Bool || rhs.Type == Bool {
+		c.fail()
+		return nil
 	}
-	if result.Type == Float {
+	if aryth.Operator == Modulo && (lhs.Type == Float || rhs.Type == Float) {
+		c.fail()
+		return nil
+	}
+	resultType := calculateExpressionType(lhs.Type, rhs.Type)
+	if resultType == Float {
+		c.checkPromotion(lhs, aryth)
+		c.checkPromotion(rhs, aryth)
 		lhs = c.codegenCastExpression(lhs, Float)
 		rhs = c.codegenCastExpression(rhs, Float)
 	}
+	if (aryth.Operator == Divide || aryth.Operator == Modulo) && zeroLiteral(rhs) {
+		c.fail()
+		return nil
+	}
+	if folded := foldArithmetic(aryth.Operator, resultType, lhs, rhs); folded != nil {
+		return folded
+	}
+	result := &Expression{
+		Code: c.getTemp(),
+		Type: resultType,
+	}
 	switch aryth.Operator {
 	case Add:
 		if result.Type == Integer {
-			c.output.WriteString(fmt.Sprintf("IADD %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit("IADD", result.Code, lhs.Code, rhs.Code)
 		} else if result.Type == Float {
-			c.output.WriteString(fmt.Sprintf("RADD %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit("RADD", result.Code, lhs.Code, rhs.Code)
 		}
 	case Subtract:
 		if result.Type == Integer {
-			c.output.WriteString(fmt.Sprintf("ISUB %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit("ISUB", result.Code, lhs.Code, rhs.Code)
 		} else if result.Type == Float {
-			c.output.WriteString(fmt.Sprintf("RSUB %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit("RSUB", result.Code, lhs.Code, rhs.Code)
 		}
 	case Multiply:
 		if result.Type == Integer {
-			c.output.WriteString(fmt.Sprintf("IMLT %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit("IMLT", result.Code, lhs.Code, rhs.Code)
 		} else if result.Type == Float {
-			c.output.WriteString(fmt.Sprintf("RMLT %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit("RMLT", result.Code, lhs.Code, rhs.Code)
 		}
 	case Divide:
 		if result.Type == Integer {
-			c.output.WriteString(fmt.Sprintf("IDIV %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit("IDIV", result.Code, lhs.Code, rhs.Code)
 		} else if result.Type == Float {
-			c.output.WriteString(fmt.Sprintf("RDIV %s %s %s\n", result.Code, lhs.Code, rhs.Code))
+			c.emit("RDIV", result.Code, lhs.Code, rhs.Code)
 		}
+	case Modulo:
+		// QUAD has no remainder instruction: lhs - lhs / rhs * rhs
+		c.emit("IDIV", result.Code, lhs.Code, rhs.Code)
+		c.emit("IMLT", result.Code, result.Code, rhs.Code)
+		c.emit("ISUB", result.Code, lhs.Code, result.Code)
 	}
 	return result
 }
 
+//warns about an int operand of float arithmetic that is not a literal, whose value may
+//not be exact as a float
+func (c *CodeGen) checkPromotion(operand *Expression, aryth *Arithmetic) {
+	if _, ok := literal(operand); operand.Type == Integer && !ok {
+		c.warn(WarnPromotion, ErrorType{
+			Code:    CodeWarnPromotion,
+			Message: "int operand converted to float in float arithmetic",
+			Pos:     aryth.Position,
+		})
+	}
+}
+
 //generates code for variable
 func (c *CodeGen) CodegenVariableExpression(node *Variable) *Expression {
-	if _, exists := c.Variables[node.Variable]; !exists {
-		c.Errors = append(c.Errors, ErrorType{
-			Message: fmt.Sprintf("undefined variable %s", node.Variable),
-			Pos:     node.Position,
-		})
+	name, varType, exists := c.variable(node.Variable)
+	if !exists {
+		c.fail()
+		return nil
+	}
+	// the declaration of the variable already has an error
+	if varType == Unknown || !c.checkIndex(node.Variable, name, nil, node.Position) {
 		return nil
 	}
-	return &Expression{Code: node.Variable, Type: c.Variables[node.Variable]}
+	if constant, isConstant := c.constants[name]; isConstant {
+		return constant
+	}
+	return &Expression{Code: name, Type: varType}
+}
+
+//generates code for an element of an array
+func (c *CodeGen) CodegenElementExpression(node *Element) *Expression {
+	name, varType, exists := c.variable(node.Array)
+	if !exists {
+		c.fail()
+		return nil
+	}
+	if varType == Unknown || !c.checkIndex(node.Array, name, node.Index, node.Position) {
+		return nil
+	}
+	result := &Expression{Code: c.getTemp(), Type: varType}
+	op := opcodePrefix(varType) + "ASN"
+	if !c.codegenElement(node.Array, name, node.Index, node.Position, func(element string) {
+		c.emit(op, result.Code, element)
+	}) {
+		return nil
+	}
+	return result
 }
 
 //generates code for integer
 func (c *CodeGen) CodegenIntLiteral(node *IntNum) *Expression {
 	return &Expression{
-		Code: fmt.Sprintf("%d", node.Value),
+		Code: strconv.FormatInt(node.Value, 10),
 		Type: Integer,
 	}
 }
@@ -323,11 +1113,113 @@ func (c *CodeGen) CodegenIntLiteral(node *IntNum) *Expression {
 //generates code for float
 func (c *CodeGen) CodegenFloatLiteral(node *FloatNum) *Expression {
 	return &Expression{
-		Code: fmt.Sprintf("%f", node.Value),
+		Code: strconv.FormatFloat(node.Value, 'f', 6, 64),
 		Type: Float,
 	}
 }
 
+//generates code for true and false, stored as 1 and 0
+func (c *CodeGen) CodegenBoolLiteral(node *BoolLiteral) *Expression {
+	if node.Value {
+		return &Expression{Code: "1", Type: Bool}
+	}
+	return &Expression{Code: "0", Type: Bool}
+}
+
+//generates code for static_cast, RTOI or ITOR where the value is used
+func (c *CodeGen) CodegenCastExpression(node *Cast) *Expression {
+	exp := c.CodegenExpression(node.Value)
+	if exp == nil || node.Type == Unknown {
+		return nil
+	}
+	if exp.Type != node.Type && (exp.Type == Bool || node.Type == Bool) {
+		c.fail()
+		return nil
+	}
+	if v, ok := literal(exp); ok && node.Type == Integer && exp.Type == Float && v.Float != float64(int64(v.Float)) {
+		c.warn(WarnTruncation, ErrorType{
+			Code:    CodeWarnTruncation,
+			Message: fmt.Sprintf("static_cast(int) drops the fraction of %s", exp.Code),
+			Pos:     node.Position,
+		})
+	}
+	return c.codegenCastExpression(exp, node.Type)
+}
+
+//generates cond ? a : b, assigning the value of the arm that runs into one temporary
+func (c *CodeGen) CodegenConditionalExpression(node *Conditional) *Expression {
+	thenType, elseType := c.expressionType(node.Then), c.expressionType(node.Else)
+	resultType := conditionalType(thenType, elseType)
+	if resultType == Unknown && thenType != Unknown && elseType != Unknown {
+		c.fail()
+		return nil
+	}
+	elseLabel := c.getNewLabel()
+	endLabel := c.getNewLabel()
+	if !c.codegenJump(node.Condition, elseLabel, false) {
+		return nil
+	}
+	result := &Expression{Code: c.getTemp(), Type: resultType}
+	if !c.codegenConditionalValue(node.Then, result) {
+		return nil
+	}
+	c.emit("JUMP", endLabel)
+	c.emitLabel(elseLabel)
+	if !c.codegenConditionalValue(node.Else, result) {
+		return nil
+	}
+	c.emitLabel(endLabel)
+	return result
+}
+
+//assigns one value of ?: to its result
+func (c *CodeGen) codegenConditionalValue(node NodeExpression, result *Expression) bool {
+	exp := c.CodegenExpression(node)
+	if exp == nil || result.Type == Unknown {
+		return false
+	}
+	exp = c.codegenCastExpression(exp, result.Type)
+	c.emit(opcodePrefix(result.Type)+"ASN", result.Code, exp.Code)
+	return true
+}
+
+//returns the type of an expression without generating its code
+func (c *CodeGen) expressionType(node NodeExpression) DataType {
+	return expressionType(node, func(name string) DataType {
+		_, t, _ := c.variable(name)
+		return t
+	}, func(name string) DataType {
+		if info, ok := c.functions[name]; ok {
+			return info.ReturnType
+		}
+		return Unknown
+	})
+}
+
+//returns the enum of a variable, an element or an enum value, nil for other expressions
+func (c *CodeGen) enumOf(node NodeExpression) *Enum {
+	switch e := node.(type) {
+	case *Variable:
+		name, _, _ := c.variable(e.Variable)
+		return c.enums[name]
+	case *Element:
+		name, _, _ := c.variable(e.Array)
+		return c.enums[name]
+	case *Assignment:
+		return c.enumOf(e.Val)
+	}
+	return nil
+}
+
+//generates code for a condition used as a bool value
+func (c *CodeGen) CodegenConditionExpression(node *Condition) *Expression {
+	code := c.CodegenBooleanExpression(node.Value)
+	if code == "" {
+		return nil
+	}
+	return &Expression{Code: code, Type: Bool}
+}
+
 func (c *CodeGen) CodegenBooleanExpression(node Boolean) string {
 	switch s := node.(type) {
 	case *Or:
@@ -338,10 +1230,163 @@ func (c *CodeGen) CodegenBooleanExpression(node Boolean) string {
 		return c.CodegenNotBooleanExpression(s)
 	case *Compare:
 		return c.CodegenCompareBooleanExpression(s)
+	case *BoolTest:
+		return c.CodegenBoolTest(s)
 	}
 	return ""
 }
 
+//generates a jump to label taken when the condition is when, falling through otherwise.
+//A comparison is tested by the branch itself instead of being combined as a 0 or 1 value
+//by AND, OR and NOT, and the right operand of && and || is skipped when it is pure.
+func (c *CodeGen) codegenJump(node Boolean, label string, when bool) bool {
+	switch b := node.(type) {
+	case *Not:
+		return c.codegenJump(b.Value, label, !when)
+	case *Compare:
+		return c.codegenCompareJump(b, label, when)
+	case *And:
+		if pure(b.RHS) {
+			return c.codegenShortCircuit(b.LHS, b.RHS, label, when, false)
+		}
+	case *Or:
+		if pure(b.RHS) {
+			return c.codegenShortCircuit(b.LHS, b.RHS, label, when, true)
+		}
+	}
+	condition := c.CodegenBooleanExpression(node)
+	if condition == "" {
+		return false
+	}
+	c.emitJump(label, condition, when)
+	return true
+}
+
+//generates the jump of lhs && rhs, or of lhs || rhs when or is true, where rhs runs only
+//when lhs does not decide the result
+func (c *CodeGen) codegenShortCircuit(lhs, rhs Boolean, label string, when, or bool) bool {
+	if when == or {
+		//the result is when as soon as one operand is when
+		ok := c.codegenJump(lhs, label, when)
+		return c.codegenJump(rhs, label, when) && ok
+	}
+	skipLabel := c.getNewLabel()
+	ok := c.codegenJump(lhs, skipLabel, or)
+	ok = c.codegenJump(rhs, label, when) && ok
+	c.emitLabel(skipLabel)
+	return ok
+}
+
+//generates the jump of a comparison from one compare instruction, with no temporary for
+//a test of an int against 0
+func (c *CodeGen) codegenCompareJump(node *Compare, label string, when bool) bool {
+	c.checkEnumCompare(node)
+	lhs, rhs, compareType := c.compareOperands(node)
+	if lhs == nil {
+		return false
+	}
+	if result, ok := foldCompare(node.Operator, lhs, rhs, c.FloatEpsilon); ok {
+		if result == when {
+			c.emit("JUMP", label)
+		}
+		return true
+	}
+	operator := node.Operator
+	if when {
+		operator = complements[operator]
+	}
+	if compareType == Float && c.FloatEpsilon > 0 && (operator == EqualTo || operator == NotEqualTo) {
+		c.emitJump(label, c.codegenFloatEquality(lhs, rhs, node.Operator), when)
+		return true
+	}
+	if operator == NotEqualTo && compareType != Float {
+		if rhs.Code == "0" {
+			c.emit("JMPZ", label, lhs.Code)
+			return true
+		}
+		if lhs.Code == "0" {
+			c.emit("JMPZ", label, rhs.Code)
+			return true
+		}
+	}
+	prefix := opcodePrefix(compareType)
+	result := c.getTemp()
+	switch operator {
+	case GreaterThanOrEqualTo:
+		c.emit(prefix+"LSS", result, lhs.Code, rhs.Code)
+		c.emitJump(label, result, true)
+	case LessThenOrEqualTo:
+		c.emit(prefix+"GRT", result, lhs.Code, rhs.Code)
+		c.emitJump(label, result, true)
+	default:
+		c.emit(prefix+compareOpcodes[operator], result, lhs.Code, rhs.Code)
+		c.emit("JMPZ", label, result)
+	}
+	return true
+}
+
+//generates a jump to label when value is not 0 if when is true, when it is 0 otherwise
+func (c *CodeGen) emitJump(label, value string, when bool) {
+	if v, ok := truthLiteral(value); ok {
+		if v == when {
+			c.emit("JUMP", label)
+		}
+		return
+	}
+	if !when {
+		c.emit("JMPZ", label, value)
+		return
+	}
+	skipLabel := c.getNewLabel()
+	c.emit("JMPZ", skipLabel, value)
+	c.emit("JUMP", label)
+	c.emitLabel(skipLabel)
+}
+
+//reports whether a value or a condition can be skipped without a visible difference: it
+//calls no function, assigns nothing, does not divide and has no index that can halt
+func pure(node Node) bool {
+	switch n := node.(type) {
+	case *Variable, *IntNum, *FloatNum, *BoolLiteral, *CharLiteral:
+		return true
+	case *Element:
+		_, constant := n.Index.(*IntNum)
+		return constant
+	case *Arithmetic:
+		return n.Operator != Divide && n.Operator != Modulo && pure(n.LHS) && pure(n.RHS)
+	case *Cast:
+		return pure(n.Value)
+	case *Condition:
+		return pure(n.Value)
+	case *Conditional:
+		return pure(n.Condition) && pure(n.Then) && pure(n.Else)
+	case *BoolTest:
+		return pure(n.Value)
+	case *Compare:
+		return pure(n.LHS) && pure(n.RHS)
+	case *And:
+		return pure(n.LHS) && pure(n.RHS)
+	case *Or:
+		return pure(n.LHS) && pure(n.RHS)
+	case *Not:
+		return pure(n.Value)
+	}
+	return false
+}
+
+//generates code for a bool value used as a condition
+func (c *CodeGen) CodegenBoolTest(node *BoolTest) string {
+	exp := c.CodegenExpression(node.Value)
+	if exp == nil {
+		return ""
+	}
+	if exp.Type != Bool {
+		c.fail()
+		return ""
+	}
+	return exp.Code
+}
+
 //generates code for OR
 func (c *CodeGen) CodegenOrBooleanExpression(node *Or) string {
 	lhs := c.CodegenBooleanExpression(node.LHS)
@@ -349,9 +1394,14 @@ func (c *CodeGen) CodegenOrBooleanExpression(node *Or) string {
 	if lhs == "" || rhs == "" {
 		return ""
 	}
+	a, aLiteral := truthLiteral(lhs)
+	b, bLiteral := truthLiteral(rhs)
+	if aLiteral && bLiteral {
+		return truth(a || b)
+	}
 	result := c.getTemp()
-	c.output.WriteString(fmt.Sprintf("IADD %s %s %s\n", result, lhs, rhs))
-	c.output.WriteString(fmt.Sprintf("IGRT %s %s 0\n", result, result))
+	c.emit("IADD", result, lhs, rhs)
+	c.emit("IGRT", result, result, "0")
 	return result
 }
 
@@ -362,8 +1412,13 @@ func (c *CodeGen) CodegenAndBooleanExpression(node *And) string {
 	if lhs == "" || rhs == "" {
 		return ""
 	}
+	a, aLiteral := truthLiteral(lhs)
+	b, bLiteral := truthLiteral(rhs)
+	if aLiteral && bLiteral {
+		return truth(a && b)
+	}
 	result := c.getTemp()
-	c.output.WriteString(fmt.Sprintf("IMLT %s %s %s\n", result, lhs, rhs))
+	c.emit("IMLT", result, lhs, rhs)
 	return result
 }
 
@@ -373,135 +1428,292 @@ func (c *CodeGen) CodegenNotBooleanExpression(node *Not) string {
 	if value == "" {
 		return ""
 	}
+	if v, ok := truthLiteral(value); ok {
+		return truth(!v)
+	}
 	result := c.getTemp()
-	c.output.WriteString(fmt.Sprintf("ISUB %s 1 %s\n", result, value))
+	c.emit("ISUB", result, "1", value)
 	return result
 }
 
 //generates code for comparison
 func (c *CodeGen) CodegenCompareBooleanExpression(node *Compare) string {
-	if node.Operator == GreaterThanOrEqualTo {
-		return c.CodegenOrBooleanExpression(&Or{
-			LHS: &Compare{
-				LHS:      node.LHS,
-				Operator: EqualTo,
-				RHS:      node.RHS,
-			},
-			RHS: &Compare{
-				LHS:      node.LHS,
-				Operator: GreaterThan,
-				RHS:      node.RHS,
-			},
-		})
+	c.checkEnumCompare(node)
+	if node.Operator == GreaterThanOrEqualTo || node.Operator == LessThenOrEqualTo {
+		// the == of the lowered comparison is not written by the user
+		c.lowering = true
+		defer func() { c.lowering = false }()
 	}
-	if node.Operator == LessThenOrEqualTo {
-		return c.CodegenOrBooleanExpression(&Or{
-			LHS: &Compare{
-				LHS:      node.LHS,
-				Operator: EqualTo,
-				RHS:      node.RHS,
-			},
-			RHS: &Compare{
-				LHS:      node.LHS,
-				Operator: LessThan,
-				RHS:      node.RHS,
-			},
-		})
+	if lowered, ok := LowerComparison(node).(*Or); ok {
+		return c.CodegenOrBooleanExpression(lowered)
 	}
-	lhs := c.CodegenExpression(node)
-	rhs := c.CodegenExpression(node)
-	if lhs == nil || rhs == nil {
+	lhs, rhs, compareType := c.compareOperands(node)
+	if lhs == nil {
 		return ""
 	}
+	if result, ok := foldCompare(node.Operator, lhs, rhs, c.FloatEpsilon); ok {
+		return truth(result)
+	}
+	if compareType == Float && c.FloatEpsilon > 0 && (node.Operator == EqualTo || node.Operator == NotEqualTo) {
+		return c.codegenFloatEquality(lhs, rhs, node.Operator)
+	}
+	result := c.getTemp()
+	c.emit(opcodePrefix(compareType)+compareOpcodes[node.Operator], result, lhs.Code, rhs.Code)
+	return result
+}
+
+//QUAD opcodes of the comparisons without their I or R
+var compareOpcodes = map[Operator]string{
+	EqualTo:     "EQL",
+	NotEqualTo:  "NQL",
+	GreaterThan: "GRT",
+	LessThan:    "LSS",
+}
+
+//the comparison that is true exactly when the other one is false
+var complements = map[Operator]Operator{
+	EqualTo:              NotEqualTo,
+	NotEqualTo:           EqualTo,
+	GreaterThan:          LessThenOrEqualTo,
+	LessThenOrEqualTo:    GreaterThan,
+	LessThan:             GreaterThanOrEqualTo,
+	GreaterThanOrEqualTo: LessThan,
+}
+
+//warns about a comparison of values of different enums, or of an enum value and an int
+func (c *CodeGen) checkEnumCompare(node *Compare) {
+	if lhs, rhs := c.enumOf(node.LHS), c.enumOf(node.RHS); lhs != rhs && !c.lowering {
+		e := ErrorType{Code: CodeWarnEnumIntCompare, Message: "comparing an enum value with an int value", Pos: node.Position}
+		if lhs != nil && rhs != nil {
+			e.Code, e.Message = CodeWarnEnumCompare, fmt.Sprintf("comparing values of the enums of %s and %s", lhs.Name, rhs.Name)
+		}
+		c.warn(WarnEnum, e)
+	}
+}
+
+//generates the operands of a comparison converted to the type they are compared in, nil
+//when they cannot be compared
+func (c *CodeGen) compareOperands(node *Compare) (*Expression, *Expression, DataType) {
+	lhs := c.CodegenExpression(node.LHS)
+	rhs := c.CodegenExpression(node.RHS)
+	if lhs == nil || rhs == nil {
+		return nil, nil, Unknown
+	}
+	if (lhs.Type == Bool) != (rhs.Type == Bool) {
+		c.fail()
+		return nil, nil, Unknown
+	}
+	if lhs.Type == Bool && node.Operator != EqualTo && node.Operator != NotEqualTo {
+		c.fail()
+		return nil, nil, Unknown
+	}
 	compareType := calculateExpressionType(lhs.Type, rhs.Type)
 
 	if compareType == Float {
 		lhs = c.codegenCastExpression(lhs, Float)
 		rhs = c.codegenCastExpression(rhs, Float)
 	}
+	if compareType == Float && (node.Operator == EqualTo || node.Operator == NotEqualTo) && c.FloatEpsilon == 0 && !c.lowering {
+		c.warn(WarnFloatEqual, ErrorType{
+			Code:    CodeWarnFloatEqual,
+			Message: "comparing float values for exact equality; consider --float-epsilon",
+			Pos:     node.Position,
+		})
+	}
+	return lhs, rhs, compareType
+}
+
+//generates |lhs - rhs| < FloatEpsilon, negated for !=
+func (c *CodeGen) codegenFloatEquality(lhs, rhs *Expression, operator Operator) string {
+	difference := c.getTemp()
+	negative := c.getTemp()
+	positiveLabel := c.getNewLabel()
+	c.emit("RSUB", difference, lhs.Code, rhs.Code)
+	c.emit("RLSS", negative, difference, "0.0")
+	c.emit("JMPZ", positiveLabel, negative)
+	c.emit("RSUB", difference, "0.0", difference)
+	c.emitLabel(positiveLabel)
 	result := c.getTemp()
-	switch node.Operator {
-	case EqualTo:
-		if compareType == Integer {
-			c.output.WriteString(fmt.Sprintf("IEQL %s %s %s\n", result, lhs.Code, rhs.Code))
-		} else if compareType == Float {
-			c.output.WriteString(fmt.Sprintf("REQL %s %s %s\n", result, lhs.Code, rhs.Code))
-		}
-	case NotEqualTo:
-		if compareType == Integer {
-			c.output.WriteString(fmt.Sprintf("INQL %s %s %s\n", result, lhs.Code, rhs.Code))
-		} else if compareType == Float {
-			c.output.WriteString(fmt.Sprintf("RNQL %s %s %s\n", result, lhs.Code, rhs.Code))
-		}
-	case GreaterThan:
-		if compareType == Integer {
-			c.output.WriteString(fmt.Sprintf("IGRT %s %s %s\n", result, lhs.Code, rhs.Code))
-		} else if compareType == Float {
-			c.output.WriteString(fmt.Sprintf("RGRT %s %s %s\n", result, lhs.Code, rhs.Code))
-		}
-	case LessThan:
-		if compareType == Integer {
-			c.output.WriteString(fmt.Sprintf("ILSS %s %s %s\n", result, lhs.Code, rhs.Code))
-		} else if compareType == Float {
-			c.output.WriteString(fmt.Sprintf("RLSS %s %s %s\n", result, lhs.Code, rhs.Code))
-		}
+	c.emit("RLSS", result, difference, strconv.FormatFloat(c.FloatEpsilon, 'f', -1, 64))
+	if operator == NotEqualTo {
+		c.emit("ISUB", result, "1", result)
 	}
 	return result
 }
 
 func (c *CodeGen) getTemp() string {
 	c.temporaryIndex++
-	return fmt.Sprintf("_t%d", c.temporaryIndex)
+	return "_t" + strconv.Itoa(c.temporaryIndex)
+}
+
+//returns the position of a statement node
+func statementPosition(node Statement) (Position, bool) {
+	switch s := node.(type) {
+	case *Assignment:
+		return s.Pos, true
+	case *Input:
+		return s.Pos, true
+	case *Output:
+		return s.Position, true
+	case *IfStatement:
+		return s.Position, true
+	case *WhileStatement:
+		return s.Position, true
+	case *ForStatement:
+		return s.Position, true
+	case *DoWhileStatement:
+		return s.Position, true
+	case *Switch:
+		return s.Position, true
+	case *Break:
+		return s.Position, true
+	case *Continue:
+		return s.Position, true
+	case *Fallthrough:
+		return s.Position, true
+	case *Call:
+		return s.Position, true
+	case *Return:
+		return s.Position, true
+	case *Block:
+		return s.Position, true
+	}
+	return Position{}, false
+}
+
+//gives the next instructions, which are added by the compiler rather than by a statement,
+//the position of the } that ends the block they come after
+func (c *CodeGen) closingBrace(pos Position) {
+	c.statementPos, c.statementStart = pos, false
 }
 
 func (c *CodeGen) getNewLabel() string {
 	c.labelIndex++
-	return fmt.Sprintf("@%d", c.labelIndex)
+	return "@" + strconv.Itoa(c.Naming.labelBase()+c.labelIndex)
+}
+
+//adds one instruction without formatting its operands
+func (c *CodeGen) emit(op string, args ...string) {
+	c.code = append(c.code, Instruction{Op: op, Args: args, Pos: c.statementPos, Statement: c.statementStart})
+	c.statementStart = false
+}
+
+//adds a label definition
+func (c *CodeGen) emitLabel(label string) {
+	c.code = append(c.code, Instruction{Label: label, Pos: c.statementPos})
+}
+
+//writes the instructions added so far to output, with the opcodes of the target dialect;
+//returns the error of the writer, which fails every later write too
+func (c *CodeGen) writeCode() error {
+	var err error
+	for _, ins := range c.code {
+		if _, err = c.output.WriteString(ins.format(c.Opcodes)); err != nil {
+			break
+		}
+		if err = c.output.WriteByte('\n'); err != nil {
+			break
+		}
+	}
+	c.code = c.code[:0]
+	return err
 }
 
 func (c *CodeGen) codegenCastExpression(exp *Expression, targetType DataType) *Expression {
 	if exp.Type == targetType {
 		return exp
 	}
+	// a literal is converted to a literal, a++ of a float is RADD a a 1.000000
+	if folded := foldCast(exp, targetType); folded != nil {
+		return folded
+	}
 	result := &Expression{
 		Code: c.getTemp(),
 		Type: targetType,
 	}
 	switch targetType {
 	case Integer:
-		c.output.WriteString(fmt.Sprintf("RTOI %s %s\n", result.Code, exp.Code))
+		c.emit("RTOI", result.Code, exp.Code)
 	case Float:
-		c.output.WriteString(fmt.Sprintf("ITOR %s %s\n", result.Code, exp.Code))
+		c.emit("ITOR", result.Code, exp.Code)
 	default:
 		panic("Invalid type!")
 	}
 	return result
 }
 
-func calculateExpressionType(types ...DataType) DataType {
-	for _, t := range types {
-		if t == Float {
-			return Float
+//returns the type of an expression from the types of the variables and functions it uses,
+//Unknown when they are undefined or the expression has a type error
+func expressionType(node NodeExpression, variable, function func(name string) DataType) DataType {
+	switch e := node.(type) {
+	case *IntNum, *CharLiteral:
+		return Integer
+	case *FloatNum:
+		return Float
+	case *BoolLiteral, *Condition:
+		return Bool
+	case *Variable:
+		return variable(e.Variable)
+	case *Element:
+		return variable(e.Array)
+	case *Call:
+		t := function(e.Function)
+		if _, isBuiltin := builtins[e.Function]; isBuiltin && t == Unknown {
+			// sqrt is float, and pow has the type of its base
+			if e.Function == "sqrt" {
+				return Float
+			} else if len(e.Args) > 0 {
+				return expressionType(e.Args[0], variable, function)
+			}
 		}
+		return t
+	case *Cast:
+		return e.Type
+	case *Arithmetic:
+		lhs, rhs := expressionType(e.LHS, variable, function), expressionType(e.RHS, variable, function)
+		if lhs == Unknown || rhs == Unknown || lhs == Bool || rhs == Bool {
+			return Unknown
+		}
+		return calculateExpressionType(lhs, rhs)
+	case *Assignment:
+		return expressionType(e.Val, variable, function)
+	case *Conditional:
+		return conditionalType(expressionType(e.Then, variable, function), expressionType(e.Else, variable, function))
 	}
+	return Unknown
+}
 
-	return Integer
+//returns the type of cond ? a : b, an int value is converted to float; Unknown when
+//only one of the values is bool
+func conditionalType(a, b DataType) DataType {
+	if a == b {
+		return a
+	}
+	if a == Bool || b == Bool || a == Unknown || b == Unknown {
+		return Unknown
+	}
+	return Float
 }
 
-// RemoveLabels removes any labels generated by this module.
-func RemoveLabels(quad string) string {
-	labels := 0
-	for i, line := range strings.Split(quad, "\n") {
-		if strings.HasSuffix(line, ":") {
-			label := line[:len(line)-1]
-			// Delete label line
-			quad = strings.ReplaceAll(quad, line+"\n", "")
+//reports if a value of type from can be stored in a variable of type to
+func assignable(to, from DataType) bool {
+	return to == from || (to == Float && from == Integer)
+}
 
-			// Replace all label references with the correct line number
-			quad = strings.ReplaceAll(quad, label, strconv.Itoa(i-labels+1))
-			labels++
+//returns the opcode prefix of values of type t; bool values are ints
+func opcodePrefix(t DataType) string {
+	if t == Float {
+		return "R"
+	}
+	return "I"
+}
+
+func calculateExpressionType(types ...DataType) DataType {
+	for _, t := range types {
+		if t == Float {
+			return Float
 		}
 	}
 
-	return quad
+	return Integer
 }
@@ -0,0 +1,460 @@
+package cpq
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//compiles src and returns its QUAD without the labels resolved, failing on errors
+func codegenText(t *testing.T, src string, opts Options) string {
+	t.Helper()
+	program, errors := Parse(src)
+	code, codegenErrors, _ := CodegenInstructions(program, opts)
+	if errors = append(errors, codegenErrors...); len(errors) > 0 {
+		t.Fatalf("errors: %v", errors)
+	}
+	return FormatInstructions(code, nil)
+}
+
+//the code of a statement is generated from its expression, and the code of an operator
+//from its operands, not from the node itself
+func TestCodegenVisitsOperands(t *testing.T) {
+	src := `a, b, c : int;
+{ input(b); input(c); a = b + c * 3; output(a - b); switch (a / 2) { case 1: output(c); default: output(b); } }`
+	quad := codegenText(t, src, Options{})
+	for _, want := range []string{"IMLT _t1 c 3", "IADD a b _t1", "ISUB _t1 a b", "IPRT _t1", "IDIV _t1 a 2"} {
+		if !strings.Contains(quad, want+"\n") {
+			t.Errorf("no %q in\n%s", want, quad)
+		}
+	}
+}
+
+//code generation alone, of a parsed program, with the allocations of every statement
+func BenchmarkCodegen(b *testing.B) {
+	cfg := stressConfig{Statements: 5000, Depth: 20, Switches: 20}
+	src := generateStressProgram(cfg)
+	program, errors := Parse(src)
+	if len(errors) > 0 {
+		b.Fatal(errors)
+	}
+	statements := float64(strings.Count(src, ";") - 2) // the simple statements, after 2 declarations
+	perStatement := func(b *testing.B, run func()) {
+		b.ReportAllocs()
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		for n := 0; n < b.N; n++ {
+			run()
+		}
+		runtime.ReadMemStats(&after)
+		b.ReportMetric(float64(after.Mallocs-before.Mallocs)/float64(b.N)/statements, "allocs/stmt")
+	}
+	b.Run("instructions", func(b *testing.B) {
+		perStatement(b, func() { CodegenInstructions(program, Options{}) })
+	})
+	b.Run("stream", func(b *testing.B) {
+		perStatement(b, func() {
+			if _, _, err := CodegenStream(program, io.Discard, Options{}); err != nil {
+				b.Fatal(err)
+			}
+		})
+	})
+}
+
+//the generated jumps follow the binding of the parser: an else to the closest if, and an
+//else if chain to the first true condition
+func TestCodegenDanglingElse(t *testing.T) {
+	tests := []struct {
+		statement string
+		outputs   map[int]string // by the input
+	}{
+		{"if (a > 0) if (a > 5) output(1); else output(2);", map[int]string{-1: "", 3: "2\n", 9: "1\n"}},
+		{"if (a > 0) if (a > 5) output(1); else output(2); else output(3);", map[int]string{-1: "3\n", 3: "2\n", 9: "1\n"}},
+		{"if (a == 1) output(1); else if (a == 2) output(2); else if (a == 3) output(3); else output(4);",
+			map[int]string{1: "1\n", 2: "2\n", 3: "3\n", 7: "4\n"}},
+		{"if (a == 1) output(1); else if (a > 1) if (a > 5) output(2); else output(3);",
+			map[int]string{0: "", 1: "1\n", 3: "3\n", 9: "2\n"}},
+	}
+	for _, test := range tests {
+		quad, errors := compileQuad(t, "a : int;\n{ input(a); "+test.statement+" }\n", Options{})
+		if len(errors) > 0 {
+			t.Fatalf("%s: %v", test.statement, errors)
+		}
+		for input, want := range test.outputs {
+			var out strings.Builder
+			if err := runQuad(quad, strings.NewReader(fmt.Sprint(input)), &out, defaultMaxSteps); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != want {
+				t.Errorf("%s\nwith a = %d printed %q, want %q", test.statement, input, out.String(), want)
+			}
+		}
+	}
+}
+
+//the cases of a switch are compared with the value of its expression, computed once
+func TestCodegenSwitchExpression(t *testing.T) {
+	src := `a, n : int;
+{ input(a); n = 0; switch (a * 2 - n) { case 2: output(1); n = 5; break; case 4, 6: output(2); break; case 8..12: output(3); default: output(0); } output(n); }`
+	quad, errors := compileQuad(t, src, Options{})
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	for input, want := range map[int]string{1: "1\n5\n", 2: "2\n0\n", 3: "2\n0\n", 5: "3\n0\n0\n", 9: "0\n0\n"} {
+		var out strings.Builder
+		if err := runQuad(quad, strings.NewReader(fmt.Sprint(input)), &out, defaultMaxSteps); err != nil {
+			t.Fatal(err)
+		}
+		if out.String() != want {
+			t.Errorf("with a = %d printed %q, want %q", input, out.String(), want)
+		}
+	}
+}
+
+//the index of a compound assignment is computed once, so a call in it is made once and
+//the element it loads is the one it stores
+func TestCodegenCompoundIndex(t *testing.T) {
+	src := `a[3] : int; n : int; x[2] : float;
+func next() : int { n = n + 1; output(n); return n; }
+{ n = 0; a[0] = 10; a[1] = 20; a[2] = 30; x[0] = 0.5; x[1] = 1.5;
+  a[next()] += 5; a[next()]++; x[next() - 3] *= 4; n = 0; a[n] -= n + 7;
+  output(a[0]); output(a[1]); output(a[2]); output(x[0]); }`
+	output, err := crossCheck(src, "", Options{})
+	if want := "1\n2\n3\n3\n25\n31\n2\n"; err != nil || output != want {
+		t.Errorf("printed %q, %v, want %q", output, err, want)
+	}
+	if calls := strings.Count(codegenText(t, src, Options{}), "IASN _ra_next"); calls != 3 {
+		t.Errorf("next is called %d times, want 3", calls)
+	}
+}
+
+//a program of a language feature, the input it reads and what it prints
+type featureProgram struct {
+	name, src, input, want string
+}
+
+//runs every program with both interpreters, which must print what it should
+func checkPrograms(t *testing.T, programs []featureProgram) {
+	t.Helper()
+	for _, p := range programs {
+		output, err := crossCheck(p.src, p.input, Options{})
+		if err != nil || output != p.want {
+			t.Errorf("%s printed %q, %v, want %q", p.name, output, err, p.want)
+		}
+	}
+}
+
+//a program that misuses a language feature and the errors of its analysis
+type featureMisuse struct {
+	src  string
+	want []string
+}
+
+func checkMisuses(t *testing.T, misuses []featureMisuse) {
+	t.Helper()
+	for _, m := range misuses {
+		if errors := analyzeSource(t, m.src, Options{}); strings.Join(errors, "\n") != strings.Join(m.want, "\n") {
+			t.Errorf("%s\nerrors = %q, want %q", m.src, errors, m.want)
+		}
+	}
+}
+
+func TestArrays(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"elements", `a[4] : int; x[2] : float; i : int;
+{ for (i = 0; i < 4; i++) a[i] = i * 10; x[1] = a[3] / 4.0; output(a[0] + a[2]); output(x[1]); output(a[a[0]]); }`, "", "20\n7.5\n0\n"},
+		{"input into an element", `a[3] : int; i : int;
+{ input(i); input(a[i]); output(a[i] * 2); }`, "2 21", "42\n"},
+		{"an index out of range halts", `a[3] : int; i : int;
+{ input(i); a[i] = 1; output(1); }`, "3", ""},
+		{"local arrays", `r : int;
+func sum(n : int) : int s[3] : int; i, t : int; { t = 0; for (i = 0; i < 3; i++) s[i] = n + i; for (i = 0; i < 3; i++) t += s[i]; return t; }
+{ r = sum(5); output(r); }`, "", "18\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"a[3] : int;\n{ a[3] = 1; }\n", []string{"index 3 is out of range of a[3]"}},
+		{"a[3] : int; x : float;\n{ a[x] = 1; }\n", []string{"array index must be an integer"}},
+		{"a[3] : int;\n{ a = 1; }\n", []string{"array a needs an index"}},
+		{"a : int;\n{ a[0] = 1; }\n", []string{"a is not an array"}},
+	})
+}
+
+func TestForLoops(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"counting", `i, s : int;
+{ s = 0; for (i = 1; i <= 4; i = i + 1) s = s + i; output(s); output(i); }`, "", "10\n5\n"},
+		{"no iterations", `i : int;
+{ for (i = 5; i < 3; i = i + 1) output(i); output(i); }`, "", "5\n"},
+		{"nested with a block", `i, j : int;
+{ for (i = 0; i < 2; i = i + 1) { for (j = 0; j < i + 1; j = j + 1) output(i * 10 + j); } }`, "", "0\n10\n11\n"},
+		{"break", `i : int;
+{ for (i = 0; i < 10; i = i + 1) { if (i == 3) break; else output(i); } output(i); }`, "", "0\n1\n2\n3\n"},
+		{"float counter", `x : float;
+{ for (x = 0.5; x < 2; x = x + 0.5) output(x); }`, "", "0.5\n1\n1.5\n"},
+	})
+}
+
+func TestDoWhile(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"runs once", `i : int;
+{ i = 10; do { output(i); i = i + 1; } while (i < 3); }`, "", "10\n"},
+		{"repeats", `i : int;
+{ i = 0; do i = i + 2; while (i < 7); output(i); }`, "", "8\n"},
+		{"reads until zero", `n, s : int;
+{ s = 0; do { input(n); s = s + n; } while (n != 0); output(s); }`, "3 4 0 9", "7\n"},
+		{"break", `i : int;
+{ i = 0; do { i = i + 1; if (i == 2) break; else output(i); } while (i < 5); output(i); }`, "", "1\n2\n"},
+	})
+}
+
+func TestContinue(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"for runs its step", `i : int;
+{ for (i = 0; i < 5; i = i + 1) { if (i == 1 || i == 3) continue; else output(i); } }`, "", "0\n2\n4\n"},
+		{"while", `i : int;
+{ i = 0; while (i < 4) { i = i + 1; if (i == 2) continue; else output(i); } }`, "", "1\n3\n4\n"},
+		{"do-while tests the condition", `i : int;
+{ i = 0; do { i = i + 1; if (i < 3) continue; else output(i); } while (i < 4); }`, "", "3\n4\n"},
+		{"inner loop", `i, j : int;
+{ for (i = 0; i < 2; i = i + 1) for (j = 0; j < 3; j = j + 1) { if (j == 1) continue; else output(i * 10 + j); } }`, "", "0\n2\n10\n12\n"},
+		{"inside a switch", `i : int;
+{ for (i = 0; i < 3; i = i + 1) { switch (i) { case 1: continue; default: output(i); break; } output(-i); } }`, "", "0\n0\n2\n-2\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"i : int;\n{ continue; }\n", []string{"continue statement must be inside a loop"}},
+		{"i : int;\n{ switch (i) { default: continue; } }\n", []string{"continue statement must be inside a loop"}},
+	})
+}
+
+func TestRemainder(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"operands", `a, b : int;
+{ input(a); input(b); output(a % b); output(-a % b); output(a % -b); output(a % b * 2 + 1); }`, "17 5", "2\n-2\n2\n5\n"},
+		{"constants", `x : int;
+{ x = 23 % 7; output(x); output(6 % 3); }`, "", "2\n0\n"},
+		{"compound", `x : int;
+{ x = 47; x %= 10; output(x); }`, "", "7\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"x : float;\n{ x = x % 2; }\n", []string{"operator % needs int operands"}},
+		{"x : int;\n{ x = x % 0; }\n", []string{"division by zero"}},
+	})
+}
+
+func TestConstants(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"uses", `n : const int = 3; pi : const float = 3.5; a[3] : int; i : int;
+{ for (i = 0; i < n; i++) a[i] = i * n; output(a[n - 1]); output(pi * 2); }`, "", "6\n7\n"},
+		{"case labels", `two : const int = 2; i : int;
+{ input(i); switch (i) { case 1: output(10); break; case two: output(20); break; default: output(0); break; } }`, "2", "20\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"n : const int = 3;\n{ n = 4; }\n", []string{"cannot assign to constant n"}},
+		{"n : const int = 3;\n{ input(n); }\n", []string{"cannot input into constant n"}},
+		{"a[2] : const int = 3;\n{ output(1); }\n", []string{"constant a cannot be an array"}},
+	})
+	//a constant is its value, not a QUAD variable
+	if code := codegenText(t, "n : const int = 3; x : int;\n{ x = n; }\n", Options{}); strings.Contains(code, " n") {
+		t.Errorf("the constant n is a variable of the code:\n%s", code)
+	}
+}
+
+func TestBoolValues(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"conditions", `done, big : bool; x : int;
+{ input(x); done = false; big = x > 10; if (big) output(1); else output(0); if (big == done) output(2); else output(3); }`, "12", "1\n3\n"},
+		{"loop flag", `done : bool; i : int;
+{ done = false; i = 0; while (done != true) { i = i + 1; done = i >= 3; } output(i); }`, "", "3\n"},
+		{"parenthesized condition", `b : bool; x : int;
+{ input(x); b = (x < 0); if (b) output(-1); else output(1); }`, "-5", "-1\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"b : bool; x : int;\n{ x = b + 1; }\n", []string{"cannot use bool values in arithmetic"}},
+		{"b, c : bool;\n{ if (b < c) b = true; else b = false; }\n", []string{"bool values can only be compared with == and !="}},
+		{"b : bool;\n{ input(b); }\n", []string{"cannot input into bool variable b"}},
+		{"b : bool; x : int;\n{ x = b; }\n", []string{"cannot assign bool value to int variable x"}},
+		{"x : int;\n{ if (x) x = 1; else x = 2; }\n", []string{"condition must be a comparison or a bool value"}},
+	})
+}
+
+func TestCasts(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"in expressions", `a, y : int; b : float;
+{ input(a); input(b); y = a + static_cast(int)(b) * 2; output(y); output(static_cast(float)(a) / 2); }`, "3 2.75", "7\n1.5\n"},
+		{"angle brackets", `a : int; b : float;
+{ b = 4.5; a = static_cast<int>(b); output(a); }`, "", "4\n"},
+		{"negative values", `b : float;
+{ input(b); output(static_cast(int)(b)); }`, "-2.5", "-2\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"b : bool; x : int;\n{ x = static_cast(int)(b); }\n", []string{"static_cast cannot convert bool values"}},
+	})
+	code := codegenText(t, "a : int; b : float;\n{ a = static_cast(int)(b); b = static_cast(float)(a); }\n", Options{})
+	if !strings.Contains(code, "RTOI") || !strings.Contains(code, "ITOR") {
+		t.Errorf("the casts are not RTOI and ITOR:\n%s", code)
+	}
+}
+
+func TestCompoundAssignments(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"every operator", `x : int;
+{ x = 10; x += 5; output(x); x -= 3; output(x); x *= 2; output(x); x /= 5; output(x); x %= 3; output(x); }`, "", "15\n12\n24\n4\n1\n"},
+		{"float", `y : float;
+{ y = 1.5; y *= 3; y += 1; output(y); }`, "", "5.5\n"},
+		{"element", `a[3] : int; i : int;
+{ a[1] = 4; i = 0; a[i + 1] += 6; output(a[1]); }`, "", "10\n"},
+		{"in a for step", `i : int;
+{ for (i = 1; i < 20; i *= 3) output(i); }`, "", "1\n3\n9\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"n : const int = 3;\n{ n += 1; }\n", []string{"cannot assign to constant n"}},
+		{"b : bool;\n{ b += 1; }\n", []string{"cannot use bool values in arithmetic"}},
+	})
+}
+
+func TestIncrementDecrement(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"statements", `i : int; x : float;
+{ i = 5; i++; i++; i--; output(i); x = 0.5; x++; output(x); }`, "", "6\n1.5\n"},
+		{"element", `a[2] : int;
+{ a[1] = 7; a[1]--; output(a[1]); }`, "", "6\n"},
+		{"for step", `i : int;
+{ for (i = 3; i > 0; i--) output(i); }`, "", "3\n2\n1\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"n : const int = 3;\n{ n++; }\n", []string{"cannot assign to constant n"}},
+		{"b : bool;\n{ b--; }\n", []string{"cannot use bool values in arithmetic"}},
+	})
+}
+
+func TestConditionalExpressions(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"max", `a, b, m : int;
+{ input(a); input(b); m = a > b ? a : b; output(m); m = a < b ? a : b; output(m); }`, "4 9", "9\n4\n"},
+		{"nested and in arithmetic", `x, s : int;
+{ input(x); s = (x < 0 ? -1 : x == 0 ? 0 : 1) * 10 + 1; output(s); }`, "-3", "-9\n"},
+		{"promoted", `x : int; y : float;
+{ x = 2; y = x > 1 ? 0.5 : x; output(y); y = x > 5 ? 0.5 : x; output(y); }`, "", "0.5\n2\n"},
+		{"bool condition", `b : bool; x : int;
+{ b = true; x = b ? 1 : 2; output(x); }`, "", "1\n"},
+	})
+	checkMisuses(t, []featureMisuse{
+		{"b : bool; x : int;\n{ x = x > 0 ? b : 1; }\n", []string{"the values of ?: have different types bool and int"}},
+	})
+}
+
+//the codes of the warnings of a program
+func warningCodes(t *testing.T, src string) []string {
+	t.Helper()
+	program, errors := Parse(src)
+	_, codegenErrors, warnings := CodegenInstructions(program, Options{})
+	if errors = append(errors, codegenErrors...); len(errors) > 0 {
+		t.Fatalf("errors: %v", errors)
+	}
+	codes := []string{}
+	for _, w := range warnings {
+		codes = append(codes, w.Code)
+	}
+	return codes
+}
+
+func TestEnums(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"values", `c : enum { red, green, blue };
+{ c = blue; output(c); c = green; if (c == green) output(1); else output(0); }`, "", "2\n1\n"},
+		{"case labels", `c : enum { red, green, blue }; i : int;
+{ input(i); c = i; switch (c) { case red: output(10); break; case green: output(20); break; case blue: output(30); break; default: output(0); break; } }`, "1", "20\n"},
+	})
+	for _, test := range []struct {
+		src  string
+		want []string
+	}{
+		{"c : enum { red, green };\n{ c = green; output(c); }\n", []string{}},
+		{"c : enum { red, green };\n{ c = 3; output(c); }\n", []string{CodeWarnEnumAssign}},
+		{"c : enum { red, green }; i : int;\n{ input(i); c = red; if (c == i) output(1); else output(0); }\n", []string{CodeWarnEnumIntCompare}},
+		{"c : enum { red, green }; d : enum { up, down };\n{ c = red; d = up; if (c == d) output(1); else output(0); }\n", []string{CodeWarnEnumCompare}},
+	} {
+		if codes := warningCodes(t, test.src); strings.Join(codes, " ") != strings.Join(test.want, " ") {
+			t.Errorf("%s\nwarnings = %v, want %v", test.src, codes, test.want)
+		}
+	}
+	if _, errors := Parse("c : enum { red, green };\n{ switch (c) { case blue: output(1); default: output(0); } }\n"); len(errors) != 1 || errors[0].Code != CodeNotEnumValue {
+		t.Errorf("a case label that is not an enum value: %v", errors)
+	}
+}
+
+func TestStructs(t *testing.T) {
+	checkPrograms(t, []featureProgram{
+		{"fields", `p, q : struct { x, y : float; n : int; };
+{ input(p.x); p.y = 2; q.x = p.x + p.y; q.n = 3; q.n++; output(q.x); output(q.n); }`, "1.5", "3.5\n4\n"},
+		{"array fields", `s : struct { v[3] : int; k : int; }; i : int;
+{ for (i = 0; i < 3; i++) s.v[i] = i * i; s.k = s.v[2] + s.v[1]; output(s.k); }`, "", "5\n"},
+		{"arrays of structs", `pts[2] : struct { x, y : int; }; i : int;
+{ for (i = 0; i < 2; i++) { pts[i].x = i; pts[i].y = i + 10; } output(pts[1].x + pts[0].y); }`, "", "11\n"},
+	})
+	if code := codegenText(t, "p : struct { x : int; };\n{ p.x = 1; }\n", Options{}); !strings.Contains(code, "IASN p_x 1") {
+		t.Errorf("p.x is not the QUAD variable p_x:\n%s", code)
+	}
+	for src, want := range map[string]string{
+		"p : struct { x : int; }; i : int;\n{ i = p.y; }\n": "p has no field y",
+		"p : int;\n{ p.x = 1; }\n":                          "p is not a struct",
+		"a[2] : struct { v[2] : int; };\n{ output(1); }\n":  "field v of the array of structs a cannot be an array",
+	} {
+		if _, errors := Parse(src); len(errors) != 1 || errors[0].Message != want {
+			t.Errorf("%s\nerrors = %v, want %q", src, errors, want)
+		}
+	}
+}
+
+//--switch-search finds the same case as the chain of tests for every value
+func TestSwitchSearch(t *testing.T) {
+	src := `i : int;
+{ input(i); while (i != 100) { switch (i) {
+    case 1: output(10); break;
+    case 3..5: output(30); break;
+    case 7, 8: output(70); break;
+    case -4: output(-40); break;
+    case 12..20, 9: output(90); break;
+    default: output(0); break; }
+  input(i); } }`
+	var input strings.Builder
+	for i := -6; i <= 22; i++ {
+		input.WriteString(strconv.Itoa(i) + " ")
+	}
+	input.WriteString("100")
+	chain, err := crossCheck(src, input.String(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	//the values -6 to 22
+	if want := "0\n0\n-40\n0\n0\n0\n0\n10\n0\n30\n30\n30\n0\n70\n70\n90\n0\n0\n90\n90\n90\n90\n90\n90\n90\n90\n90\n0\n0\n"; chain != want {
+		t.Fatalf("the chain printed %q, want %q", chain, want)
+	}
+	search, err := crossCheck(src, input.String(), Options{SwitchSearch: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if search != chain {
+		t.Errorf("the search printed\n%s\nthe chain printed\n%s", search, chain)
+	}
+	chainCode, _ := compileQuad(t, src, Options{})
+	searchCode, _ := compileQuad(t, src, Options{SwitchSearch: true})
+	if chainCode == searchCode {
+		t.Errorf("--switch-search generated the chain of tests")
+	}
+}
+
+func TestSortCaseRanges(t *testing.T) {
+	sorted, ok := sortCaseRanges([]caseRange{{7, 8, "@2"}, {1, 1, "@1"}, {2, 4, "@1"}, {9, 9, "@2"}, {5, 5, "@3"}})
+	want := []caseRange{{1, 4, "@1"}, {5, 5, "@3"}, {7, 9, "@2"}}
+	if !ok || !reflect.DeepEqual(sorted, want) {
+		t.Errorf("sortCaseRanges = %v, %v, want %v", sorted, ok, want)
+	}
+	if _, ok := sortCaseRanges([]caseRange{{1, 5, "@1"}, {3, 3, "@2"}}); ok {
+		t.Errorf("sortCaseRanges merged cases that share a value")
+	}
+}
@@ -0,0 +1,67 @@
+package cpq
+
+import "testing"
+
+//every program is run by the CPL interpreter and, compiled, by the QUAD interpreter on
+//the same input, and both must print the output the program should
+func TestCrossCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		input string
+		want  string
+		opts  Options
+	}{
+		{"arithmetic", `a, b : int; x : float;
+{ input(a); input(b); output(a + b * 2); output(a / b); output(a % b); x = a / 2.0; output(x); output(-a - 1); }`, "7 3", "13\n2\n1\n3.5\n-8\n", Options{}},
+		{"casts", `a : int; x : float;
+{ input(x); a = static_cast<int>(x); output(a); x = static_cast<float>(a) / 4; output(x); }`, "9.75", "9\n2.25\n", Options{}},
+		{"if and else", `a, b : int;
+{ input(a); input(b); if (a < b) output(a); else output(b); if (a == b || !(a > b)) output(1); else output(0); }`, "4 2", "2\n0\n", Options{}},
+		{"dangling else", `a : int;
+{ input(a); if (a > 0) if (a > 5) output(2); else output(1); else if (a < -5) output(-2); else output(-1); }`, "3", "1\n", Options{}},
+		{"while with break", `a : int;
+{ input(a); while (a < 20) { a = a + 1; if (a == 15) break; } output(a); }`, "1", "15\n", Options{}},
+		{"for with continue", `i, s : int;
+{ s = 0; for (i = 0; i < 10; i++) { if (i % 3 == 0) continue; s += i; } output(s); }`, "", "27\n", Options{}},
+		{"do while", `i : int;
+{ i = 5; do { output(i); i--; } while (i > 0); }`, "", "5\n4\n3\n2\n1\n", Options{}},
+		{"switch falling through", `a : int;
+{ input(a); switch (a) { case 1: output(1); case 2: output(2); break; default: output(3); } }`, "1", "1\n2\n", Options{}},
+		{"switch on an expression", `a : int;
+{ input(a); switch (a * 2 + 1) { case 3: output(3); break; case 5: output(5); break; default: output(0); } }`, "2", "5\n", Options{}},
+		{"switch with break", `a : int;
+{ input(a); switch (a) { case 1: output(1); case 2: output(2); default: output(3); } }`, "1", "1\n", Options{SwitchBreak: true}},
+		{"functions", `r : int;
+func add(a : int, b : int) : int { return a + b; }
+func show(x : float) { output(x * 2); }
+{ r = add(2, 3); output(r); show(1.25); }`, "", "5\n2.5\n", Options{}},
+		{"arrays", `a[5] : int; i : int;
+{ for (i = 0; i < 5; i++) a[i] = i * i; for (i = 4; i >= 0; i--) output(a[i]); }`, "", "16\n9\n4\n1\n0\n", Options{}},
+		{"builtins", `x : float; n : int;
+{ input(x); input(n); output(sqrt(x)); output(pow(x, n)); output(pow(2, -1)); }`, "2.25 3", "1.5\n11.390625\n0\n", Options{}},
+		{"float comparison", `x : float;
+{ x = 0.1 + 0.2; if (x == 0.3) output(1); else output(0); }`, "", "1\n", Options{FloatEpsilon: 1e-9}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output, err := crossCheck(test.src, test.input, test.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if output != test.want {
+				t.Errorf("printed %q, want %q", output, test.want)
+			}
+		})
+	}
+}
+
+//generated programs whose loops end: with more statements i gets too low for the nested
+//loops to finish
+func TestCrossCheckStressProgram(t *testing.T) {
+	for _, cfg := range []stressConfig{{Statements: 2000, Switches: 20}, {Statements: 3, Depth: 50}} {
+		if _, err := crossCheck(generateStressProgram(cfg), "3 2.5", Options{}); err != nil {
+			t.Errorf("%+v: %s", cfg, err)
+		}
+	}
+}
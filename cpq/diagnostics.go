@@ -0,0 +1,88 @@
+package cpq
+
+import (
+	"sort"
+	"strings"
+)
+
+//errors after which the command line compiler stops
+const DefaultMaxErrors = 20
+
+//collects the errors of every phase of a compilation, the parser, the analysis and the
+//code generator, which stop early once Max errors are reported. A nil *Diagnostics has
+//no limit.
+type Diagnostics struct {
+	Max    int // 0 for no limit
+	errors []ErrorType
+}
+
+//returns a collector that stops the compilation after max errors, 0 for no limit
+func NewDiagnostics(max int) *Diagnostics {
+	return &Diagnostics{Max: max}
+}
+
+//records an error, reporting false when the limit was already reached and it is dropped
+func (d *Diagnostics) Add(e ErrorType) bool {
+	if d == nil {
+		return true
+	}
+	if d.Full() {
+		return false
+	}
+	d.errors = append(d.errors, e)
+	return true
+}
+
+//reports whether the limit is reached, so the phases should stop
+func (d *Diagnostics) Full() bool {
+	return d != nil && d.Max > 0 && len(d.errors) >= d.Max
+}
+
+//returns the errors in the order they were reported
+func (d *Diagnostics) Errors() []ErrorType {
+	if d == nil {
+		return nil
+	}
+	return d.errors
+}
+
+//returns the errors ordered by their position in the source
+func (d *Diagnostics) Sorted() []ErrorType {
+	return SortErrors(append([]ErrorType(nil), d.Errors()...))
+}
+
+//sorts errors by line and column, keeping the order of errors at the same position
+func SortErrors(errors []ErrorType) []ErrorType {
+	sort.SliceStable(errors, func(i, j int) bool {
+		a, b := errors[i].Pos, errors[j].Pos
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Column < b.Column
+	})
+	return errors
+}
+
+//sets the End of the errors that have none, the semantic errors, to the end of the token
+//of src at their position, so a diagnostic can underline the whole lexeme
+func SetErrorEnds(src string, errors []ErrorType) {
+	missing := map[Position][]int{}
+	for i, e := range errors {
+		if e.End == (Position{}) {
+			missing[e.Pos] = append(missing[e.Pos], i)
+		}
+	}
+	if len(missing) == 0 {
+		return
+	}
+	scanner := NewScanner(strings.NewReader(src))
+	for {
+		token := scanner.Scan()
+		for _, i := range missing[token.Position] {
+			errors[i].End = token.End
+		}
+		if token.TokenType == EOF {
+			return
+		}
+	}
+}
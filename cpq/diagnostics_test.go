@@ -0,0 +1,88 @@
+package cpq
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiagnostics(t *testing.T) {
+	d := NewDiagnostics(2)
+	for n, message := range []string{"a", "b", "c"} {
+		if added := d.Add(ErrorType{Message: message}); added != (n < 2) {
+			t.Errorf("Add(%s) = %v", message, added)
+		}
+	}
+	if !d.Full() || len(d.Errors()) != 2 || d.Errors()[1].Message != "b" {
+		t.Errorf("full = %v, errors = %v", d.Full(), d.Errors())
+	}
+	var unlimited *Diagnostics
+	if !unlimited.Add(ErrorType{Message: "a"}) || unlimited.Full() || unlimited.Errors() != nil {
+		t.Errorf("a nil collector has a limit or keeps errors")
+	}
+	if d := NewDiagnostics(0); !d.Add(ErrorType{}) || d.Full() {
+		t.Errorf("a collector without a limit is full")
+	}
+}
+
+func TestSortErrors(t *testing.T) {
+	errors := []ErrorType{
+		{Message: "c", Pos: Position{Line: 2, Column: 1}},
+		{Message: "a", Pos: Position{Line: 0, Column: 5}},
+		{Message: "b1", Pos: Position{Line: 2, Column: 0}},
+		{Message: "b2", Pos: Position{Line: 2, Column: 0}},
+	}
+	d := NewDiagnostics(0)
+	for _, e := range errors {
+		d.Add(e)
+	}
+	messages := []string{}
+	for _, e := range d.Sorted() {
+		messages = append(messages, e.Message)
+	}
+	if want := []string{"a", "b1", "b2", "c"}; !reflect.DeepEqual(messages, want) {
+		t.Errorf("sorted = %v, want %v", messages, want)
+	}
+	if d.Errors()[0].Message != "c" {
+		t.Errorf("Sorted reordered the errors of the collector")
+	}
+}
+
+//the compilation stops after the most errors, also across phases
+func TestCompileMaxErrors(t *testing.T) {
+	var src strings.Builder
+	src.WriteString("x : int;\n{\n")
+	for _, name := range []string{"a", "b", "c", "d", "e", "f"} {
+		src.WriteString("  x = " + name + ";\n")
+	}
+	src.WriteString("}\n")
+	for _, max := range []int{0, 3} {
+		result, err := Compile(src.String(), Options{Diagnostics: NewDiagnostics(max)})
+		want := 6
+		if max > 0 {
+			want = max
+		}
+		if err == nil || len(result.Errors) != want {
+			t.Errorf("max %d: %d errors, want %d: %v", max, len(result.Errors), want, result.Errors)
+		}
+	}
+	result, _ := Compile("x : int;\n{ x = 1 +; x = a; }\n", Options{Diagnostics: NewDiagnostics(1)})
+	if len(result.Errors) != 1 || result.Errors[0].Code != CodeSyntax {
+		t.Errorf("a syntax error did not stop the compilation: %v", result.Errors)
+	}
+}
+
+func TestSetErrorEnds(t *testing.T) {
+	src := "x : int;\n{ x = count + 1; }\n"
+	errors := []ErrorType{
+		{Message: "undefined", Pos: Position{Line: 1, Column: 6, Offset: 15}},
+		{Message: "kept", Pos: Position{Line: 1, Column: 2, Offset: 11}, End: Position{Line: 1, Column: 3, Offset: 12}},
+	}
+	SetErrorEnds(src, errors)
+	if want := (Position{Line: 1, Column: 11, Offset: 20}); errors[0].End != want {
+		t.Errorf("the end of count is %v, want %v", errors[0].End, want)
+	}
+	if errors[1].End.Column != 3 {
+		t.Errorf("SetErrorEnds changed an end: %v", errors[1].End)
+	}
+}
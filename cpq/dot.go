@@ -0,0 +1,245 @@
+package cpq
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+//Graphviz DOT forms of a syntax tree and of the control flow graph of generated code,
+//drawn with dot -Tsvg graph.dot > graph.svg to see how statements become jumps
+
+var positionType = reflect.TypeOf(Position{})
+
+// ASTDot returns the syntax tree of program as a Graphviz digraph: a box for every
+// node, with its kind and the fields that are not nodes, and an arrow to every child
+// labeled with its field. The declarations of the same enum or struct point to one box.
+func ASTDot(program *Program) string {
+	w := &dotWriter{boxes: map[uintptr]string{}}
+	w.b.WriteString("digraph ast {\n\tnode [shape=box, fontname=\"monospace\"];\n")
+	w.astNode(reflect.ValueOf(program))
+	w.b.WriteString("}\n")
+	return w.b.String()
+}
+
+//writes a digraph
+type dotWriter struct {
+	b     strings.Builder
+	count int                // boxes written
+	boxes map[uintptr]string // the boxes of the pointers written
+}
+
+//writes a box named name with lines of text
+func (w *dotWriter) box(name string, lines []string) {
+	fmt.Fprintf(&w.b, "\t%s [label=%s];\n", name, dotLabel(lines))
+}
+
+//writes an arrow from a box to another
+func (w *dotWriter) arrow(from, to, label string) {
+	if label == "" {
+		fmt.Fprintf(&w.b, "\t%s -> %s;\n", from, to)
+		return
+	}
+	fmt.Fprintf(&w.b, "\t%s -> %s [label=%s];\n", from, to, strconv.Quote(label))
+}
+
+//writes the box of v, a struct or a pointer to one, and the boxes of its children, and
+//returns the name of its box
+func (w *dotWriter) astNode(v reflect.Value) string {
+	name := "n" + strconv.Itoa(w.count)
+	if v.Kind() == reflect.Ptr {
+		if box, ok := w.boxes[v.Pointer()]; ok {
+			return box
+		}
+		w.boxes[v.Pointer()] = name
+		v = v.Elem()
+	}
+	w.count++
+	lines := []string{v.Type().Name()}
+	type child struct {
+		field string
+		value reflect.Value
+	}
+	children := []child{}
+	for i := 0; i < v.NumField(); i++ {
+		field, value := v.Type().Field(i), v.Field(i)
+		if field.PkgPath != "" || value.Type() == positionType {
+			continue
+		}
+		switch value.Kind() {
+		case reflect.Interface, reflect.Ptr:
+			if !value.IsNil() {
+				children = append(children, child{field.Name, value})
+			}
+		case reflect.Struct:
+			children = append(children, child{field.Name, value})
+		case reflect.Slice:
+			if kind := value.Type().Elem().Kind(); kind == reflect.Struct || kind == reflect.Ptr || kind == reflect.Interface {
+				for j := 0; j < value.Len(); j++ {
+					if element := value.Index(j); kind == reflect.Struct || !element.IsNil() {
+						children = append(children, child{field.Name + "[" + strconv.Itoa(j) + "]", element})
+					}
+				}
+				continue
+			}
+			fallthrough
+		default:
+			if text := dotValue(value); text != "" {
+				lines = append(lines, field.Name+": "+text)
+			}
+		}
+	}
+	w.box(name, lines)
+	for _, c := range children {
+		value := c.value
+		if value.Kind() == reflect.Interface {
+			value = value.Elem()
+		}
+		w.arrow(name, w.astNode(value), c.field)
+	}
+	return name
+}
+
+//returns the text of a field that is not a node, "" to leave it out
+func dotValue(v reflect.Value) string {
+	switch v.Type() {
+	case dataTypeType:
+		if t := DataType(v.Int()); t != Unknown {
+			return t.String()
+		}
+		return ""
+	case operatorType:
+		return operatorSymbols[Operator(v.Int())]
+	case reflect.TypeOf(rune(0)):
+		return strconv.QuoteRune(rune(v.Int()))
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		if v.Bool() {
+			return "true"
+		}
+	case reflect.Int, reflect.Int64:
+		return strconv.FormatInt(v.Int(), 10)
+	case reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'g', -1, 64)
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = dotValue(v.Index(i))
+		}
+		return strings.Join(items, ", ")
+	}
+	return ""
+}
+
+//returns a DOT label of left-justified lines
+func dotLabel(lines []string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for _, line := range lines {
+		b.WriteString(strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(line))
+		b.WriteString(`\l`)
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+// CFGDot returns the control flow graph of code as a Graphviz digraph: a box for every
+// basic block, with its instructions and their line numbers in the QUAD output, and an
+// arrow to every block that can run after it. A JMPZ has an arrow labeled with its
+// condition being 0 and one with it being another value; a call is a JUMP to the
+// function, and its return a JMPZ to every call site. The code may be labeled, as
+// CodegenInstructions returns it, or resolved, as ResolveLabels or ParseInstructions of a
+// QUAD file return it.
+func CFGDot(code []Instruction) string {
+	//the instructions that the operand of a jump, a label or a line number, stands for
+	targets := map[string]int{}
+	line := 0
+	for n, ins := range code {
+		switch {
+		case ins.Label != "":
+			targets[ins.Label] = n
+		case !strings.HasPrefix(ins.Op, "#"):
+			line++
+			targets[strconv.Itoa(line)] = n
+		}
+	}
+	target := func(ins Instruction) (int, bool) {
+		if len(ins.Args) == 0 {
+			return 0, false
+		}
+		n, ok := targets[ins.Args[0]]
+		return n, ok
+	}
+
+	// a block starts at the first instruction, at a jump target and after a jump; the
+	// labels defined before a target start its block
+	starts := make([]bool, len(code)+1)
+	starts[0] = true
+	for n, ins := range code {
+		switch ins.Op {
+		case "JUMP", "JMPZ":
+			if to, ok := target(ins); ok {
+				starts[to] = true
+			}
+			fallthrough
+		case "HALT":
+			starts[n+1] = true
+		}
+	}
+	for n := len(code) - 1; n > 0; n-- {
+		if starts[n] && code[n-1].Label != "" {
+			starts[n], starts[n-1] = false, true
+		}
+	}
+	blocks := make([]int, len(code)) // the block of every instruction
+	count := 0
+	for n := range code {
+		if starts[n] && n > 0 {
+			count++
+		}
+		blocks[n] = count
+	}
+
+	w := &dotWriter{}
+	w.b.WriteString("digraph cfg {\n\tnode [shape=box, fontname=\"monospace\"];\n")
+	line = 0
+	for first := 0; first < len(code); {
+		lines := []string{}
+		last := first
+		for ; last < len(code) && (last == first || !starts[last]); last++ {
+			ins := code[last]
+			if ins.Label != "" || strings.HasPrefix(ins.Op, "#") {
+				lines = append(lines, ins.String())
+				continue
+			}
+			line++
+			lines = append(lines, fmt.Sprintf("%4d  %s", line, ins))
+		}
+		block := "b" + strconv.Itoa(blocks[first])
+		w.box(block, lines)
+		ins := code[last-1]
+		switch to, ok := target(ins); {
+		case ins.Op == "HALT":
+		case ins.Op == "JUMP":
+			if ok {
+				w.arrow(block, "b"+strconv.Itoa(blocks[to]), "")
+			}
+		case ins.Op == "JMPZ" && len(ins.Args) > 1:
+			if ok {
+				w.arrow(block, "b"+strconv.Itoa(blocks[to]), ins.Args[1]+" == 0")
+			}
+			if last < len(code) {
+				w.arrow(block, "b"+strconv.Itoa(blocks[last]), ins.Args[1]+" != 0")
+			}
+		case last < len(code):
+			w.arrow(block, "b"+strconv.Itoa(blocks[last]), "")
+		}
+		first = last
+	}
+	w.b.WriteString("}\n")
+	return w.b.String()
+}
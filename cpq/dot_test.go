@@ -0,0 +1,97 @@
+package cpq
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestASTDot(t *testing.T) {
+	program, errors := Parse("a : int;\n{ a = a + 1; }\n")
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	want := `digraph ast {
+	node [shape=box, fontname="monospace"];
+	n0 [label="Program\l"];
+	n1 [label="Declaration\lNames: a\lSizes: 0\lType: int\l"];
+	n0 -> n1 [label="Declarations[0]"];
+	n2 [label="Block\l"];
+	n3 [label="Assignment\lVariable: a\l"];
+	n4 [label="Arithmetic\lOperator: +\l"];
+	n5 [label="Variable\lVariable: a\l"];
+	n4 -> n5 [label="LHS"];
+	n6 [label="IntNum\lValue: 1\l"];
+	n4 -> n6 [label="RHS"];
+	n3 -> n4 [label="Val"];
+	n2 -> n3 [label="Statements[0]"];
+	n0 -> n2 [label="StatementsBlock"];
+}
+`
+	if got := ASTDot(program); got != want {
+		t.Errorf("ASTDot =\n%s\nwant\n%s", got, want)
+	}
+	//the declarations of one enum point to its box
+	program, _ = Parse("c, d : enum { red, green };\n{ c = red; }\n")
+	if got := ASTDot(program); strings.Count(got, `[label="Enum\l`) != 1 {
+		t.Errorf("the enum has no box or more than one:\n%s", got)
+	}
+}
+
+//the arrows of a digraph
+func dotArrows(graph string) []string {
+	arrows := []string{}
+	for _, line := range strings.Split(graph, "\n") {
+		if strings.Contains(line, "->") {
+			arrows = append(arrows, strings.TrimSpace(line))
+		}
+	}
+	return arrows
+}
+
+func TestCFGDot(t *testing.T) {
+	program, _ := Parse("a : int;\n{ input(a); while (a < 3) a = a + 1; output(a); }\n")
+	code, errors, _ := CodegenInstructions(program, Options{})
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	want := `digraph cfg {
+	node [shape=box, fontname="monospace"];
+	b0 [label="   1  IINP a\l"];
+	b0 -> b1;
+	b1 [label="@1:\l   2  ILSS _t1 a 3\l   3  JMPZ @2 _t1\l"];
+	b1 -> b3 [label="_t1 == 0"];
+	b1 -> b2 [label="_t1 != 0"];
+	b2 [label="   4  IADD a a 1\l   5  JUMP @1\l"];
+	b2 -> b1;
+	b3 [label="@2:\l   6  IPRT a\l   7  HALT\l"];
+}
+`
+	if got := CFGDot(code); got != want {
+		t.Errorf("CFGDot =\n%s\nwant\n%s", got, want)
+	}
+	resolved, err := ResolveLabels(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if labeled, lines := dotArrows(want), dotArrows(CFGDot(resolved)); strings.Join(lines, "\n") != strings.Join(labeled, "\n") {
+		t.Errorf("the resolved code has the arrows\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(labeled, "\n"))
+	}
+}
+
+//a call jumps to the function, which returns to every call site
+func TestCFGDotCalls(t *testing.T) {
+	program, _ := Parse("a : int;\nfunc f() : int { return 1; }\n{ a = f(); a = f(); output(a); }\n")
+	code, errors, _ := CodegenInstructions(program, Options{})
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	returns := 0
+	for _, arrow := range dotArrows(CFGDot(code)) {
+		if strings.Contains(arrow, " == 0") {
+			returns++
+		}
+	}
+	if returns != 2 {
+		t.Errorf("the function returns to %d call sites, want 2:\n%s", returns, CFGDot(code))
+	}
+}
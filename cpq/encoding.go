@@ -0,0 +1,123 @@
+package cpq
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+//source encodings understood by Decode.
+const (
+	EncodingAuto    = "auto"
+	EncodingUTF8    = "utf-8"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingLatin1  = "latin-1"
+)
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+//returns the canonical name of an encoding, or "" if it is not supported
+func normalizeEncoding(name string) string {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", "auto":
+		return EncodingAuto
+	case "utf-8", "utf8":
+		return EncodingUTF8
+	case "utf-16le", "utf16le", "utf-16", "utf16":
+		return EncodingUTF16LE
+	case "utf-16be", "utf16be":
+		return EncodingUTF16BE
+	case "latin-1", "latin1", "iso-8859-1", "iso8859-1":
+		return EncodingLatin1
+	}
+	return ""
+}
+
+// Decode transcodes raw source bytes to a UTF-8 string before scanning.
+// With EncodingAuto the encoding is taken from a byte order mark, falling back
+// to UTF-8 when the input is valid UTF-8, UTF-16 when it looks like it, and latin-1 otherwise.
+func Decode(data []byte, encoding string) (string, error) {
+	enc := normalizeEncoding(encoding)
+	if enc == "" {
+		return "", fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	if enc == EncodingAuto {
+		enc = detectEncoding(data)
+	}
+	switch enc {
+	case EncodingUTF8:
+		data = bytes.TrimPrefix(data, bomUTF8)
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("input is not valid UTF-8")
+		}
+		return string(data), nil
+	case EncodingUTF16LE:
+		return decodeUTF16(bytes.TrimPrefix(data, bomUTF16LE), false)
+	case EncodingUTF16BE:
+		return decodeUTF16(bytes.TrimPrefix(data, bomUTF16BE), true)
+	}
+	return decodeLatin1(data), nil
+}
+
+func detectEncoding(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return EncodingUTF8
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return EncodingUTF16LE
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return EncodingUTF16BE
+	}
+	// ASCII text saved as UTF-16 without a BOM has a zero in every other byte
+	if len(data) >= 2 && len(data)%2 == 0 {
+		even, odd := 0, 0
+		for i := 0; i < len(data); i += 2 {
+			if data[i] == 0 {
+				even++
+			}
+			if data[i+1] == 0 {
+				odd++
+			}
+		}
+		if half := len(data) / 2; odd == half && even == 0 {
+			return EncodingUTF16LE
+		} else if even == half && odd == 0 {
+			return EncodingUTF16BE
+		}
+	}
+	if utf8.Valid(data) {
+		return EncodingUTF8
+	}
+	return EncodingLatin1
+}
+
+func decodeUTF16(data []byte, bigEndian bool) (string, error) {
+	if len(data)%2 != 0 {
+		return "", fmt.Errorf("UTF-16 input has an odd number of bytes")
+	}
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+func decodeLatin1(data []byte) string {
+	var buf strings.Builder
+	buf.Grow(len(data))
+	for _, b := range data {
+		buf.WriteRune(rune(b))
+	}
+	return buf.String()
+}
@@ -0,0 +1,87 @@
+package cpq
+
+import (
+	"testing"
+	"unicode/utf16"
+)
+
+//returns s in UTF-16, big endian or little endian
+func utf16Bytes(s string, bigEndian bool) []byte {
+	var data []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if bigEndian {
+			data = append(data, byte(unit>>8), byte(unit))
+		} else {
+			data = append(data, byte(unit), byte(unit>>8))
+		}
+	}
+	return data
+}
+
+func TestDecode(t *testing.T) {
+	src := "a : int; /* é π */\n{ a = 1; }\n"
+	ascii := "a : int;\n{ a = 1; }\n"
+	tests := []struct {
+		name     string
+		data     []byte
+		encoding string
+		want     string
+	}{
+		{"utf-8", []byte(src), EncodingAuto, src},
+		{"utf-8 with a BOM", append([]byte{0xEF, 0xBB, 0xBF}, src...), EncodingAuto, src},
+		{"utf-8 given", append([]byte{0xEF, 0xBB, 0xBF}, src...), "UTF8", src},
+		{"utf-16le with a BOM", append([]byte{0xFF, 0xFE}, utf16Bytes(src, false)...), EncodingAuto, src},
+		{"utf-16be with a BOM", append([]byte{0xFE, 0xFF}, utf16Bytes(src, true)...), EncodingAuto, src},
+		{"utf-16le without a BOM", utf16Bytes(ascii, false), EncodingAuto, ascii},
+		{"utf-16be without a BOM", utf16Bytes(ascii, true), EncodingAuto, ascii},
+		{"utf-16be given", utf16Bytes(src, true), EncodingUTF16BE, src},
+		{"utf-16 is little endian", utf16Bytes(src, false), "utf-16", src},
+		{"latin-1", []byte("a : int; /* \xe9 */\n"), EncodingAuto, "a : int; /* é */\n"},
+		{"latin-1 given", []byte("/* \xc3\xa9 */"), "ISO-8859-1", "/* Ã© */"},
+	}
+	for _, test := range tests {
+		got, err := Decode(test.data, test.encoding)
+		if err != nil || got != test.want {
+			t.Errorf("%s: Decode = %q, %v, want %q", test.name, got, err, test.want)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		data     []byte
+		encoding string
+		want     string
+	}{
+		{[]byte("a"), "ebcdic", `unsupported encoding "ebcdic"`},
+		{[]byte("/* \xe9 */"), EncodingUTF8, "input is not valid UTF-8"},
+		{[]byte{0xFF, 0xFE, 'a'}, EncodingAuto, "UTF-16 input has an odd number of bytes"},
+	}
+	for _, test := range tests {
+		if _, err := Decode(test.data, test.encoding); err == nil || err.Error() != test.want {
+			t.Errorf("Decode(%q, %s) error = %v, want %s", test.data, test.encoding, err, test.want)
+		}
+	}
+}
+
+//a program decoded from any encoding compiles to the same code
+func TestCompileDecoded(t *testing.T) {
+	src := "a : int; /* é */\n{ input(a); output(a * 2); }\n"
+	want, err := Compile(src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, data := range [][]byte{
+		append([]byte{0xFF, 0xFE}, utf16Bytes(src, false)...),
+		append([]byte{0xFE, 0xFF}, utf16Bytes(src, true)...),
+		[]byte("a : int; /* \xe9 */\n{ input(a); output(a * 2); }\n"),
+	} {
+		decoded, err := Decode(data, EncodingAuto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result, err := Compile(decoded, Options{}); err != nil || result.Quad != want.Quad {
+			t.Errorf("%q compiles to:\n%s", data, result.Quad)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package cpq
+
+import (
+	"math"
+	"strconv"
+)
+
+//constant folding: an operation whose operands are all literals is computed while the code
+//is generated, the same way the QUAD instructions compute it, and its result is used as a literal
+
+//returns the value of an operand that is a literal
+func literal(exp *Expression) (value, bool) {
+	if exp.Code == "" || !(digit(rune(exp.Code[0])) || exp.Code[0] == '-') {
+		return value{}, false
+	}
+	t := exp.Type
+	if t != Float {
+		t = Integer
+	}
+	v, err := parseValue(exp.Code, t)
+	return v, err == nil
+}
+
+//returns the literal operand of a value, false for a float with no literal like 1 / 0.0
+func literalCode(v value) (string, bool) {
+	if v.Type != Float {
+		return strconv.FormatInt(v.Int, 10), true
+	}
+	if math.IsInf(v.Float, 0) || math.IsNaN(v.Float) {
+		return "", false
+	}
+	//the usual six decimals, or as many as needed to keep the exact value
+	code := strconv.FormatFloat(v.Float, 'f', 6, 64)
+	if f, _ := strconv.ParseFloat(code, 64); f != v.Float {
+		code = strconv.FormatFloat(v.Float, 'f', -1, 64)
+	}
+	return code, true
+}
+
+//reports whether an operand is the literal 0 or 0.0, also after a constant was
+//substituted or an expression folded
+func zeroLiteral(exp *Expression) bool {
+	v, ok := literal(exp)
+	return ok && v.Int == 0 && v.Float == 0
+}
+
+//folds lhs operator rhs, nil when an operand is not a literal or the operation fails at
+//run time, like a division by zero
+func foldArithmetic(operator Operator, resultType DataType, lhs, rhs *Expression) *Expression {
+	a, ok := literal(lhs)
+	if !ok {
+		return nil
+	}
+	b, ok := literal(rhs)
+	if !ok {
+		return nil
+	}
+	v, err := arithmetic(operator, a, b)
+	if err != nil {
+		return nil
+	}
+	code, ok := literalCode(v)
+	if !ok {
+		return nil
+	}
+	return &Expression{Code: code, Type: resultType}
+}
+
+//folds a comparison of two literals; ok is false when an operand is not a literal
+func foldCompare(operator Operator, lhs, rhs *Expression, epsilon float64) (result, ok bool) {
+	a, ok := literal(lhs)
+	if !ok {
+		return false, false
+	}
+	b, ok := literal(rhs)
+	if !ok {
+		return false, false
+	}
+	return compare(operator, a, b, epsilon), true
+}
+
+//folds a cast of a literal
+func foldCast(exp *Expression, targetType DataType) *Expression {
+	v, ok := literal(exp)
+	if !ok {
+		return nil
+	}
+	code, ok := literalCode(v.cast(targetType))
+	if !ok {
+		return nil
+	}
+	return &Expression{Code: code, Type: targetType}
+}
+
+//returns the 0 or 1 literal of a condition
+func truth(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+//returns the value of a condition code that is a literal
+func truthLiteral(code string) (bool, bool) {
+	v, ok := literal(&Expression{Code: code, Type: Integer})
+	return v.Int != 0, ok
+}
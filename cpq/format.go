@@ -0,0 +1,91 @@
+package cpq
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+//version of the compiler, recorded in build metadata
+const Version = "1.1.0"
+
+//layout of the final .qud file
+type OutputFormat struct {
+	CRLF                 bool // end lines with "\r\n" instead of "\n"
+	TrailingNewline      bool // end the file with a line terminator
+	BlankBeforeSignature bool // put an empty line between HALT and the signature
+}
+
+//the layout the compiler has always produced
+var DefaultOutputFormat = OutputFormat{BlankBeforeSignature: true}
+
+// FormatOutput joins resolved QUAD and the trailer lines (the signature and any
+// metadata) into the contents of the output file.
+func FormatOutput(quad string, format OutputFormat, trailer ...string) string {
+	lines := strings.Split(strings.TrimSuffix(quad, "\n"), "\n")
+	if len(trailer) > 0 {
+		if format.BlankBeforeSignature {
+			lines = append(lines, "")
+		}
+		lines = append(lines, trailer...)
+	}
+	newline := "\n"
+	if format.CRLF {
+		newline = "\r\n"
+	}
+	result := strings.Join(lines, newline)
+	if format.TrailingNewline {
+		result += newline
+	}
+	return result
+}
+
+// NumberLines prefixes every instruction of resolved QUAD with its line number, as the
+// course interpreter displays them, so JUMP and JMPZ targets can be followed by eye.
+func NumberLines(quad string) string {
+	lines := strings.Split(strings.TrimSuffix(quad, "\n"), "\n")
+	width := len(strconv.Itoa(len(lines)))
+	var b strings.Builder
+	number := 0
+	for _, line := range lines {
+		// symbolic labels and source comments are not instructions
+		if isLabelLine(line) || strings.HasPrefix(line, "#") {
+			fmt.Fprintf(&b, "%*s  %s\n", width, "", line)
+			continue
+		}
+		number++
+		fmt.Fprintf(&b, "%*d  %s\n", width, number, line)
+	}
+	return b.String()
+}
+
+//describes how a .qud file was produced, so graders can verify a submission
+type Metadata struct {
+	Version string
+	Source  string   // name of the source file
+	SHA256  string   // hex digest of the source bytes
+	Options []string // command line options used
+}
+
+//returns the metadata of compiling the given source
+func NewMetadata(source string, data []byte, options []string) Metadata {
+	sum := sha256.Sum256(data)
+	return Metadata{
+		Version: Version,
+		Source:  source,
+		SHA256:  hex.EncodeToString(sum[:]),
+		Options: options,
+	}
+}
+
+//returns the metadata as comment lines, written after HALT where interpreters ignore them
+func (m Metadata) Lines() []string {
+	return []string{
+		"# cpq-version: " + m.Version,
+		"# source: " + m.Source,
+		"# source-sha256: " + m.SHA256,
+		"# options: " + strings.Join(m.Options, " "),
+	}
+}
@@ -0,0 +1,30 @@
+package cpq
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetadata(t *testing.T) {
+	m := NewMetadata("prog.ou", []byte("a : int;\n{ a = 1; }\n"), []string{"--keep-labels=true", "--std=cpl"})
+	want := []string{
+		"# cpq-version: " + Version,
+		"# source: prog.ou",
+		"# source-sha256: 53b70de11a1f6f17e417ea59b4a6d9428861d59d0193a33bfa72e0da4db1236a",
+		"# options: --keep-labels=true --std=cpl",
+	}
+	if got := m.Lines(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("lines:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	if m.SHA256 != NewMetadata("other.ou", []byte("a : int;\n{ a = 1; }\n"), nil).SHA256 {
+		t.Errorf("the hash %s is not of the source bytes alone", m.SHA256)
+	}
+	if m.SHA256 == NewMetadata("prog.ou", []byte("a : int;\r\n{ a = 1; }\r\n"), nil).SHA256 {
+		t.Error("sources with other bytes have the same hash")
+	}
+	//the metadata follows the signature, after HALT where interpreters ignore it
+	output := FormatOutput("IASN a 1\nHALT\n", DefaultOutputFormat, append([]string{"signature"}, m.Lines()...)...)
+	if !strings.HasPrefix(output, "IASN a 1\nHALT\n\nsignature\n# cpq-version: ") || !strings.HasSuffix(output, "--std=cpl") {
+		t.Errorf("output:\n%s", output)
+	}
+}
@@ -0,0 +1,137 @@
+package cpq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Instruction is an instruction of the generated code, or the definition of Label.
+// Operands that are labels, like the target of JUMP, are names starting with '@'
+// until ResolveLabels replaces them with line numbers.
+type Instruction struct {
+	Label     string
+	Op        string
+	Args      []string
+	Pos       Position // statement the instruction was generated for
+	Statement bool     // first instruction of that statement
+}
+
+//returns the line of QUAD text of the instruction, with the opcode spelled by opcodes
+func (ins Instruction) format(opcodes map[string]string) string {
+	if ins.Label != "" {
+		return ins.Label + ":"
+	}
+	op := ins.Op
+	if name, ok := opcodes[op]; ok {
+		op = name
+	}
+	if len(ins.Args) == 0 {
+		return op
+	}
+	return op + " " + strings.Join(ins.Args, " ")
+}
+
+func (ins Instruction) String() string {
+	return ins.format(nil)
+}
+
+// FormatInstructions returns code as QUAD text, a line per instruction or label
+// definition, with the opcodes spelled by opcodes (nil for the standard spelling).
+func FormatInstructions(code []Instruction, opcodes map[string]string) string {
+	var b strings.Builder
+	for _, ins := range code {
+		b.WriteString(ins.format(opcodes))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// FormatWithSource formats code like FormatInstructions, preceding the instructions of
+// every statement with a comment line giving the position of the statement and its line
+// of src, "# line 3, char 5: a = b + 1;", and the instructions the compiler adds at the
+// end of a block, like the HALT of the main block, with the position of its }. The
+// comments are for reading the output: jump targets do not count them, so interpreters
+// that number every line cannot run it.
+func FormatWithSource(code []Instruction, src string, opcodes map[string]string) string {
+	index := NewLineIndex(src)
+	var b strings.Builder
+	pos := Position{Line: -1}
+	for _, ins := range code {
+		if ins.Label != "" {
+			b.WriteString(ins.format(opcodes))
+			b.WriteByte('\n')
+			continue
+		}
+		if ins.Statement || ins.Pos != pos {
+			pos = ins.Pos
+			fmt.Fprintf(&b, "# line %d, char %d: %s\n", ins.Pos.Line+1, ins.Pos.Column+1,
+				strings.TrimSpace(index.Line(ins.Pos.Line)))
+		}
+		b.WriteString(ins.format(opcodes))
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+// ParseInstructions reads QUAD text, labeled or resolved, into instructions. A line
+// ending with ':' defines a label, and a quoted operand, like the string of
+// --string-opcode, is kept whole even when it has spaces.
+func ParseInstructions(quad string) []Instruction {
+	var code []Instruction
+	for _, line := range strings.Split(strings.TrimSuffix(quad, "\n"), "\n") {
+		if ins, ok := parseInstruction(line); ok {
+			code = append(code, ins)
+		}
+	}
+	return code
+}
+
+//reads a line of QUAD, false for an empty line
+func parseInstruction(line string) (Instruction, bool) {
+	switch {
+	case isLabelLine(line):
+		return Instruction{Label: line[:len(line)-1]}, true
+	case strings.HasPrefix(line, "#"):
+		return Instruction{Op: line}, true
+	}
+	fields := splitOperands(line)
+	if len(fields) == 0 {
+		return Instruction{}, false
+	}
+	return Instruction{Op: fields[0], Args: fields[1:]}, true
+}
+
+//splits a line of QUAD at spaces outside of quoted operands
+func splitOperands(line string) []string {
+	var fields []string
+	for line = strings.TrimLeft(line, " \t"); line != ""; line = strings.TrimLeft(line, " \t") {
+		end := strings.IndexAny(line, " \t")
+		if line[0] == '"' {
+			if quoted, err := strconv.QuotedPrefix(line); err == nil {
+				end = len(quoted)
+			}
+		}
+		if end < 0 {
+			end = len(line)
+		}
+		fields = append(fields, line[:end])
+		line = line[end:]
+	}
+	return fields
+}
+
+//returns args with the operands that are keys of names replaced, copying args if one is
+func renameOperands(args []string, names map[string]string) []string {
+	copied := false
+	for n, arg := range args {
+		if name, ok := names[arg]; ok {
+			if !copied {
+				args = append([]string(nil), args...)
+				copied = true
+			}
+			args[n] = name
+		}
+	}
+	return args
+}
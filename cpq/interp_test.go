@@ -0,0 +1,535 @@
+package cpq
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+//most statements or instructions a program may execute before it is stopped
+const defaultMaxSteps = 10000000
+
+//returned inside the interpreters when a program halts before its end
+var errHalt = errors.New("halt")
+
+//how a statement ended
+type control int
+
+const (
+	controlNext control = iota
+	controlBreak
+	controlContinue
+	controlReturn
+)
+
+//executes a CPL program directly from its syntax tree, without generating code.
+//Its output is the reference the compiled QUAD is checked against.
+type interpreter struct {
+	FloatEpsilon   float64 // as in CodeGen
+	HaltOnBadInput bool    // as in CodeGen
+	SwitchBreak    bool    // as in CodeGen
+	MaxSteps       int     // statements executed before the program is stopped, 0 for no limit
+	input          *bufio.Scanner
+	output         *bufio.Writer
+	variables      map[string]value
+	functions      map[string]*Function
+	frame          map[string]value // parameters and locals of the running function
+	result         value            // value of the last return
+	steps          int
+}
+
+//returns new interpreter reading input values from in and writing output to out.
+func newInterpreter(in io.Reader, out io.Writer) *interpreter {
+	input := bufio.NewScanner(in)
+	input.Split(bufio.ScanWords)
+	return &interpreter{
+		MaxSteps:  defaultMaxSteps,
+		input:     input,
+		output:    bufio.NewWriter(out),
+		variables: map[string]value{},
+		functions: map[string]*Function{},
+	}
+}
+
+//runs a program that parsed and generated without errors. Values are read from in
+//separated by white space; every output is written to out on its own line.
+func interpret(program *Program, in io.Reader, out io.Writer, opts Options) error {
+	i := newInterpreter(in, out)
+	i.FloatEpsilon = opts.FloatEpsilon
+	i.HaltOnBadInput = opts.HaltOnBadInput
+	i.SwitchBreak = opts.SwitchBreak
+	return i.run(program)
+}
+
+//executes the program, flushing its output even when it fails
+func (i *interpreter) run(program *Program) error {
+	for _, declaration := range program.Declarations {
+		declare(i.variables, declaration)
+	}
+	for _, function := range program.Functions {
+		i.functions[function.Name] = function
+	}
+	_, err := i.statement(program.StatementsBlock)
+	if err == errHalt {
+		err = nil
+	}
+	if flushErr := i.output.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+//executes a statement, returning whether it ended with a break or a return
+func (i *interpreter) statement(node Statement) (control, error) {
+	i.steps++
+	if i.MaxSteps > 0 && i.steps > i.MaxSteps {
+		return controlNext, fmt.Errorf("program executed more than %d statements", i.MaxSteps)
+	}
+	switch s := node.(type) {
+	case *Assignment:
+		if _, err := i.assignment(s); err != nil {
+			return controlNext, err
+		}
+	case *Input:
+		return controlNext, i.read(s)
+	case *Output:
+		if str, ok := s.Value.(*StringLiteral); ok {
+			// the character codes, as the IPRT instructions of the generated code print them
+			for _, ch := range str.Value {
+				i.output.WriteString(strconv.Itoa(int(ch)))
+				i.output.WriteByte('\n')
+			}
+			break
+		}
+		v, err := i.expression(s.Value)
+		if err != nil {
+			return controlNext, err
+		}
+		i.output.WriteString(formatValue(v))
+		i.output.WriteByte('\n')
+	case *IfStatement:
+		condition, err := i.boolean(s.Condition)
+		if err != nil {
+			return controlNext, err
+		}
+		if condition {
+			return i.statement(s.IfBranch)
+		} else if s.ElseBranch != nil {
+			return i.statement(s.ElseBranch)
+		}
+	case *WhileStatement:
+		return i.loop(s.Condition, s.Body, nil)
+	case *ForStatement:
+		if s.Init != nil {
+			if _, err := i.statement(s.Init); err != nil {
+				return controlNext, err
+			}
+		}
+		return i.loop(s.Condition, s.Body, s.Step)
+	case *DoWhileStatement:
+		for {
+			flow, err := i.statement(s.Body)
+			if err != nil || flow == controlReturn {
+				return flow, err
+			}
+			if flow == controlBreak {
+				return controlNext, nil
+			}
+			if condition, err := i.boolean(s.Condition); err != nil || !condition {
+				return controlNext, err
+			}
+		}
+	case *Switch:
+		return i.switchStatement(s)
+	case *Break:
+		return controlBreak, nil
+	case *Continue:
+		return controlContinue, nil
+	case *Call:
+		_, err := i.call(s)
+		return controlNext, err
+	case *Return:
+		if s.Value != nil {
+			v, err := i.expression(s.Value)
+			if err != nil {
+				return controlNext, err
+			}
+			i.result = v
+		}
+		return controlReturn, nil
+	case *Block:
+		return i.statements(s.Statements)
+	}
+	return controlNext, nil
+}
+
+//runs a loop, with an optional step after every iteration
+func (i *interpreter) loop(conditionNode Boolean, body, step Statement) (control, error) {
+	for {
+		condition, err := i.boolean(conditionNode)
+		if err != nil || !condition {
+			return controlNext, err
+		}
+		flow, err := i.statement(body)
+		if err != nil || flow == controlReturn {
+			return flow, err
+		}
+		if flow == controlBreak {
+			return controlNext, nil
+		}
+		if step != nil {
+			if _, err := i.statement(step); err != nil {
+				return controlNext, err
+			}
+		}
+	}
+}
+
+func (i *interpreter) statements(statements []Statement) (control, error) {
+	for _, statement := range statements {
+		flow, err := i.statement(statement)
+		if err != nil || flow != controlNext {
+			return flow, err
+		}
+	}
+	return controlNext, nil
+}
+
+//runs the matching case and every case after it, up to a break
+func (i *interpreter) switchStatement(node *Switch) (control, error) {
+	v, err := i.expression(node.Expression)
+	if err != nil {
+		return controlNext, err
+	}
+	start := len(node.Cases)
+cases:
+	for n, switchCase := range node.Cases {
+		for _, label := range switchCase.Labels {
+			if label.Min <= v.Int && v.Int <= label.Max {
+				start = n
+				break cases
+			}
+		}
+	}
+	flow := controlNext
+	for _, switchCase := range node.Cases[start:] {
+		statements, falls := caseStatements(switchCase.Statements)
+		if flow, err = i.statements(statements); err != nil || flow != controlNext {
+			break
+		}
+		if i.SwitchBreak && !falls {
+			flow = controlBreak
+			break
+		}
+	}
+	if err == nil && flow == controlNext {
+		flow, err = i.statements(node.DefaultCase)
+	}
+	if flow == controlBreak {
+		flow = controlNext
+	}
+	return flow, err
+}
+
+//returns the type of an expression, as the code generator finds it
+func (i *interpreter) expressionType(node NodeExpression) DataType {
+	return expressionType(node, func(name string) DataType {
+		return i.lookup(name).Type
+	}, func(name string) DataType {
+		if function := i.functions[name]; function != nil {
+			return function.ReturnType
+		}
+		return Unknown
+	})
+}
+
+//calls a function with a frame of its own, so that recursion works here even though
+//the code generator rejects it
+func (i *interpreter) call(node *Call) (value, error) {
+	function := i.functions[node.Function]
+	if _, isBuiltin := builtins[node.Function]; isBuiltin && function == nil {
+		return i.builtin(node)
+	}
+	if function == nil {
+		return value{}, fmt.Errorf("undefined function %s", node.Function)
+	}
+	frame := map[string]value{}
+	for n, param := range function.Params {
+		v, err := i.expression(node.Args[n])
+		if err != nil {
+			return value{}, err
+		}
+		frame[param.Name] = v.cast(param.Type)
+	}
+	for _, declaration := range function.Declarations {
+		declare(frame, declaration)
+	}
+	caller := i.frame
+	i.frame, i.result = frame, value{Type: function.ReturnType}
+	_, err := i.statement(function.Body)
+	i.frame = caller
+	return i.result.cast(function.ReturnType), err
+}
+
+//adds zero variables, and the elements name[0], name[1]... of arrays
+func declare(variables map[string]value, declaration Declaration) {
+	for n, name := range declaration.Names {
+		variables[name] = value{Type: declaration.Type}
+		switch constant := declaration.Value.(type) {
+		case *IntNum:
+			variables[name] = value{Type: Integer, Int: constant.Value}.cast(declaration.Type)
+		case *FloatNum:
+			variables[name] = value{Type: Float, Float: constant.Value}.cast(declaration.Type)
+		case *BoolLiteral:
+			variables[name] = boolValue(constant.Value)
+		case *CharLiteral:
+			variables[name] = value{Type: Integer, Int: int64(constant.Value)}.cast(declaration.Type)
+		}
+		for k := int64(0); k < declaration.Size(n); k++ {
+			variables[element(name, k)] = value{Type: declaration.Type}
+		}
+	}
+}
+
+func element(array string, index int64) string {
+	return fmt.Sprintf("%s[%d]", array, index)
+}
+
+//returns the variable an assignment or input stores into; an index out of range halts
+//the program, as in the generated code
+func (i *interpreter) target(name string, index NodeExpression) (string, error) {
+	if index == nil {
+		return name, nil
+	}
+	v, err := i.expression(index)
+	if err != nil {
+		return "", err
+	}
+	key := element(name, v.Int)
+	if _, ok := i.frame[key]; ok {
+		return key, nil
+	}
+	if _, ok := i.variables[key]; ok && i.frame[name].Type == Unknown {
+		return key, nil
+	}
+	return "", errHalt
+}
+
+//returns a variable of the running function, or else a global variable
+func (i *interpreter) lookup(name string) value {
+	if v, ok := i.frame[name]; ok {
+		return v
+	}
+	return i.variables[name]
+}
+
+//stores a value converted to the type of the variable
+//runs an assignment and returns the value assigned; the element of a compound assignment,
+//a[i()] += 1, is found once, before the value is computed
+func (i *interpreter) assignment(s *Assignment) (value, error) {
+	if compound, ok := s.Val.(*Arithmetic); ok && s.Index != nil {
+		if element, ok := compound.LHS.(*Element); ok && element.Index == s.Index {
+			name, err := i.target(s.Variable, s.Index)
+			if err != nil {
+				return value{}, err
+			}
+			rhs, err := i.expression(compound.RHS)
+			if err != nil {
+				return value{}, err
+			}
+			v, err := arithmetic(compound.Operator, i.lookup(name), rhs)
+			if err == nil {
+				i.assign(name, v)
+			}
+			return v, err
+		}
+	}
+	v, err := i.expression(s.Val)
+	if err != nil {
+		return value{}, err
+	}
+	name, err := i.target(s.Variable, s.Index)
+	if err != nil {
+		return value{}, err
+	}
+	i.assign(name, v)
+	return v, nil
+}
+
+func (i *interpreter) assign(name string, v value) {
+	if old, ok := i.frame[name]; ok {
+		i.frame[name] = v.cast(old.Type)
+		return
+	}
+	i.variables[name] = v.cast(i.variables[name].Type)
+}
+
+//reads one value into a variable, again until it is in range with input(x in a..b)
+func (i *interpreter) read(node *Input) error {
+	varType := i.lookup(node.Variable).Type
+	for {
+		if !i.input.Scan() {
+			return fmt.Errorf("input of %s: no more input", node.Variable)
+		}
+		v, err := parseValue(i.input.Text(), varType)
+		if err != nil {
+			return fmt.Errorf("input of %s: %s", node.Variable, err)
+		}
+		if node.Min == nil || node.Max == nil {
+			return i.store(node, v)
+		}
+		min, err := i.expression(node.Min)
+		if err != nil {
+			return err
+		}
+		max, err := i.expression(node.Max)
+		if err != nil {
+			return err
+		}
+		if v.float() >= min.float() && v.float() <= max.float() {
+			return i.store(node, v)
+		}
+		if i.HaltOnBadInput {
+			return errHalt
+		}
+	}
+}
+
+//stores a value read by input, evaluating the index after reading like the generated code
+func (i *interpreter) store(node *Input, v value) error {
+	name, err := i.target(node.Variable, node.Index)
+	if err == nil {
+		i.assign(name, v)
+	}
+	return err
+}
+
+func (i *interpreter) expression(node NodeExpression) (value, error) {
+	switch e := node.(type) {
+	case *IntNum:
+		return value{Type: Integer, Int: e.Value}, nil
+	case *FloatNum:
+		return value{Type: Float, Float: e.Value}, nil
+	case *BoolLiteral:
+		return boolValue(e.Value), nil
+	case *CharLiteral:
+		return value{Type: Integer, Int: int64(e.Value)}, nil
+	case *Assignment:
+		return i.assignment(e)
+	case *Conditional:
+		condition, err := i.boolean(e.Condition)
+		if err != nil {
+			return value{}, err
+		}
+		arm := e.Else
+		if condition {
+			arm = e.Then
+		}
+		v, err := i.expression(arm)
+		if t := i.expressionType(e); t != Unknown {
+			v = v.cast(t)
+		}
+		return v, err
+	case *Condition:
+		b, err := i.boolean(e.Value)
+		return boolValue(b), err
+	case *Cast:
+		v, err := i.expression(e.Value)
+		return v.cast(e.Type), err
+	case *Variable:
+		return i.lookup(e.Variable), nil
+	case *Call:
+		return i.call(e)
+	case *Element:
+		name, err := i.target(e.Array, e.Index)
+		if err != nil {
+			return value{}, err
+		}
+		return i.lookup(name), nil
+	case *Arithmetic:
+		lhs, err := i.expression(e.LHS)
+		if err != nil {
+			return value{}, err
+		}
+		rhs, err := i.expression(e.RHS)
+		if err != nil {
+			return value{}, err
+		}
+		return arithmetic(e.Operator, lhs, rhs)
+	}
+	return value{}, fmt.Errorf("cannot evaluate %T", node)
+}
+
+func (i *interpreter) boolean(node Boolean) (bool, error) {
+	switch b := node.(type) {
+	case *Or:
+		// both sides are evaluated: the generated code only skips a right side that is pure
+		lhs, err := i.boolean(b.LHS)
+		if err != nil {
+			return false, err
+		}
+		rhs, err := i.boolean(b.RHS)
+		return lhs || rhs, err
+	case *And:
+		lhs, err := i.boolean(b.LHS)
+		if err != nil {
+			return false, err
+		}
+		rhs, err := i.boolean(b.RHS)
+		return lhs && rhs, err
+	case *Not:
+		value, err := i.boolean(b.Value)
+		return !value, err
+	case *Compare:
+		lhs, err := i.expression(b.LHS)
+		if err != nil {
+			return false, err
+		}
+		rhs, err := i.expression(b.RHS)
+		if err != nil {
+			return false, err
+		}
+		return compare(b.Operator, lhs, rhs, i.FloatEpsilon), nil
+	case *BoolTest:
+		v, err := i.expression(b.Value)
+		return v.Int != 0, err
+	}
+	return false, fmt.Errorf("cannot evaluate %T", node)
+}
+
+//returns a bool value, stored as 1 or 0 like in the generated code
+func boolValue(b bool) value {
+	if b {
+		return value{Type: Bool, Int: 1}
+	}
+	return value{Type: Bool}
+}
+
+//formats an output value the same way in both interpreters
+func formatValue(v value) string {
+	if v.Type == Float {
+		return strconv.FormatFloat(v.Float, 'g', -1, 64)
+	}
+	return strconv.FormatInt(v.Int, 10)
+}
+
+//calls a builtin function like its generated code does
+func (i *interpreter) builtin(node *Call) (value, error) {
+	if len(node.Args) != builtins[node.Function] {
+		return value{}, fmt.Errorf("%s takes %d arguments, found %d", node.Function, builtins[node.Function], len(node.Args))
+	}
+	args := make([]value, len(node.Args))
+	for n, arg := range node.Args {
+		v, err := i.expression(arg)
+		if err != nil {
+			return value{}, err
+		}
+		args[n] = v
+	}
+	if node.Function == "sqrt" {
+		return value{Type: Float, Float: newtonSqrt(args[0].float())}, nil
+	}
+	return power(args[0], args[1].Int)
+}
@@ -0,0 +1,169 @@
+package cpq
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ResolveLabels returns code without its label definitions, with every operand that is
+// a label replaced by the line number of the instruction after the definition. The
+// line numbers are computed in a first pass and the operands replaced in a second one,
+// so a jump may come before its label. A label defined twice, or a jump target or an
+// operand starting with '@' that is not a defined label, is an error.
+func ResolveLabels(code []Instruction) ([]Instruction, error) {
+	lines := map[string]string{}
+	line := 1
+	for _, ins := range code {
+		if ins.Label == "" {
+			line++
+			continue
+		}
+		if _, defined := lines[ins.Label]; defined {
+			return nil, fmt.Errorf("label %s is defined twice", ins.Label)
+		}
+		lines[ins.Label] = strconv.Itoa(line)
+	}
+	resolved := make([]Instruction, 0, line-1)
+	for _, ins := range code {
+		if ins.Label != "" {
+			continue
+		}
+		if err := checkLabels(ins, lines); err != nil {
+			return nil, fmt.Errorf("line %d: %s", len(resolved)+1, err)
+		}
+		ins.Args = renameOperands(ins.Args, lines)
+		resolved = append(resolved, ins)
+	}
+	return resolved, nil
+}
+
+//reports an operand of the instruction that refers to a label missing from labels
+func checkLabels(ins Instruction, labels map[string]string) error {
+	for n, arg := range ins.Args {
+		if _, ok := labels[arg]; ok {
+			continue
+		}
+		target := n == 0 && (ins.Op == "JUMP" || ins.Op == "JMPZ")
+		if strings.HasPrefix(arg, "@") || target && !lineNumber(arg) {
+			return fmt.Errorf("%s jumps to undefined label %s", ins.Op, arg)
+		}
+	}
+	return nil
+}
+
+//reports whether an operand is a resolved jump target
+func lineNumber(operand string) bool {
+	if operand == "" {
+		return false
+	}
+	for _, ch := range operand {
+		if !digit(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveLabels removes any labels generated by this module, replacing the references
+// to them with line numbers. The text is read into instructions and resolved with
+// ResolveLabels, so a label is only replaced where it is a whole operand.
+func RemoveLabels(quad string) (string, error) {
+	code, err := ResolveLabels(ParseInstructions(quad))
+	if err != nil {
+		return "", err
+	}
+	resolved := FormatInstructions(code, nil)
+	if !strings.HasSuffix(quad, "\n") {
+		resolved = strings.TrimSuffix(resolved, "\n")
+	}
+	return resolved, nil
+}
+
+func isLabelLine(line string) bool {
+	return strings.HasSuffix(line, ":")
+}
+
+//resolves the labels of a seekable labeled QUAD file in two passes, writing the
+//opcodes as opcodes spells them
+func resolveLabelsStream(file io.ReadSeeker, w io.Writer, opcodes map[string]string) error {
+	// first pass: line number of every label
+	labels := map[string]string{}
+	line := 0
+	err := scanQuadLines(file, func(text string) error {
+		if !isLabelLine(text) {
+			line++
+			return nil
+		}
+		label := text[:len(text)-1]
+		if _, defined := labels[label]; defined {
+			return fmt.Errorf("label %s is defined twice", label)
+		}
+		labels[label] = strconv.Itoa(line + 1)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	// second pass: drop label lines and rewrite references
+	out := bufio.NewWriter(w)
+	line = 0
+	err = scanQuadLines(file, func(text string) error {
+		ins, ok := parseInstruction(text)
+		if !ok || ins.Label != "" {
+			return nil
+		}
+		line++
+		if err := checkLabels(ins, labels); err != nil {
+			return fmt.Errorf("line %d: %s", line, err)
+		}
+		ins.Args = renameOperands(ins.Args, labels)
+		if _, err := out.WriteString(ins.format(opcodes) + "\n"); err != nil {
+			return outputError{err}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := out.Flush(); err != nil {
+		return outputError{err}
+	}
+	return nil
+}
+
+//an error of the writer the resolved code goes to, rather than of the code
+type outputError struct{ error }
+
+// SymbolicLabels keeps the labels of generated QUAD instead of resolving them,
+// renaming them to the L1: / JUMP L1 form understood by tools that support labels.
+// The L gets '_' appended while the program has a variable named L and a number, as
+// freePrefix does. Labels made with a CodegenOptions.LabelPrefix are kept as they are.
+func SymbolicLabels(quad string) string {
+	code := ParseInstructions(quad)
+	labels := map[string]string{}
+	for _, ins := range code {
+		if strings.HasPrefix(ins.Label, "@") {
+			labels[ins.Label] = ""
+		}
+	}
+	//the operands are the names of the program and the @ labels, none of them generated
+	prefix := freePrefix(code, "L", func(string) bool { return false })
+	for label := range labels {
+		labels[label] = prefix + label[1:]
+	}
+	for n, ins := range code {
+		if label, ok := labels[ins.Label]; ok {
+			code[n].Label = label
+		} else if ins.Label == "" {
+			code[n].Args = renameOperands(ins.Args, labels)
+		}
+	}
+	symbolic := FormatInstructions(code, nil)
+	if !strings.HasSuffix(quad, "\n") {
+		symbolic = strings.TrimSuffix(symbolic, "\n")
+	}
+	return symbolic
+}
@@ -0,0 +1,113 @@
+package cpq
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//the symbolic labels of a program with variables named like them get another prefix, and
+//still resolve to the lines the generated labels do
+func TestSymbolicLabelsAvoidVariables(t *testing.T) {
+	src := `L1, L2 : int;
+{ input(L1); while (L1 < 10) { if (L1 > 5) L2 = L1; else L2 = 0; L1 = L1 + 1; } output(L2); }`
+	program, errors := Parse(src)
+	code, codegenErrors, _ := CodegenInstructions(program, Options{})
+	if errors = append(errors, codegenErrors...); len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	symbolic := SymbolicLabels(FormatInstructions(code, nil))
+	if !strings.Contains(symbolic, "L_1:") {
+		t.Errorf("labels are not named L_1 and on:\n%s", symbolic)
+	}
+	for _, name := range []string{"L1", "L2"} {
+		if strings.Contains(symbolic, "\n"+name+":") {
+			t.Errorf("label %s is also a variable:\n%s", name, symbolic)
+		}
+	}
+	want, err := ResolveLabels(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ResolveLabels(ParseInstructions(symbolic))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("symbolic labels resolve to\n%v\nwant\n%v", got, want)
+	}
+}
+
+//returns labeled QUAD with the given number of labels, each followed by an IPRT of its
+//number, a jump to a label at the other end of the program and a jump back to itself,
+//and the label every jump goes to in their order
+func labeledProgram(labels int) (string, []int) {
+	var b strings.Builder
+	targets := []int{}
+	for k := 1; k <= labels; k++ {
+		other := labels + 1 - k
+		fmt.Fprintf(&b, "@%d:\nIPRT %d\nJUMP @%d\nJMPZ @%d x\n", k, k, other, k)
+		targets = append(targets, other, k)
+	}
+	b.WriteString("HALT\n")
+	return b.String(), targets
+}
+
+//every jump, forward or backward, goes to the line of the IPRT after its label
+func TestRemoveLabels(t *testing.T) {
+	quad, targets := labeledProgram(25)
+	resolved, err := RemoveLabels(quad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(resolved, "\n"), "\n")
+	if len(lines) != 3*25+1 {
+		t.Fatalf("%d lines, want %d:\n%s", len(lines), 3*25+1, resolved)
+	}
+	jumps := 0
+	for n, line := range lines {
+		fields := strings.Fields(line)
+		if fields[0] != "JUMP" && fields[0] != "JMPZ" {
+			continue
+		}
+		want := fmt.Sprintf("IPRT %d", targets[jumps])
+		target, err := strconv.Atoi(fields[1])
+		if err != nil || target < 1 || target > len(lines) || lines[target-1] != want {
+			t.Errorf("line %d: %s goes to a line other than %s", n+1, line, want)
+		}
+		jumps++
+	}
+	if jumps != len(targets) {
+		t.Errorf("%d jumps, want %d", jumps, len(targets))
+	}
+}
+
+func BenchmarkRemoveLabels(b *testing.B) {
+	quad, _ := labeledProgram(10000)
+	b.SetBytes(int64(len(quad)))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		if _, err := RemoveLabels(quad); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+//@1 is not taken for a prefix of @10 to @12
+func TestResolveLabelsWithCommonPrefixes(t *testing.T) {
+	var b strings.Builder
+	b.WriteString("JUMP @1\nJUMP @10\nJUMP @11\nJUMP @12\n")
+	for k := 1; k <= 12; k++ {
+		fmt.Fprintf(&b, "@%d:\nIPRT %d\n", k, k)
+	}
+	b.WriteString("HALT\n")
+	resolved, err := RemoveLabels(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "JUMP 5\nJUMP 14\nJUMP 15\nJUMP 16\n"
+	if !strings.HasPrefix(resolved, want) {
+		t.Errorf("RemoveLabels =\n%s\nwant it to start with\n%s", resolved, want)
+	}
+}
@@ -0,0 +1,67 @@
+package cpq
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//The names the code generator makes up must not be names of the program. A CPL
+//identifier is letters and digits starting with a letter, and the QUAD names made of
+//identifiers, f_x for a local of f, p_x for a field and a_0 for an array element,
+//start with a letter too, so the default prefixes _t and @ never clash with them.
+//Those QUAD names can clash with one another, the local u of a function p and the
+//field u of a struct p are both p_u, and the analyzer rejects such programs. A prefix of
+//CodegenOptions that starts with a letter may, and gets '_' appended until it does not.
+
+//returns prefix, or prefix followed by the '_' needed so that no operand of the code
+//that is not a generated name is the prefix followed by a number
+func freePrefix(code []Instruction, prefix string, generated func(string) bool) string {
+	if first, _ := utf8.DecodeRuneInString(prefix); !letter(first) {
+		return prefix
+	}
+	for usesPrefix(code, prefix, generated) {
+		prefix += "_"
+	}
+	return prefix
+}
+
+//reports whether an operand that is not a generated name is prefix followed by a number
+func usesPrefix(code []Instruction, prefix string, generated func(string) bool) bool {
+	for _, ins := range code {
+		for _, arg := range ins.Args {
+			if !generated(arg) && strings.HasPrefix(arg, prefix) && lineNumber(arg[len(prefix):]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//gives the labels the prefix of Naming; they are made as @1, @2 and so on
+func (c *CodeGen) nameLabels() {
+	if c.Naming.labelPrefix() == "@" {
+		return
+	}
+	names := map[string]string{}
+	for _, ins := range c.code {
+		if ins.Label != "" {
+			names[ins.Label] = ""
+		}
+	}
+	prefix := freePrefix(c.code, c.Naming.labelPrefix(), func(arg string) bool {
+		_, isLabel := names[arg]
+		return isLabel
+	})
+	for label := range names {
+		number, _ := strconv.Atoi(label[1:])
+		names[label] = prefix + strconv.Itoa(number)
+	}
+	for n, ins := range c.code {
+		if ins.Label != "" {
+			c.code[n].Label = names[ins.Label]
+		} else {
+			c.code[n].Args = renameOperands(ins.Args, names)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package cpq
+
+import (
+	"bufio"
+	"fmt"
+	"strings"
+)
+
+//number of operands of every QUAD instruction
+var quadOperands = map[string]int{
+	"IASN": 2, "IPRT": 1, "IINP": 1, "IEQL": 3, "INQL": 3, "ILSS": 3, "IGRT": 3,
+	"IADD": 3, "ISUB": 3, "IMLT": 3, "IDIV": 3,
+	"RASN": 2, "RPRT": 1, "RINP": 1, "REQL": 3, "RNQL": 3, "RLSS": 3, "RGRT": 3,
+	"RADD": 3, "RSUB": 3, "RMLT": 3, "RDIV": 3,
+	"ITOR": 2, "RTOI": 2, "JUMP": 1, "JMPZ": 2, "HALT": 0,
+}
+
+// ParseOpcodeTable reads a mnemonic mapping for QUAD interpreters that spell opcodes
+// differently. Every line maps a standard opcode to its spelling in the dialect,
+// as "JUMP JMP" or "JUMP=JMP"; empty lines and lines starting with '#' are ignored.
+func ParseOpcodeTable(text string) (map[string]string, error) {
+	table := map[string]string{}
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSpace(scanner.Text())
+		if entry == "" || strings.HasPrefix(entry, "#") {
+			continue
+		}
+		fields := strings.Fields(strings.Replace(entry, "=", " ", 1))
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected an opcode and its spelling", line)
+		}
+		op := strings.ToUpper(fields[0])
+		if _, ok := quadOperands[op]; !ok {
+			return nil, fmt.Errorf("line %d: unknown opcode %s", line, fields[0])
+		}
+		table[op] = fields[1]
+	}
+	return table, scanner.Err()
+}
+
+//returns the table with every opcode spelled in lower case
+func LowercaseOpcodes(table map[string]string) map[string]string {
+	result := map[string]string{}
+	for op := range quadOperands {
+		name := op
+		if mapped, ok := table[op]; ok {
+			name = mapped
+		}
+		result[op] = strings.ToLower(name)
+	}
+	return result
+}
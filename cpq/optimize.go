@@ -0,0 +1,470 @@
+package cpq
+
+import (
+	"fmt"
+	"strconv"
+)
+
+//removes the instructions that no path from the first instruction reaches, like the
+//statements after a break or the body of a function that is never called, and warns
+//about them
+func (c *CodeGen) eliminateDeadCode() {
+	reached := c.reachable()
+	entries := map[string]*functionInfo{}
+	for _, info := range c.functionOrder {
+		entries[info.entry] = info
+	}
+	live := c.code[:0]
+	reported := false // the unreachable instructions since the last reachable one were reported
+	for n, ins := range c.code {
+		if reached[n] {
+			live = append(live, ins)
+			reported = false
+			continue
+		}
+		if reported {
+			continue
+		}
+		if info, ok := entries[ins.Label]; ok {
+			c.warn(WarnUnreachable, ErrorType{
+				Code:    CodeWarnUncalled,
+				Message: fmt.Sprintf("function %s is never called", info.Name),
+				Pos:     info.Pos,
+			})
+			reported = true
+		} else if ins.Statement {
+			c.warn(WarnUnreachable, ErrorType{Code: CodeWarnUnreachable, Message: "unreachable code", Pos: ins.Pos})
+			reported = true
+		}
+	}
+	c.code = live
+}
+
+//redirects every jump to a label followed by a JUMP, like the end of an if inside an
+//else or a break at the end of a switch case, to where the chain of jumps leads. The
+//jumps that are no longer reached and the labels that are no longer referenced are
+//removed; the labels of functions are kept, allocateTemps finds the functions by them.
+func (c *CodeGen) threadJumps() {
+	labels := c.labelLines()
+	//returns the label a jump to label ends up at
+	destination := func(label string) string {
+		seen := map[string]bool{}
+		for !seen[label] {
+			seen[label] = true
+			n := labels[label]
+			for n < len(c.code) && c.code[n].Label != "" {
+				n++
+			}
+			if n == len(c.code) || c.code[n].Op != "JUMP" {
+				break
+			}
+			label = c.code[n].Args[0]
+		}
+		return label
+	}
+	for n, ins := range c.code {
+		if ins.Op != "JUMP" && ins.Op != "JMPZ" {
+			continue
+		}
+		if target := destination(ins.Args[0]); target != ins.Args[0] {
+			args := append([]string(nil), ins.Args...)
+			args[0] = target
+			c.code[n].Args = args
+		}
+	}
+
+	reached := c.reachable()
+	referenced := map[string]bool{}
+	for _, info := range c.functionOrder {
+		referenced[info.entry] = true
+		referenced[info.exit] = true
+	}
+	for n, ins := range c.code {
+		if reached[n] && (ins.Op == "JUMP" || ins.Op == "JMPZ") {
+			referenced[ins.Args[0]] = true
+		}
+	}
+	code := c.code[:0]
+	for n, ins := range c.code {
+		if ins.Label != "" && referenced[ins.Label] || ins.Label == "" && reached[n] {
+			code = append(code, ins)
+		}
+	}
+	c.code = code
+}
+
+//marks the instructions that a path from the first instruction reaches
+func (c *CodeGen) reachable() []bool {
+	labels := c.labelLines()
+	reached := make([]bool, len(c.code))
+	pending := []int{0}
+	for len(pending) > 0 {
+		n := pending[len(pending)-1]
+		pending = pending[:len(pending)-1]
+		for ; n < len(c.code) && !reached[n]; n++ {
+			reached[n] = true
+			ins := c.code[n]
+			if ins.Op == "JUMP" || ins.Op == "JMPZ" {
+				pending = append(pending, labels[ins.Args[0]])
+			}
+			if ins.Op == "JUMP" || ins.Op == "HALT" {
+				break
+			}
+		}
+	}
+	return reached
+}
+
+//returns the index of the definition of every label
+func (c *CodeGen) labelLines() map[string]int {
+	labels := map[string]int{}
+	for n, ins := range c.code {
+		if ins.Label != "" {
+			labels[ins.Label] = n
+		}
+	}
+	return labels
+}
+
+//reports whether an operand is a temporary of getTemp
+func temporary(operand string) bool {
+	if len(operand) < 3 || operand[:2] != "_t" {
+		return false
+	}
+	for _, ch := range operand[2:] {
+		if !digit(ch) {
+			return false
+		}
+	}
+	return true
+}
+
+//temporaries of the main block or of a function while they are allocated
+type tempNames struct {
+	active []string // temporaries whose value may still be used
+	free   []int    // names no active temporary has
+	width  int      // names used
+}
+
+//returns the lowest free name
+func (t *tempNames) take() int {
+	if len(t.free) == 0 {
+		t.width++
+		return t.width - 1
+	}
+	lowest := 0
+	for n := range t.free {
+		if t.free[n] < t.free[lowest] {
+			lowest = n
+		}
+	}
+	name := t.free[lowest]
+	t.free = append(t.free[:lowest], t.free[lowest+1:]...)
+	return name
+}
+
+//renames the temporaries so that a name is reused once its value is dead. A temporary
+//lives from its first to its last instruction, and to the end of a loop when it is used
+//in the loop but set before it. A function gets names above those of the main block and
+//of its callers, as their temporaries may be live across a call. The final names have the
+//prefix and first number of Naming, see freePrefix. When more than MaxTemps names are
+//needed, reports an error or, with TempsSpill, keeps the values of the others in variables.
+func (c *CodeGen) allocateTemps() {
+	//the function of every instruction, nil for the main block
+	regions := make([]*functionInfo, len(c.code))
+	owners := map[string]*functionInfo{}
+	for _, info := range c.functionOrder {
+		owners[info.entry] = info
+		owners[info.exit] = info
+	}
+	labels := map[string]int{}
+	var region *functionInfo
+	for n, ins := range c.code {
+		if info, ok := owners[ins.Label]; ok {
+			region = info
+		}
+		regions[n] = region
+		if ins.Label != "" {
+			labels[ins.Label] = n
+		}
+	}
+
+	type interval struct{ start, end int }
+	intervals := map[string]*interval{}
+	var order []string        // temporaries by their first instruction
+	loopEnds := map[int]int{} // last jump back to every label in the same function
+	for n, ins := range c.code {
+		for _, arg := range ins.Args {
+			if !temporary(arg) {
+				continue
+			}
+			if t, ok := intervals[arg]; ok {
+				t.end = n
+			} else {
+				intervals[arg] = &interval{n, n}
+				order = append(order, arg)
+			}
+		}
+		if ins.Op == "JUMP" || ins.Op == "JMPZ" {
+			if target, ok := labels[ins.Args[0]]; ok && target < n && regions[target] == regions[n] {
+				loopEnds[target] = n
+			}
+		}
+	}
+
+	names := map[*functionInfo]*tempNames{}
+	local := map[string]int{}
+	next := 0
+	for n := range c.code {
+		t := names[regions[n]]
+		if t == nil {
+			t = &tempNames{}
+			names[regions[n]] = t
+		}
+		active := t.active[:0]
+		for _, temp := range t.active {
+			if intervals[temp].end < n {
+				t.free = append(t.free, local[temp])
+			} else {
+				active = append(active, temp)
+			}
+		}
+		t.active = active
+		if end, ok := loopEnds[n]; ok {
+			for _, temp := range t.active {
+				if intervals[temp].end < end {
+					intervals[temp].end = end
+				}
+			}
+		}
+		for ; next < len(order) && intervals[order[next]].start == n; next++ {
+			local[order[next]] = t.take()
+			t.active = append(t.active, order[next])
+		}
+	}
+
+	width := func(info *functionInfo) int {
+		if t := names[info]; t != nil {
+			return t.width
+		}
+		return 0
+	}
+	bases := map[*functionInfo]int{}
+	var base func(info *functionInfo) int
+	base = func(info *functionInfo) int {
+		if b, ok := bases[info]; ok {
+			return b
+		}
+		b := width(nil)
+		for _, caller := range c.functionOrder {
+			for _, call := range caller.calls {
+				if call.Function == info.Name && base(caller)+width(caller) > b {
+					b = base(caller) + width(caller)
+				}
+			}
+		}
+		bases[info] = b
+		return b
+	}
+
+	prefix := freePrefix(c.code, c.Naming.tempPrefix(), temporary)
+	renamed := map[string]string{}
+	numbers := map[string]int{}
+	needed := 0
+	for _, temp := range order {
+		number := local[temp] + 1
+		if info := regions[intervals[temp].start]; info != nil {
+			number += base(info)
+		}
+		renamed[temp] = prefix + strconv.Itoa(c.Naming.tempBase()+number)
+		numbers[temp] = number
+		if number > needed {
+			needed = number
+		}
+	}
+
+	//with TempsSpill the temporaries above the first MaxTemps-spillScratch are kept in
+	//variables, numbered like them so that a function still does not share one with its
+	//callers, and the last spillScratch names hold them for one instruction at a time
+	spilled := map[string]bool{}
+	var scratch []string
+	if c.MaxTemps > 0 && needed > c.MaxTemps && c.TempPolicy == TempsSpill {
+		if c.MaxTemps < spillScratch {
+			c.addError(ErrorType{Code: CodeSpillScratch, Message: fmt.Sprintf(
+				"spilling temporaries needs at least %d of them, the limit is %d", spillScratch, c.MaxTemps)})
+			return
+		}
+		registers := c.MaxTemps - spillScratch
+		for n := registers + 1; n <= c.MaxTemps; n++ {
+			scratch = append(scratch, prefix+strconv.Itoa(c.Naming.tempBase()+n))
+		}
+		spillPrefix := freePrefix(c.code, prefix+"s", func(string) bool { return false })
+		for temp, number := range numbers {
+			if number > registers {
+				renamed[temp] = spillPrefix + strconv.Itoa(number-registers)
+				spilled[renamed[temp]] = true
+			}
+		}
+	}
+
+	reported := false
+	for n := range c.code {
+		ins := &c.code[n]
+		copied := false
+		for k, arg := range ins.Args {
+			if name, ok := renamed[arg]; ok {
+				number := numbers[arg]
+				if !copied {
+					ins.Args = append([]string(nil), ins.Args...)
+					copied = true
+				}
+				ins.Args[k] = name
+				if c.MaxTemps > 0 && number > c.MaxTemps && len(spilled) == 0 && !reported {
+					reported = true
+					c.addError(ErrorType{Code: CodeProgramTemps, Message: fmt.Sprintf("program needs more than %d temporaries", c.MaxTemps), Pos: ins.Pos})
+				}
+			}
+		}
+	}
+	if len(spilled) > 0 {
+		c.code = spillTemps(c.code, spilled, scratch)
+	}
+}
+
+//temporaries that hold spilled values: an instruction reads at most two operands, and
+//writes its result after reading them
+const spillScratch = 2
+
+//returns the code with the spilled operands of every instruction restored into scratch
+//temporaries before it, and its spilled result saved from one after it:
+//  IADD _ts2 _ts1 a  ->  IASN _t3 _ts1, IADD _t3 _t3 a, IASN _ts2 _t3
+func spillTemps(code []Instruction, spilled map[string]bool, scratch []string) []Instruction {
+	result := make([]Instruction, 0, len(code))
+	for _, ins := range code {
+		writes := writesFirst[ins.Op] || ins.Op == "IINP" || ins.Op == "RINP"
+		held := map[string]string{}
+		var restores, saves []Instruction
+		for k, arg := range ins.Args {
+			if !spilled[arg] || k == 0 && writes {
+				continue
+			}
+			if _, ok := held[arg]; !ok {
+				held[arg] = scratch[len(held)]
+				restores = append(restores, Instruction{Op: assignment(ins.Op, k), Args: []string{held[arg], arg}, Pos: ins.Pos})
+			}
+		}
+		args := make([]string, len(ins.Args))
+		for k, arg := range ins.Args {
+			args[k] = arg
+			if !spilled[arg] {
+				continue
+			}
+			if k == 0 && writes {
+				if _, ok := held[arg]; !ok {
+					held[arg] = scratch[0]
+				}
+				saves = append(saves, Instruction{Op: assignment(ins.Op, k), Args: []string{arg, held[arg]}, Pos: ins.Pos})
+			}
+			args[k] = held[arg]
+		}
+		if len(restores) == 0 && len(saves) == 0 {
+			result = append(result, ins)
+			continue
+		}
+		if len(restores) > 0 {
+			restores[0].Statement = ins.Statement
+			ins.Statement = false
+		}
+		ins.Args = args
+		result = append(append(append(result, restores...), ins), saves...)
+	}
+	return result
+}
+
+//returns the assignment of the type of the k-th operand of an instruction
+func assignment(op string, k int) string {
+	float := op[0] == 'R' && op != "RTOI"
+	switch op {
+	case "ITOR":
+		float = k == 0
+	case "RTOI":
+		float = k == 1
+	case "REQL", "RNQL", "RLSS", "RGRT":
+		float = k > 0
+	}
+	if float {
+		return "RASN"
+	}
+	return "IASN"
+}
+
+//instructions that write their first operand
+var writesFirst = map[string]bool{
+	"IASN": true, "IEQL": true, "INQL": true, "ILSS": true, "IGRT": true,
+	"IADD": true, "ISUB": true, "IMLT": true, "IDIV": true,
+	"RASN": true, "REQL": true, "RNQL": true, "RLSS": true, "RGRT": true,
+	"RADD": true, "RSUB": true, "RMLT": true, "RDIV": true,
+	"ITOR": true, "RTOI": true,
+}
+
+//rewrites short sequences of instructions into fewer ones until none is left:
+//  IADD _t1 a b, IASN y _t1  ->  IADD y a b   (any instruction setting a temporary copied once)
+//  ITOR _t1 x, RTOI _t2 _t1  ->  IASN _t2 x
+//  JUMP L, L:                ->  L:           (also JMPZ, whose condition has no side effects)
+//A temporary is only replaced when the pair holds its every use.
+func (c *CodeGen) peephole() {
+	uses := map[string]int{}
+	for _, ins := range c.code {
+		for _, arg := range ins.Args {
+			if temporary(arg) {
+				uses[arg]++
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		code := c.code[:0]
+		for n := 0; n < len(c.code); n++ {
+			ins := c.code[n]
+			if ins.Op == "JUMP" || ins.Op == "JMPZ" {
+				if jumpsToNext(c.code[n+1:], ins.Args[0]) {
+					changed = true
+					continue
+				}
+			}
+			if n+1 < len(c.code) && writesFirst[ins.Op] && temporary(ins.Args[0]) && uses[ins.Args[0]] == 2 {
+				next := c.code[n+1]
+				if !next.Statement && len(next.Args) == 2 && next.Args[1] == ins.Args[0] {
+					switch {
+					case (next.Op == "IASN" && ins.Op != "ITOR") || (next.Op == "RASN" && ins.Op != "RTOI"):
+						ins.Args = append([]string{next.Args[0]}, ins.Args[1:]...)
+					case next.Op == "RTOI" && ins.Op == "ITOR":
+						ins.Op, ins.Args = "IASN", []string{next.Args[0], ins.Args[1]}
+					default:
+						code = append(code, ins)
+						continue
+					}
+					code = append(code, ins)
+					n++
+					changed = true
+					continue
+				}
+			}
+			code = append(code, ins)
+		}
+		c.code = code
+	}
+}
+
+//reports whether the label is defined before the next instruction of code
+func jumpsToNext(code []Instruction, label string) bool {
+	for _, ins := range code {
+		if ins.Label == "" {
+			return false
+		}
+		if ins.Label == label {
+			return true
+		}
+	}
+	return false
+}
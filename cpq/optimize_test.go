@@ -0,0 +1,100 @@
+package cpq
+
+import (
+	"strings"
+	"testing"
+)
+
+//needs 4 temporaries at once, in the main block and in a function called from it
+const overBudget = `a, b, c, d : int; x : float;
+func g(p : int, q : float) : float { return (p + 1) * (p - 2) - (p * 3 + q) / ((p - 4) * (q + 5.5) + 1); }
+{ input(a); input(b); input(c); input(d); input(x);
+  output((a + b) * (c + d) - (a * c + b * d) / ((a - b) * (c - d) + 1));
+  x = x * g((a + b) * (c - d), x + 1.5) + (x - 2.5) * (x + 3.5);
+  output(x); output(g(a, x) < (x + 1) * (x - 1)); }`
+
+//returns the temporary and spill variable names of QUAD code
+func quadTemps(quad string) (temps, spills map[string]bool) {
+	temps, spills = map[string]bool{}, map[string]bool{}
+	for _, field := range strings.Fields(quad) {
+		switch {
+		case strings.HasPrefix(field, "_ts"):
+			spills[field] = true
+		case strings.HasPrefix(field, "_t"):
+			temps[field] = true
+		}
+	}
+	return temps, spills
+}
+
+func TestTempPolicies(t *testing.T) {
+	input := "3 9 4 -2 1.25"
+	want, err := crossCheck(overBudget, input, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	unlimited, _ := compileQuad(t, overBudget, Options{})
+	if temps, _ := quadTemps(unlimited); len(temps) <= 3 {
+		t.Fatalf("the program needs %d temporaries, the test needs more than 3", len(temps))
+	}
+
+	_, errors := compileQuad(t, overBudget, Options{MaxTemps: 3})
+	if len(errors) != 1 || errors[0].Code != CodeProgramTemps || errors[0].Text() != "program needs more than 3 temporaries" {
+		t.Errorf("TempsError: errors = %v", errors)
+	}
+
+	for _, limit := range []int{2, 3} {
+		quad, errors := compileQuad(t, overBudget, Options{MaxTemps: limit, TempPolicy: TempsSpill})
+		if len(errors) > 0 {
+			t.Fatalf("TempsSpill %d: errors = %v", limit, errors)
+		}
+		temps, spills := quadTemps(quad)
+		if len(temps) > limit || len(spills) == 0 {
+			t.Errorf("TempsSpill %d: temporaries %v, spilled into %v", limit, temps, spills)
+		}
+		var out strings.Builder
+		if err := runQuad(quad, strings.NewReader(input), &out, defaultMaxSteps); err != nil {
+			t.Fatalf("TempsSpill %d: %s\n%s", limit, err, quad)
+		}
+		if out.String() != want {
+			t.Errorf("TempsSpill %d: the program printed %q, want %q", limit, out.String(), want)
+		}
+	}
+
+	_, errors = compileQuad(t, overBudget, Options{MaxTemps: 1, TempPolicy: TempsSpill})
+	if len(errors) != 1 || errors[0].Code != CodeSpillScratch {
+		t.Errorf("TempsSpill 1: errors = %v", errors)
+	}
+}
+
+//an instruction whose result is also one of its spilled operands
+func TestSpillTemps(t *testing.T) {
+	code := []Instruction{
+		{Op: "IADD", Args: []string{"_ts2", "_ts1", "_ts2"}, Statement: true},
+		{Op: "RTOI", Args: []string{"_ts1", "_ts3"}},
+		{Op: "IPRT", Args: []string{"_ts1"}},
+	}
+	spilled := map[string]bool{"_ts1": true, "_ts2": true, "_ts3": true}
+	got := FormatInstructions(spillTemps(code, spilled, []string{"_t1", "_t2"}), nil)
+	want := "IASN _t1 _ts1\nIASN _t2 _ts2\nIADD _t2 _t1 _t2\nIASN _ts2 _t2\n" +
+		"RASN _t1 _ts3\nRTOI _t1 _t1\nIASN _ts1 _t1\n" +
+		"IASN _t1 _ts1\nIPRT _t1\n"
+	if got != want {
+		t.Errorf("spillTemps =\n%s\nwant\n%s", got, want)
+	}
+}
+
+//compiles src to resolved QUAD
+func compileQuad(t *testing.T, src string, opts Options) (string, []ErrorType) {
+	t.Helper()
+	program, errors := Parse(src)
+	code, codegenErrors, _ := CodegenInstructions(program, opts)
+	if errors = append(errors, codegenErrors...); len(errors) > 0 {
+		return "", errors
+	}
+	resolved, err := ResolveLabels(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return FormatInstructions(resolved, nil), nil
+}
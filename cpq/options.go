@@ -0,0 +1,129 @@
+package cpq
+
+import "fmt"
+
+//language accepted by the compiler.
+type Standard int
+
+const (
+	StdExtended Standard = iota // course grammar plus all extensions
+	StdCPL                      // exactly the course grammar
+)
+
+//returns the standard named by --std
+func ParseStandard(name string) (Standard, error) {
+	switch name {
+	case "extended":
+		return StdExtended, nil
+	case "cpl":
+		return StdCPL, nil
+	}
+	return StdExtended, fmt.Errorf("unknown language standard %q, expected cpl or extended", name)
+}
+
+func (std Standard) String() string {
+	if std == StdCPL {
+		return "cpl"
+	}
+	return "extended"
+}
+
+//limits on the size of a compiled program, protecting servers from huge inputs.
+//A zero limit means unlimited.
+type Limits struct {
+	MaxSourceSize int // bytes of source text
+	MaxTokens     int
+	MaxNodes      int // syntax tree nodes
+}
+
+//limits used by the command line compiler
+var DefaultLimits = Limits{
+	MaxSourceSize: 64 << 20,
+	MaxTokens:     16 << 20,
+	MaxNodes:      8 << 20,
+}
+
+//what the code generator does about the number of temporaries
+type TempPolicy int
+
+const (
+	TempsError TempPolicy = iota // report an error when the program needs more than MaxTemps
+	TempsSpill                   // keep the values of the temporaries over the limit in variables, see spillTemps
+)
+
+//names the code generator makes up for temporaries and labels. Fragments of code
+//generated with different prefixes or with numbers that do not overlap can be
+//concatenated without mixing up their names.
+type CodegenOptions struct {
+	TempPrefix  string // of the temporaries, "_t" when empty
+	LabelPrefix string // of the labels, "@" when empty; SymbolicLabels writes @1 as L1 (L_1 when L1 is a variable) and keeps other labels
+	FirstTemp   int    // number of the first temporary, 1 when 0
+	FirstLabel  int    // number of the first label, 1 when 0
+}
+
+//returns the prefix of the temporaries
+func (o CodegenOptions) tempPrefix() string {
+	if o.TempPrefix == "" {
+		return "_t"
+	}
+	return o.TempPrefix
+}
+
+//returns the prefix of the labels
+func (o CodegenOptions) labelPrefix() string {
+	if o.LabelPrefix == "" {
+		return "@"
+	}
+	return o.LabelPrefix
+}
+
+//returns the number before the first temporary
+func (o CodegenOptions) tempBase() int {
+	if o.FirstTemp == 0 {
+		return 0
+	}
+	return o.FirstTemp - 1
+}
+
+//returns the number before the first label
+func (o CodegenOptions) labelBase() int {
+	if o.FirstLabel == 0 {
+		return 0
+	}
+	return o.FirstLabel - 1
+}
+
+//options of the compilation
+type Options struct {
+	Limits       Limits
+	Std          Standard
+	FloatEpsilon float64 // lower float == and != to |a-b| < FloatEpsilon when positive
+
+	UnicodeIdentifiers bool // identifiers may have any Unicode letter, é or π, not only ASCII ones
+
+	HaltOnBadInput bool // input(x in a..b) halts on out of range values instead of reading again
+	SwitchBreak    bool // every switch case ends with a break unless it ends with fallthrough;
+	SwitchSearch   bool // find the case of a switch with a binary search of its values
+
+	//opcode that prints a string given as a quoted operand, for interpreters that have one;
+	//without it output("...") prints the code of every character with IPRT
+	StringOpcode string
+
+	MaxTemps   int // most temporary names the output may use, 0 for no limit
+	TempPolicy TempPolicy
+
+	Severities map[WarningKind]Severity // how every kind of warning is reported, see ParseWarnings
+	Werror     bool                     // report the warnings as errors
+
+	Opcodes map[string]string // spelling of opcodes for alternate interpreters, see ParseOpcodeTable
+	Codegen CodegenOptions    // names of the temporaries and labels
+
+	//errors of every phase compiled with these options, which stop at its limit;
+	//nil for no limit
+	Diagnostics *Diagnostics
+
+	//time and allocations of the phases run with these options, recorded when not nil:
+	//scan and parse by ParseWithOptions, check, codegen and optimize by CodegenInstructions,
+	//and all of them and emit by Compile
+	Stats *Stats
+}
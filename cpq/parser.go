@@ -2,36 +2,61 @@ package cpq
 
 import (
 	"fmt"
+	"io"
 	"strconv"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 type ErrorType struct {
 	Message  string
+	Code     string // stable code of the error, like CPQ0001
 	Found    string
 	Expected []string
 	Pos      Position
+	End      Position // just after the offending token, zero when it is not known
 }
 
 //CPL parser.
 type Parser struct {
 	Errors    []ErrorType
+	MaxNodes  int
+	Std       Standard
 	scanner   *Scanner
 	lookahead Token
+	previous  Token   // the last token matched or skipped
+	ahead     []Token // tokens scanned after the lookahead, and the ones passed since the first mark
+	cursor    int     // the token of ahead that comes after the lookahead
+	marks     int     // marks not yet reset or released
+	nodes     int
+	stopped   bool             // the parse ended early, on a too large input or too many errors
+	castValue bool             // the next factor is the static_cast of an assignment, standard CPL
+	condition bool             // parsing the condition of a statement, where = is a mistyped ==
+	caseNames map[string]int64 // enum values and int constants declared so far, for case labels
+	structs   map[string]*Struct
+
+	errorPositions map[Position]bool
+	diagnostics    *Diagnostics
 }
 
 //returns the string of the error
 func (e *ErrorType) Error() string {
+	return fmt.Sprintf("%s at line %d, char %d", e.Text(), e.Pos.Line+1, e.Pos.Column+1)
+}
+
+//returns the error description without its position
+func (e *ErrorType) Text() string {
 	if e.Message != "" {
-		return fmt.Sprintf("%s at line %d, char %d", e.Message, e.Pos.Line+1, e.Pos.Column+1)
+		return e.Message
 	}
-	return fmt.Sprintf("found %s, expected %s at line %d, char %d", e.Found,
-		strings.Join(e.Expected, ", "), e.Pos.Line+1, e.Pos.Column+1)
+	return fmt.Sprintf("found %s, expected %s", e.Found, strings.Join(e.Expected, ", "))
 }
 
 //returns ParseError
 func newError(found string, expected []string, pos Position) ErrorType {
 	return ErrorType{
+		Code:     CodeSyntax,
 		Message:  "",
 		Found:    found,
 		Expected: expected,
@@ -39,21 +64,60 @@ func newError(found string, expected []string, pos Position) ErrorType {
 	}
 }
 
+//returns the error of a token found where an identifier is expected, which tells when
+//it is a reserved word, as in int : int; or input = 5;
+func idError(token *Token) ErrorType {
+	if reserved(token) {
+		return ErrorType{Code: CodeReservedWord, Message: fmt.Sprintf("cannot use reserved word '%s' as identifier", token.Lexeme), Pos: token.Position}
+	}
+	return newError(token.Lexeme, []string{"ID"}, token.Position)
+}
+
+//reports whether a token is a keyword
+func reserved(token *Token) bool {
+	tokType, ok := keywords[token.Lexeme]
+	return ok && tokType == token.TokenType
+}
+
+//records a syntax error, keeping only the first error at each position, and ends the
+//parse when the diagnostics are full
 func (p *Parser) addError(e ErrorType) {
-	for _, err := range p.Errors {
-		if err.Pos == e.Pos {
-			return
-		}
+	if p.stopped || p.errorPositions[e.Pos] {
+		return
 	}
+	p.errorPositions[e.Pos] = true
+	e = p.withEnd(e)
 	p.Errors = append(p.Errors, e)
+	if p.marks > 0 {
+		return
+	}
+	p.diagnostics.Add(e)
+	if p.diagnostics.Full() {
+		p.halt()
+	}
+}
+
+//returns the error with the end of the token at its position, the lookahead or the
+//token before it
+func (p *Parser) withEnd(e ErrorType) ErrorType {
+	if e.End != (Position{}) {
+		return e
+	}
+	if e.Pos == p.lookahead.Position {
+		e.End = p.lookahead.End
+	} else if e.Pos == p.previous.Position {
+		e.End = p.previous.End
+	}
+	return e
 }
 
 //returns new parser
 func NewParser(scanner *Scanner) *Parser {
 	return &Parser{
-		Errors:    []ErrorType{},
-		scanner:   scanner,
-		lookahead: scanner.Scan(),
+		Errors:         []ErrorType{},
+		scanner:        scanner,
+		lookahead:      scanner.Scan(),
+		errorPositions: map[Position]bool{},
 	}
 }
 
@@ -62,11 +126,197 @@ func Parse(s string) (*Program, []ErrorType) {
 	return parser.ParseProgram(), parser.Errors
 }
 
+//parses a CPL program within the limits of the options
+func ParseWithOptions(s string, opts Options) (*Program, []ErrorType) {
+	if opts.Limits.MaxSourceSize > 0 && len(s) > opts.Limits.MaxSourceSize {
+		return &Program{StatementsBlock: &Block{}}, []ErrorType{{
+			Code:    CodeInputTooLarge,
+			Message: fmt.Sprintf("input too large: %d bytes, the limit is %d", len(s), opts.Limits.MaxSourceSize),
+		}}
+	}
+	if opts.Stats == nil {
+		parser := newParserWithOptions(strings.NewReader(s), opts)
+		return parser.ParseProgram(), parser.Errors
+	}
+	scanner := newScannerWithOptions(strings.NewReader(s), opts)
+	opts.Stats.Measure("scan", scanner.prescan)
+	var program *Program
+	var parser *Parser
+	opts.Stats.Measure("parse", func() {
+		parser = newParser(scanner, opts)
+		program = parser.ParseProgram()
+	})
+	return program, parser.Errors
+}
+
+//returns a parser of the source read from r with the standard, token and node limits
+//and diagnostics of opts
+func newParserWithOptions(r io.Reader, opts Options) *Parser {
+	return newParser(newScannerWithOptions(r, opts), opts)
+}
+
+//returns a scanner of the source read from r with the standard and token limit of opts
+func newScannerWithOptions(r io.Reader, opts Options) *Scanner {
+	scanner := NewScanner(r)
+	scanner.MaxTokens = opts.Limits.MaxTokens
+	scanner.FlatComments = opts.Std == StdCPL
+	scanner.UnicodeIdentifiers = opts.UnicodeIdentifiers && opts.Std != StdCPL
+	return scanner
+}
+
+//returns a parser of the tokens of scanner with the standard, node limit and diagnostics
+//of opts
+func newParser(scanner *Scanner, opts Options) *Parser {
+	parser := NewParser(scanner)
+	parser.MaxNodes = opts.Limits.MaxNodes
+	parser.Std = opts.Std
+	parser.diagnostics = opts.Diagnostics
+	return parser
+}
+
+//reports the use of a language extension when parsing standard CPL
+func (p *Parser) extension(feature string, pos Position) {
+	if p.Std == StdCPL {
+		p.addError(ErrorType{Code: CodeExtension, Message: fmt.Sprintf("%s is not part of standard CPL", feature), Pos: pos})
+	}
+}
+
+//counts a new syntax node, stopping the parse when there are too many
+func (p *Parser) countNode() {
+	p.nodes++
+	if p.MaxNodes > 0 && p.nodes > p.MaxNodes {
+		p.stop(fmt.Sprintf("input too large: more than %d syntax nodes", p.MaxNodes))
+	}
+}
+
+//ends the parse early with an "input too large" error, suppressing the errors that follow
+func (p *Parser) stop(message string) {
+	if p.stopped {
+		return
+	}
+	e := ErrorType{Code: CodeInputTooLarge, Message: message, Pos: p.lookahead.Position}
+	p.diagnostics.Add(e)
+	p.Errors = append(p.Errors, e)
+	p.halt()
+}
+
+//ends the parse: every rule sees EOF, and later errors are dropped
+func (p *Parser) halt() {
+	p.stopped = true
+	p.lookahead = Token{TokenType: EOF, Lexeme: "EOF", Position: p.lookahead.Position}
+}
+
+//reads the next token into lookahead
+func (p *Parser) next() {
+	if p.stopped {
+		return
+	}
+	p.previous = p.lookahead
+	if p.cursor == len(p.ahead) {
+		if p.marks == 0 {
+			p.ahead, p.cursor = p.ahead[:0], 0
+		}
+		p.ahead = append(p.ahead, p.scanner.Scan())
+	}
+	p.lookahead = p.ahead[p.cursor]
+	p.cursor++
+	if p.scanner.LimitExceeded() {
+		p.stop(fmt.Sprintf("input too large: more than %d tokens", p.scanner.MaxTokens))
+	}
+	p.illegalToken()
+}
+
+//reports the lookahead when it is a comment that is not closed, and ends the parse, as
+//the comment takes the rest of the source, a malformed number or an identifier with
+//letters that are not ASCII
+func (p *Parser) illegalToken() {
+	if p.lookahead.TokenType != ILLEGAL || p.lookahead.Lexeme == "" {
+		return
+	}
+	first, _ := utf8.DecodeRuneInString(p.lookahead.Lexeme)
+	switch lexeme := p.lookahead.Lexeme; {
+	case lexeme == "/*":
+		p.addError(ErrorType{Code: CodeUnterminatedComment, Message: "unterminated comment", Pos: p.lookahead.Position})
+		p.halt()
+	case digit(rune(lexeme[0])) || lexeme[0] == '.':
+		p.addError(ErrorType{Code: CodeMalformedNumber, Message: fmt.Sprintf("malformed number %s", lexeme), Pos: p.lookahead.Position})
+	case unicode.IsLetter(first) && utf8.RuneCountInString(lexeme) != len(lexeme) && !p.scanner.UnicodeIdentifiers:
+		p.addError(ErrorType{Code: CodeNonASCIIIdentifier, Message: fmt.Sprintf("non-ASCII identifier %s", lexeme), Pos: p.lookahead.Position})
+	}
+}
+
+//returns the token n tokens after the lookahead, peek(1) for the next one
+func (p *Parser) peek(n int) Token {
+	for len(p.ahead)-p.cursor < n {
+		p.ahead = append(p.ahead, p.scanner.Scan())
+	}
+	return p.ahead[p.cursor+n-1]
+}
+
+//a place in the tokens to go back to, for a production that needs to parse ahead to
+//know which one it is
+type mark struct {
+	lookahead, previous Token
+	cursor              int
+	errors              int
+	nodes               int
+}
+
+//returns a mark at the lookahead; until it is reset or released the tokens read are kept,
+//and the errors are not counted in the diagnostics
+func (p *Parser) mark() mark {
+	p.marks++
+	return mark{lookahead: p.lookahead, previous: p.previous, cursor: p.cursor, errors: len(p.Errors), nodes: p.nodes}
+}
+
+//goes back to a mark, dropping the errors found since; the declarations seen are kept,
+//and a parse that stopped stays stopped
+func (p *Parser) reset(m mark) {
+	p.marks--
+	if p.stopped {
+		return
+	}
+	for _, e := range p.Errors[m.errors:] {
+		delete(p.errorPositions, e.Pos)
+	}
+	p.Errors = p.Errors[:m.errors]
+	p.lookahead, p.previous, p.cursor, p.nodes = m.lookahead, m.previous, m.cursor, m.nodes
+}
+
+//keeps what was parsed since a mark, with its errors
+func (p *Parser) release(m mark) {
+	if p.marks--; p.marks > 0 {
+		return
+	}
+	for _, e := range p.Errors[m.errors:] {
+		p.diagnostics.Add(e)
+	}
+	if p.diagnostics.Full() {
+		p.halt()
+	}
+}
+
+//reports the lookahead when it is a reserved word used as a name, which the token after
+//it, one of follow, shows
+func (p *Parser) reservedName(follow ...TokenType) bool {
+	if !reserved(&p.lookahead) {
+		return false
+	}
+	next := p.peek(1).TokenType
+	for _, tokType := range follow {
+		if tokType == next {
+			p.addError(idError(&p.lookahead))
+			return true
+		}
+	}
+	return false
+}
+
 func (p *Parser) matchToken(tokenTypes ...TokenType) (*Token, bool) {
 	for _, tokType := range tokenTypes {
 		if tokType == p.lookahead.TokenType {
 			token := p.lookahead
-			p.lookahead = p.scanner.Scan()
+			p.next()
 			return &token, true
 		}
 	}
@@ -81,52 +331,220 @@ func (p *Parser) match(tokenTypes ...TokenType) (*Token, bool) {
 }
 
 func (p *Parser) skip() {
-	p.lookahead = p.scanner.Scan()
+	p.next()
 }
 
-// 	program -> declarations stmt_block
+//skips the lookahead when it is a reserved word, which stands for a name
+func (p *Parser) skipReserved() {
+	if reserved(&p.lookahead) {
+		p.skip()
+	}
+}
+
+// 	program -> declarations functions stmt_block
 func (p *Parser) ParseProgram() *Program {
 	program := &Program{Pos: p.lookahead.Position}
+	p.illegalToken()
 	program.Declarations = p.ParseDeclarations()
+	for _, declaration := range program.Declarations {
+		if !declaration.Const || declaration.Enum != nil || declaration.Type != Integer {
+			continue
+		}
+		switch value := declaration.Value.(type) {
+		case *IntNum:
+			p.caseName(declaration.Names[0], value.Value)
+		case *CharLiteral:
+			p.caseName(declaration.Names[0], int64(value.Value))
+		}
+	}
+	program.Functions = p.ParseFunctions()
 	program.StatementsBlock = p.StatementsBlock()
 	// check for EOF at the file
 	if token, ok := p.match(EOF); !ok {
 		p.addError(newError(token.Lexeme, []string{"EOF"}, program.Pos))
 	}
+	for _, pos := range p.scanner.lineComments {
+		p.extension("a // comment", pos)
+	}
 	return program
 }
 
 // 	declarations -> declaration declarations | ε
 func (p *Parser) ParseDeclarations() []Declaration {
 	declarations := []Declaration{}
-	for p.lookahead.TokenType == ID {
-		declarations = append(declarations, *p.ParseDeclaration())
+	for p.lookahead.TokenType == ID || p.reservedName(COLON, COMMA) {
+		declaration := p.ParseDeclaration()
+		if declaration.Struct != nil {
+			declarations = append(declarations, p.structFields(declaration)...)
+			continue
+		}
+		declarations = append(declarations, *declaration)
+		if declaration.Enum == nil {
+			continue
+		}
+		// the values are int constants of the enum
+		for i, name := range declaration.Enum.Values {
+			declarations = append(declarations, Declaration{
+				Names: []string{name},
+				Type:  Integer,
+				Const: true,
+				Value: &IntNum{Value: int64(i), Position: declaration.Pos},
+				Enum:  declaration.Enum,
+				Pos:   declaration.Pos,
+			})
+		}
 	}
 
 	return declarations
 }
 
-// 	declaration -> idlist ':' type ';'
+// 	declaration -> idlist ':' type ';' | idlist ':' CONST type '=' constant ';' | idlist ':' enum ';'
+// 	             | idlist ':' struct ';'
+// 	constant -> number | CHAR | TRUE | FALSE
 func (p *Parser) ParseDeclaration() *Declaration {
 	declaration := &Declaration{Pos: p.lookahead.Position}
-	declaration.Names = p.ParseIDList()
+	p.countNode()
+	declaration.Names, declaration.Sizes = p.ParseIDList()
 
 	if token, ok := p.match(COLON); !ok {
 		p.addError(newError(token.Lexeme, []string{":"}, token.Position))
 	}
+	if p.lookahead.TokenType == STRUCT {
+		declaration.Struct = p.ParseStruct(declaration.Names, declaration.Sizes)
+		if token, ok := p.match(SEMICOLON); !ok {
+			p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+		}
+		return declaration
+	}
+	if p.lookahead.TokenType == ENUM {
+		declaration.Type = Integer
+		declaration.Enum = p.ParseEnum()
+		if len(declaration.Names) > 0 {
+			declaration.Enum.Name = declaration.Names[0]
+		}
+		if token, ok := p.match(SEMICOLON); !ok {
+			p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+		}
+		return declaration
+	}
+	if token, ok := p.match(CONST); ok {
+		p.extension("a constant", token.Position)
+		declaration.Const = true
+	}
 	declaration.Type = p.ParseType()
+	if declaration.Const {
+		if token, ok := p.match(EQUALS); !ok {
+			p.addError(newError(token.Lexeme, []string{"="}, token.Position))
+		}
+		if token := p.lookahead.TokenType; token == TRUE || token == FALSE || token == CHAR {
+			declaration.Value = p.Factor()
+		} else {
+			declaration.Value = p.SignedNumber()
+		}
+	}
 	if token, ok := p.match(SEMICOLON); !ok {
 		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
 	}
 	return declaration
 }
 
-// 	type -> INT | FLOAT
+// 	struct -> STRUCT '{' fields '}'
+// 	fields -> idlist ':' type ';' fields | ε
+func (p *Parser) ParseStruct(names []string, sizes []int64) *Struct {
+	token, _ := p.match(STRUCT)
+	p.extension("a struct", token.Position)
+	result := &Struct{Names: names, Sizes: sizes}
+	if token, ok := p.match(LBRACKET); !ok {
+		p.addError(newError(token.Lexeme, []string{"{"}, token.Position))
+	}
+	for p.lookahead.TokenType == ID {
+		field := p.ParseDeclaration()
+		if field.Const || field.Enum != nil || field.Struct != nil {
+			p.addError(ErrorType{Code: CodeFieldType, Message: "a field must be an int, float or bool variable", Pos: field.Pos})
+		}
+		result.Fields = append(result.Fields, *field)
+	}
+	if token, ok := p.match(RBRACKET); !ok {
+		p.addError(newError(token.Lexeme, []string{"}"}, token.Position))
+	}
+	if p.structs == nil {
+		p.structs = map[string]*Struct{}
+	}
+	for _, name := range names {
+		p.structs[name] = result
+	}
+	return result
+}
+
+//returns the declarations of the fields of the variables of a struct declaration
+func (p *Parser) structFields(declaration *Declaration) []Declaration {
+	fields := []Declaration{}
+	for _, field := range declaration.Struct.Fields {
+		result := Declaration{Type: field.Type, Struct: declaration.Struct, Pos: field.Pos}
+		for i, name := range declaration.Names {
+			for j, fieldName := range field.Names {
+				size := declaration.Size(i)
+				if field.Size(j) > 0 && size > 0 {
+					p.addError(ErrorType{
+						Code:    CodeArrayOfStructsField,
+						Message: fmt.Sprintf("field %s of the array of structs %s cannot be an array", fieldName, name),
+						Pos:     field.Pos,
+					})
+				} else if field.Size(j) > 0 {
+					size = field.Size(j)
+				}
+				result.Names = append(result.Names, name+"_"+fieldName)
+				result.Sizes = append(result.Sizes, size)
+			}
+		}
+		fields = append(fields, result)
+	}
+	return fields
+}
+
+// 	enum -> ENUM '{' ID enumvalues '}'
+// 	enumvalues -> ',' ID enumvalues | ε
+func (p *Parser) ParseEnum() *Enum {
+	token, _ := p.match(ENUM)
+	p.extension("an enum", token.Position)
+	enum := &Enum{}
+	if token, ok := p.match(LBRACKET); !ok {
+		p.addError(newError(token.Lexeme, []string{"{"}, token.Position))
+	}
+	for {
+		token, ok := p.match(ID)
+		if !ok {
+			p.addError(idError(token))
+			break
+		}
+		enum.Values = append(enum.Values, token.Lexeme)
+		if _, ok := p.match(COMMA); !ok {
+			break
+		}
+	}
+	if token, ok := p.match(RBRACKET); !ok {
+		p.addError(newError(token.Lexeme, []string{"}"}, token.Position))
+	}
+	for i, name := range enum.Values {
+		p.caseName(name, int64(i))
+	}
+	return enum
+}
+
+//makes a name usable as a case label
+func (p *Parser) caseName(name string, value int64) {
+	if p.caseNames == nil {
+		p.caseNames = map[string]int64{}
+	}
+	p.caseNames[name] = value
+}
+
+// 	type -> INT | FLOAT | BOOL
 func (p *Parser) ParseType() DataType {
-	token, ok := p.match(INT, FLOAT)
+	token, ok := p.match(INT, FLOAT, BOOL)
 	if !ok {
 		p.skip()
-		p.addError(newError(token.Lexeme, []string{"int", "float"}, token.Position))
+		p.addError(newError(token.Lexeme, []string{"int", "float", "bool"}, token.Position))
 		return Unknown
 	}
 	switch token.TokenType {
@@ -134,19 +552,25 @@ func (p *Parser) ParseType() DataType {
 		return Integer
 	case FLOAT:
 		return Float
+	case BOOL:
+		p.extension("the bool type", token.Position)
+		return Bool
 	}
 	return Unknown
 }
 
-// 	idlist -> ID idlist'
-// 	idlist' -> ',' ID idlist' | ε
-func (p *Parser) ParseIDList() []string {
+// 	idlist -> ID [size] idlist'
+// 	idlist' -> ',' ID [size] idlist' | ε
+func (p *Parser) ParseIDList() ([]string, []int64) {
 	names := []string{}
+	sizes := []int64{}
 	// Parse the first name
 	if token, ok := p.match(ID); ok {
 		names = append(names, token.Lexeme)
+		sizes = append(sizes, p.ArraySize())
 	} else {
-		p.addError(newError(token.Lexeme, []string{"ID"}, token.Position))
+		p.addError(idError(token))
+		p.skipReserved()
 	}
 	// Parse other names if exist
 	for p.lookahead.TokenType == COMMA {
@@ -154,18 +578,133 @@ func (p *Parser) ParseIDList() []string {
 
 		if token, ok := p.match(ID); ok {
 			names = append(names, token.Lexeme)
+			sizes = append(sizes, p.ArraySize())
+		} else {
+			p.addError(idError(token))
+			p.skipReserved()
+		}
+	}
+	return names, sizes
+}
+
+// 	size -> '[' NUM ']'
+//returns the number of elements of an array, or 0 for a scalar
+func (p *Parser) ArraySize() int64 {
+	start, ok := p.match(LSQUARE)
+	if !ok {
+		return 0
+	}
+	p.extension("an array", start.Position)
+	var size int64
+	if token, ok := p.match(NUM); ok {
+		value, err := strconv.ParseInt(token.Lexeme, 10, 64)
+		if err != nil || value < 1 {
+			p.addError(ErrorType{Code: CodeArraySize, Message: fmt.Sprintf("array size %s must be a positive int", token.Lexeme), Pos: token.Position})
+		}
+		size = value
+	} else {
+		p.addError(newError(token.Lexeme, []string{"NUM"}, token.Position))
+	}
+	if token, ok := p.match(RSQUARE); !ok {
+		p.addError(newError(token.Lexeme, []string{"]"}, token.Position))
+	}
+	return size
+}
+
+// 	index -> '[' expression ']'
+func (p *Parser) Index() NodeExpression {
+	p.match(LSQUARE)
+	result := p.Expression()
+	if token, ok := p.match(RSQUARE); !ok {
+		p.addError(newError(token.Lexeme, []string{"]"}, token.Position))
+	}
+	return result
+}
+
+// 	functions -> function functions | ε
+func (p *Parser) ParseFunctions() []*Function {
+	functions := []*Function{}
+	for p.lookahead.TokenType == FUNC {
+		functions = append(functions, p.ParseFunction())
+	}
+	return functions
+}
+
+// 	function -> FUNC ID '(' params ')' [':' type] declarations stmt_block
+func (p *Parser) ParseFunction() *Function {
+	token, _ := p.match(FUNC)
+	p.extension("a function", token.Position)
+	p.countNode()
+	function := &Function{Pos: token.Position}
+	if token, ok := p.match(ID); ok {
+		function.Name = token.Lexeme
+	} else {
+		p.addError(idError(token))
+	}
+	if token, ok := p.match(LPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
+	}
+	function.Params = p.ParseParameters()
+	if token, ok := p.match(RPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
+	}
+	if _, ok := p.match(COLON); ok {
+		function.ReturnType = p.ParseType()
+	}
+	function.Declarations = p.ParseDeclarations()
+	function.Body = p.StatementsBlock()
+	return function
+}
+
+// 	params -> param params' | ε
+// 	params' -> ',' param params' | ε
+// 	param -> ID ':' type
+func (p *Parser) ParseParameters() []Parameter {
+	params := []Parameter{}
+	if p.lookahead.TokenType != ID {
+		return params
+	}
+	for {
+		param := Parameter{Pos: p.lookahead.Position}
+		p.countNode()
+		if token, ok := p.match(ID); ok {
+			param.Name = token.Lexeme
 		} else {
-			p.addError(newError(token.Lexeme, []string{"ID"}, token.Position))
+			p.addError(idError(token))
+		}
+		if token, ok := p.match(COLON); !ok {
+			p.addError(newError(token.Lexeme, []string{":"}, token.Position))
+		}
+		param.Type = p.ParseType()
+		params = append(params, param)
+		if _, ok := p.match(COMMA); !ok {
+			return params
 		}
 	}
-	return names
 }
 
-//	stmt -> assignment_stmt | input_stmt | output_stmt | if_stmt | while_stmt| switch_stmt | break_stmt | stmt_block
+//	stmt -> assignment_stmt | call_stmt | input_stmt | output_stmt | if_stmt | while_stmt| for_stmt | do_stmt
+//	      | switch_stmt | break_stmt | continue_stmt | fallthrough_stmt | return_stmt | stmt_block
 func (p *Parser) Statement() Statement {
+	if p.lookahead.TokenType != EOF {
+		p.countNode()
+	}
+	if p.reservedName(EQUALS, ASSIGNOP, INCDEC) {
+		return nil
+	}
 	switch p.lookahead.TokenType {
 	case ID:
-		return p.AssignmentStatement()
+		if p.declarationAhead() {
+			p.addError(ErrorType{Code: CodeDeclarationAfterStatement, Message: "a declaration must come before the statements", Pos: p.lookahead.Position})
+			block := &Block{Position: p.lookahead.Position}
+			p.ParseDeclaration()
+			return block
+		}
+		name, _ := p.match(ID)
+		if p.lookahead.TokenType == LPAREN {
+			return p.CallStatement(name)
+		}
+		return p.AssignmentStatement(name)
 
 	case INPUT:
 		return p.InputStatement()
@@ -179,64 +718,207 @@ func (p *Parser) Statement() Statement {
 	case WHILE:
 		return p.WhileStatement()
 
+	case FOR:
+		return p.ForStatement()
+
+	case DO:
+		return p.DoWhileStatement()
+
 	case SWITCH:
 		return p.SwitchStatement()
 
 	case BREAK:
 		return p.BreakStatement()
 
+	case CONTINUE:
+		return p.ContinueStatement()
+
+	case FALLTHROUGH:
+		return p.FallthroughStatement()
+
+	case RETURN:
+		return p.ReturnStatement()
+
 	case LBRACKET:
 		return p.StatementsBlock()
 	}
 	return nil
 }
 
-// 	assignment_stmt -> ID '=' assignment_stmt'
-// 	assignment_stmt' -> expression ';'| STATIC_CAST '(' type ')' '(' expression ')' ';
-func (p *Parser) AssignmentStatement() *Assignment {
-	result := &Assignment{Pos: p.lookahead.Position}
+//reports whether the statement at the lookahead is a declaration, x : int; or
+//a[3], b : float;, which parses the names up to the : to tell a[3] from a[i] = 1
+func (p *Parser) declarationAhead() bool {
+	switch p.peek(1).TokenType {
+	case COLON, COMMA:
+		return true
+	case LSQUARE:
+		m := p.mark()
+		defer p.reset(m)
+		p.ParseIDList()
+		return p.lookahead.TokenType == COLON
+	}
+	return false
+}
 
-	if token, ok := p.match(ID); ok {
-		result.Variable = token.Lexeme
-	} else {
-		p.addError(newError(token.Lexeme, []string{"ID"}, token.Position))
+// 	assignment_stmt -> assignment ';'
+// 	assignment -> reference '=' value | reference '=' assignment | reference ASSIGNOP expression | reference INCDEC
+func (p *Parser) AssignmentStatement(name *Token) *Assignment {
+	result := p.assignment(name)
+	if token, ok := p.match(SEMICOLON); !ok {
+		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+	}
+	return result
+}
+
+//parses an assignment without its ';', as in the header of a for loop
+func (p *Parser) assignment(name *Token) *Assignment {
+	result := &Assignment{Pos: name.Position}
+	result.Variable, result.Index = p.reference(name)
+
+	// a += b is parsed as a = a + b, and a++ as a = a + 1
+	var target NodeExpression = &Variable{Variable: result.Variable, Position: name.Position}
+	if result.Index != nil {
+		target = &Element{Array: result.Variable, Index: result.Index, Position: name.Position}
+	}
+	if token, ok := p.match(ASSIGNOP); ok {
+		p.extension("a compound assignment", token.Position)
+		result.Val = &Arithmetic{
+			LHS:      target,
+			Operator: token.Operator,
+			RHS:      p.Expression(),
+			Position: token.Position,
+		}
+		return result
+	}
+	if token, ok := p.match(INCDEC); ok {
+		p.extension("the "+token.Lexeme+" operator", token.Position)
+		result.Val = &Arithmetic{
+			LHS:      target,
+			Operator: token.Operator,
+			RHS:      &IntNum{Value: 1, Position: token.Position},
+			Position: token.Position,
+		}
+		return result
 	}
 	if token, ok := p.match(EQUALS); !ok {
-		p.addError(newError(token.Lexeme, []string{"ID"}, token.Position))
+		p.addError(newError(token.Lexeme, []string{"="}, token.Position))
 	}
-	if p.lookahead.TokenType == STATICCAST {
-		p.match(STATICCAST)
-
-		if token, ok := p.match(LPAREN); !ok {
-			p.addError(newError(token.Lexeme, []string{"("}, token.Position))
+	if p.lookahead.TokenType != STATICCAST {
+		result.Val = p.Value()
+		if p.lookahead.TokenType == EQUALS {
+			result.Val = p.chainedAssignment(result.Val)
 		}
-		result.CastType = p.ParseType()
+		return result
+	}
+	// standard CPL casts the whole value only
+	position := p.lookahead.Position
+	p.castValue = true
+	result.Val = p.Value()
+	if _, ok := result.Val.(*Cast); !ok {
+		p.extension("a static_cast inside an expression", position)
+	}
+	return result
+}
 
-		if token, ok := p.match(RPAREN); !ok {
-			p.addError(newError(token.Lexeme, []string{")"}, token.Position))
+//parses the rest of a = b = 1 after a = b, where b is the value parsed so far
+func (p *Parser) chainedAssignment(target NodeExpression) NodeExpression {
+	token := p.lookahead
+	p.extension("a chained assignment", token.Position)
+	var name Token
+	switch t := target.(type) {
+	case *Variable:
+		name = Token{TokenType: ID, Lexeme: t.Variable, Position: t.Position}
+	case *Element:
+		name = Token{TokenType: ID, Lexeme: t.Array, Position: t.Position}
+	default:
+		p.match(EQUALS)
+		p.addError(ErrorType{Code: CodeAssignTarget, Message: "only a variable can be assigned", Pos: token.Position})
+		return target
+	}
+	result := p.assignment(&name)
+	if element, ok := target.(*Element); ok {
+		result.Variable, result.Index = element.Array, element.Index
+	}
+	return result
+}
+
+// 	call_stmt -> ID '(' arglist ')' ';'
+func (p *Parser) CallStatement(name *Token) *Call {
+	result := p.Call(name)
+	if token, ok := p.match(SEMICOLON); !ok {
+		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+	}
+	return result
+}
+
+// 	call -> ID '(' arglist ')'
+// 	arglist -> expression arglist' | ε
+// 	arglist' -> ',' expression arglist' | ε
+func (p *Parser) Call(name *Token) *Call {
+	result := &Call{Function: name.Lexeme, Position: name.Position, Args: []NodeExpression{}}
+	p.match(LPAREN)
+	if p.lookahead.TokenType != RPAREN {
+		result.Args = append(result.Args, p.Value())
+		for p.lookahead.TokenType == COMMA {
+			p.match(COMMA)
+			result.Args = append(result.Args, p.Value())
 		}
 	}
+	if token, ok := p.match(RPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
+	}
+	return result
+}
+
+// 	return_stmt -> RETURN [expression] ';'
+func (p *Parser) ReturnStatement() *Return {
+	token, _ := p.match(RETURN)
+	result := &Return{Position: token.Position}
+	if p.lookahead.TokenType != SEMICOLON {
+		result.Value = p.Value()
+	}
 	if token, ok := p.match(SEMICOLON); !ok {
 		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
 	}
 	return result
 }
 
-// 	input_stmt -> INPUT '(' ID ')' ';'
+// 	input_stmt -> INPUT '(' ID [index] [IN number DOTDOT number] ')' ';'
 func (p *Parser) InputStatement() *Input {
-	if _, ok := p.match(INPUT); !ok {
+	token, ok := p.match(INPUT)
+	if !ok {
 		return nil
 	}
 
-	result := &Input{Pos: p.lookahead.Position}
+	result := &Input{Pos: token.Position}
 
 	if token, ok := p.match(LPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
 	}
-	if token, ok := p.match(ID); ok {
-		result.Variable = token.Lexeme
+	if p.lookahead.TokenType == RPAREN {
+		p.addError(idError(&p.lookahead))
 	} else {
-		p.addError(newError(token.Lexeme, []string{"ID"}, token.Position))
+		// parsed as an expression, to report input(x + 1) as a whole
+		position := p.lookahead.Position
+		switch target := p.Expression().(type) {
+		case *Variable:
+			result.Variable = target.Variable
+		case *Element:
+			result.Variable, result.Index = target.Array, target.Index
+		case nil:
+		default:
+			p.addError(ErrorType{Code: CodeInputExpression, Message: "input needs a variable, not an expression", Pos: position})
+		}
+	}
+	// "in" is only a keyword here, so it stays usable as a variable name
+	if p.lookahead.TokenType == ID && p.lookahead.Lexeme == "in" {
+		token, _ := p.match(ID)
+		p.extension("input range validation", token.Position)
+		result.Min = p.SignedNumber()
+		if token, ok := p.match(DOTDOT); !ok {
+			p.addError(newError(token.Lexeme, []string{".."}, token.Position))
+		}
+		result.Max = p.SignedNumber()
 	}
 	if token, ok := p.match(RPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
@@ -247,16 +929,61 @@ func (p *Parser) InputStatement() *Input {
 	return result
 }
 
+// 	number -> ['+' | '-'] NUM
+func (p *Parser) SignedNumber() NodeExpression {
+	negative := false
+	if p.lookahead.TokenType == ADDOP {
+		sign, _ := p.match(ADDOP)
+		negative = sign.Lexeme == "-"
+	}
+	token, ok := p.match(NUM)
+	if !ok {
+		p.addError(newError(token.Lexeme, []string{"NUM"}, token.Position))
+		return nil
+	}
+	return p.number(token, negative)
+}
+
+//returns the IntNum or FloatNum of a NUM token
+func (p *Parser) number(token *Token, negative bool) NodeExpression {
+	p.countNode()
+	if strings.ContainsAny(token.Lexeme, "eE") {
+		p.extension("a number with an exponent", token.Position)
+	} else if strings.HasPrefix(token.Lexeme, ".") {
+		p.extension("a number without digits before its point", token.Position)
+	}
+	if strings.ContainsAny(token.Lexeme, ".eE") {
+		value, err := strconv.ParseFloat(token.Lexeme, 64)
+		if err != nil {
+			p.addError(ErrorType{Code: CodeNotNumber, Message: fmt.Sprintf("%s is not a number", token.Lexeme), Pos: token.Position})
+		}
+		if negative {
+			value = -value
+		}
+		return &FloatNum{Value: value, Position: token.Position}
+	}
+	value, err := strconv.ParseInt(token.Lexeme, 10, 64)
+	if err != nil {
+		p.addError(ErrorType{Code: CodeNotInt, Message: fmt.Sprintf("%s is not an int", token.Lexeme), Pos: token.Position})
+	}
+	if negative {
+		value = -value
+	}
+	return &IntNum{Value: value, Position: token.Position}
+}
+
 // 	output_stmt -> OUTPUT '(' expression ')' ';'
 func (p *Parser) OutputStatement() *Output {
-	if _, ok := p.match(OUTPUT); !ok {
+	token, ok := p.match(OUTPUT)
+	if !ok {
 		return nil
 	}
-	result := &Output{Position: p.lookahead.Position}
+	result := &Output{Position: token.Position}
 
 	if token, ok := p.match(LPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
 	}
+	result.Value = p.Value()
 	if token, ok := p.match(RPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
 	}
@@ -266,17 +993,20 @@ func (p *Parser) OutputStatement() *Output {
 	return result
 }
 
-// 	if_stmt -> IF '(' boolexpr ')' stmt ELSE stmt
+// 	if_stmt -> IF '(' boolexpr ')' stmt ELSE stmt | IF '(' boolexpr ')' stmt
+//the else is optional outside standard CPL, and belongs to the nearest if,
+//so else if (...) chains need no braces
 func (p *Parser) IfStatement() *IfStatement {
-	if _, ok := p.match(IF); !ok {
+	token, ok := p.match(IF)
+	if !ok {
 		return nil
 	}
-	result := &IfStatement{Position: p.lookahead.Position}
+	result := &IfStatement{Position: token.Position}
 
 	if token, ok := p.match(LPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
 	}
-	result.Condition = p.BooleanExpression()
+	result.Condition = p.Condition()
 
 	if token, ok := p.match(RPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
@@ -284,7 +1014,9 @@ func (p *Parser) IfStatement() *IfStatement {
 	result.IfBranch = p.Statement()
 
 	if token, ok := p.match(ELSE); !ok {
-		p.addError(newError(token.Lexeme, []string{"else"}, token.Position))
+		if p.Std == StdCPL {
+			p.addError(newError(token.Lexeme, []string{"else"}, token.Position))
+		}
 		return result
 	}
 
@@ -294,15 +1026,16 @@ func (p *Parser) IfStatement() *IfStatement {
 
 // 	while_stmt -> WHILE '(' boolexpr ')' stmt
 func (p *Parser) WhileStatement() *WhileStatement {
-	if _, ok := p.match(WHILE); !ok {
+	token, ok := p.match(WHILE)
+	if !ok {
 		return nil
 	}
-	result := &WhileStatement{Position: p.lookahead.Position}
+	result := &WhileStatement{Position: token.Position}
 
 	if token, ok := p.match(LPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
 	}
-	result.Condition = p.BooleanExpression()
+	result.Condition = p.Condition()
 	if token, ok := p.match(RPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
 	}
@@ -310,16 +1043,71 @@ func (p *Parser) WhileStatement() *WhileStatement {
 	return result
 }
 
-// 	switch_stmt -> SWITCH '(' expression ')' '{' caselist DEFAULT ':' stmtlist '}'
+// 	for_stmt -> FOR '(' [assignment] ';' boolexpr ';' [assignment] ')' stmt
+func (p *Parser) ForStatement() *ForStatement {
+	token, _ := p.match(FOR)
+	p.extension("a for loop", token.Position)
+	result := &ForStatement{Position: token.Position}
+
+	if token, ok := p.match(LPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
+	}
+	if name, ok := p.match(ID); ok {
+		result.Init = p.assignment(name)
+	}
+	if token, ok := p.match(SEMICOLON); !ok {
+		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+	}
+	result.Condition = p.Condition()
+	if token, ok := p.match(SEMICOLON); !ok {
+		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+	}
+	if name, ok := p.match(ID); ok {
+		result.Step = p.assignment(name)
+	}
+	if token, ok := p.match(RPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
+	}
+	result.Body = p.Statement()
+	return result
+}
+
+// 	do_stmt -> DO stmt WHILE '(' boolexpr ')' ';'
+func (p *Parser) DoWhileStatement() *DoWhileStatement {
+	token, _ := p.match(DO)
+	p.extension("a do-while loop", token.Position)
+	result := &DoWhileStatement{Position: token.Position}
+	result.Body = p.Statement()
+
+	if token, ok := p.match(WHILE); !ok {
+		p.addError(newError(token.Lexeme, []string{"while"}, token.Position))
+	}
+	if token, ok := p.match(LPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
+	}
+	result.Condition = p.Condition()
+	if token, ok := p.match(RPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
+	}
+	if token, ok := p.match(SEMICOLON); !ok {
+		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+	}
+	return result
+}
+
+// 	switch_stmt -> SWITCH '(' value ')' '{' caselist DEFAULT ':' stmtlist '}'
 func (p *Parser) SwitchStatement() *Switch {
-	if _, ok := p.match(SWITCH); !ok {
+	token, ok := p.match(SWITCH)
+	if !ok {
 		return nil
 	}
-	result := &Switch{Position: p.lookahead.Position}
+	result := &Switch{Position: token.Position}
 
 	if token, ok := p.match(LPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
 	}
+	// any value, whose type is checked by the analysis: switch (a > 1) is a bool
+	result.Expression = p.Value()
 
 	if token, ok := p.match(RPAREN); !ok {
 		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
@@ -345,19 +1133,31 @@ func (p *Parser) SwitchStatement() *Switch {
 	return result
 }
 
+// 	caselist -> CASE label labels ':' stmtlist caselist | ε
+// 	labels -> ',' label labels | ε
+// 	label -> casevalue | casevalue DOTDOT casevalue
 func (p *Parser) SwitchCases() []SwitchCase {
 	cases := []SwitchCase{}
 	for p.lookahead.TokenType == CASE {
 		item := SwitchCase{Position: p.lookahead.Position}
+		p.countNode()
 		p.match(CASE)
-		if token, ok := p.match(NUM); ok {
-			value, err := strconv.ParseInt(token.Lexeme, 10, 64)
-			if err != nil {
-				p.addError(ErrorType{Message: fmt.Sprintf("%s is not an int", token.Lexeme)})
+		for {
+			label := CaseLabel{}
+			label.Min, label.Text = p.caseValue()
+			label.Max = label.Min
+			if token, ok := p.match(DOTDOT); ok {
+				p.extension("a case range", token.Position)
+				var max string
+				label.Max, max = p.caseValue()
+				label.Text += ".." + max
 			}
-			item.Value = value
-		} else {
-			p.addError(newError(token.Lexeme, []string{"NUM"}, token.Position))
+			item.Labels = append(item.Labels, label)
+			token, ok := p.match(COMMA)
+			if !ok {
+				break
+			}
+			p.extension("a list of case values", token.Position)
 		}
 		if token, ok := p.match(COLON); !ok {
 			p.addError(newError(token.Lexeme, []string{":"}, token.Position))
@@ -369,6 +1169,42 @@ func (p *Parser) SwitchCases() []SwitchCase {
 	return cases
 }
 
+// 	casevalue -> ['+' | '-'] NUM | CHAR | ID
+//returns the value of a case label and the label as written
+func (p *Parser) caseValue() (int64, string) {
+	if p.lookahead.TokenType == CHAR {
+		text := p.lookahead.Lexeme
+		return int64(p.Char().Value), text
+	}
+	if token, ok := p.match(ID); ok {
+		value, ok := p.caseNames[token.Lexeme]
+		if !ok {
+			p.addError(ErrorType{Code: CodeNotEnumValue, Message: fmt.Sprintf("%s is not an enum value or an int constant", token.Lexeme), Pos: token.Position})
+		}
+		return value, token.Lexeme
+	}
+	// optional sign: case -1:
+	sign := ""
+	if p.lookahead.TokenType == ADDOP {
+		token, _ := p.match(ADDOP)
+		p.extension("a signed case label", token.Position)
+		sign = token.Lexeme
+	}
+	token, ok := p.match(NUM)
+	if !ok {
+		p.addError(newError(token.Lexeme, []string{"NUM"}, token.Position))
+		return 0, sign
+	}
+	value, err := strconv.ParseInt(token.Lexeme, 10, 64)
+	if err != nil {
+		p.addError(ErrorType{Code: CodeNotInt, Message: fmt.Sprintf("%s is not an int", token.Lexeme), Pos: token.Position})
+	}
+	if sign == "-" {
+		value = -value
+	}
+	return value, sign + token.Lexeme
+}
+
 // 	break_stmt -> BREAK ';'
 func (p *Parser) BreakStatement() *Break {
 	result := &Break{Position: p.lookahead.Position}
@@ -384,6 +1220,30 @@ func (p *Parser) BreakStatement() *Break {
 	return result
 }
 
+// 	continue_stmt -> CONTINUE ';'
+func (p *Parser) ContinueStatement() *Continue {
+	token, _ := p.match(CONTINUE)
+	p.extension("a continue statement", token.Position)
+	result := &Continue{Position: token.Position}
+
+	if token, ok := p.match(SEMICOLON); !ok {
+		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+	}
+	return result
+}
+
+// 	fallthrough_stmt -> FALLTHROUGH ';'
+func (p *Parser) FallthroughStatement() *Fallthrough {
+	token, _ := p.match(FALLTHROUGH)
+	p.extension("a fallthrough statement", token.Position)
+	result := &Fallthrough{Position: token.Position}
+
+	if token, ok := p.match(SEMICOLON); !ok {
+		p.addError(newError(token.Lexeme, []string{";"}, token.Position))
+	}
+	return result
+}
+
 //	stmt_block -> '{' stmtlist '}'
 func (p *Parser) StatementsBlock() *Block {
 	// Parse {
@@ -394,17 +1254,18 @@ func (p *Parser) StatementsBlock() *Block {
 	}
 	statements := p.Statements()
 	// Only show an error for the } if there was a {
-	if token, ok := p.match(RBRACKET); !ok && startBlock {
-		p.addError(newError(token.Lexeme, []string{"}"}, token.Position))
+	endBlockToken, ok := p.match(RBRACKET)
+	if !ok && startBlock {
+		p.addError(newError(endBlockToken.Lexeme, []string{"}"}, endBlockToken.Position))
 	}
-	return &Block{Position: startBlockToken.Position, Statements: statements}
+	return &Block{Position: startBlockToken.Position, Statements: statements, End: endBlockToken.Position}
 }
 
 //	stmtlist -> stmt stmtlist | ε
 func (p *Parser) Statements() []Statement {
 	statements := []Statement{}
 	for {
-		statement := p.Statement()
+		statement := p.nextStatement()
 		if statement == nil {
 			break
 		}
@@ -413,12 +1274,70 @@ func (p *Parser) Statements() []Statement {
 	return statements
 }
 
+//tokens that end a list of statements
+var statementListEnd = map[TokenType]bool{RBRACKET: true, CASE: true, DEFAULT: true, EOF: true}
+
+//tokens that start a statement, where the parse resumes after a syntax error
+var statementStart = map[TokenType]bool{
+	INPUT: true, OUTPUT: true, IF: true, WHILE: true, FOR: true, DO: true, SWITCH: true, BREAK: true,
+	CONTINUE: true, FALLTHROUGH: true, RETURN: true, LBRACKET: true,
+}
+
+//parses the next statement of a list, nil at its end. A token that cannot start a
+//statement is reported and skipped, and after a statement with a syntax error the
+//tokens up to the end of the statement are skipped, so the statements that follow
+//are still checked without errors caused by the first one.
+func (p *Parser) nextStatement() Statement {
+	for {
+		errors := len(p.Errors)
+		statement := p.Statement()
+		if statement != nil {
+			if len(p.Errors) > errors {
+				p.synchronize()
+			}
+			return statement
+		}
+		if statementListEnd[p.lookahead.TokenType] {
+			return nil
+		}
+		p.addError(newError(p.lookahead.Lexeme, []string{"statement"}, p.lookahead.Position))
+		p.skip()
+		p.synchronize()
+	}
+}
+
+//skips tokens to the end of the current statement: past the next ';', or up to a '}',
+//the start of a statement or an identifier on a new line
+func (p *Parser) synchronize() {
+	line := p.previous.Position.Line
+	if p.previous.TokenType == SEMICOLON || p.previous.TokenType == RBRACKET {
+		return
+	}
+	for !statementListEnd[p.lookahead.TokenType] && !statementStart[p.lookahead.TokenType] {
+		if p.lookahead.TokenType == ID && p.lookahead.Position.Line > line {
+			return
+		}
+		if _, ok := p.match(SEMICOLON); ok {
+			return
+		}
+		p.skip()
+	}
+}
+
+//parses the condition of an if, while, do while or for statement
+func (p *Parser) Condition() Boolean {
+	p.condition = true
+	defer func() { p.condition = false }()
+	return p.BooleanExpression()
+}
+
 // 	boolexpr -> boolterm boolexpr'
 // 	boolexpr' -> OR boolterm boolexpr | ε
 func (p *Parser) BooleanExpression() Boolean {
 	result := p.BooleanTerm()
 	for p.lookahead.TokenType == OR {
 		token, _ := p.match(OR)
+		p.countNode()
 		result = &Or{
 			Position: token.Position,
 			LHS:      result,
@@ -435,6 +1354,7 @@ func (p *Parser) BooleanTerm() Boolean {
 	result := p.BooleanFactor()
 	for p.lookahead.TokenType == AND {
 		token, _ := p.match(AND)
+		p.countNode()
 		result = &And{
 			Position: token.Position,
 			LHS:      result,
@@ -445,23 +1365,255 @@ func (p *Parser) BooleanTerm() Boolean {
 	return result
 }
 
-// 	boolfactor -> NOT '(' boolexpr ')' | expression RELOP expression
+// 	boolfactor -> NOT '(' boolexpr ')' | NOT boolfactor | expression RELOP expression | expression
 func (p *Parser) BooleanFactor() Boolean {
 	position := p.lookahead.Position
+	p.countNode()
 	if p.lookahead.TokenType == NOT {
 		p.match(NOT)
+		if p.lookahead.TokenType != LPAREN {
+			p.extension("! without parentheses", position)
+			return &Not{Position: position, Value: p.BooleanFactor()}
+		}
 		if token, ok := p.match(LPAREN); !ok {
 			p.addError(newError(token.Lexeme, []string{"("}, token.Position))
+		}
+		expr := p.BooleanExpression()
+		if token, ok := p.match(RPAREN); !ok {
+			p.addError(newError(token.Lexeme, []string{")"}, token.Position))
+		}
+		return &Not{Position: position, Value: expr}
+	}
+	lhs := p.Expression()
+	token, ok := p.match(RELOP)
+	if !ok && p.condition && p.lookahead.TokenType == EQUALS {
+		// if (a = b), parsed as the a == b that was meant
+		p.addError(newError(p.lookahead.Lexeme, []string{"=="}, p.lookahead.Position))
+		token, ok = p.match(EQUALS)
+		token.Operator = EqualTo
+	}
+	if !ok {
+		// a bool value, checked by the code generator
+		return &BoolTest{Position: position, Value: lhs}
+	}
+	return &Compare{
+		Position: position,
+		LHS:      lhs,
+		Operator: token.Operator,
+		RHS:      p.Expression(),
+	}
+}
+
+// 	value -> boolexpr | boolexpr '?' value ':' value
+//returns an expression, which is a Condition when the value uses RELOP, &&, || or !
+func (p *Parser) Value() NodeExpression {
+	position := p.lookahead.Position
+	condition := p.BooleanExpression()
+	if token, ok := p.match(QUESTION); ok {
+		p.extension("a conditional expression", token.Position)
+		result := &Conditional{Condition: condition, Position: position}
+		result.Then = p.Value()
+		if token, ok := p.match(COLON); !ok {
+			p.addError(newError(token.Lexeme, []string{":"}, token.Position))
+		}
+		result.Else = p.Value()
+		return result
+	}
+	if test, ok := condition.(*BoolTest); ok {
+		return test.Value
+	}
+	return &Condition{Value: condition, Position: position}
+}
 
-			expr := p.BooleanExpression()
+// 	expression -> term expression'
+// 	expression' -> ADDOP term expression' | ε
+func (p *Parser) Expression() NodeExpression {
+	result := p.Term()
+	for p.lookahead.TokenType == ADDOP {
+		token, _ := p.match(ADDOP)
+		p.countNode()
+		result = &Arithmetic{
+			Position: token.Position,
+			LHS:      result,
+			Operator: token.Operator,
+			RHS:      p.Term(),
+		}
+	}
+	return result
+}
 
-			if token, ok := p.match(RPAREN); !ok {
-				p.addError(newError(token.Lexeme, []string{")"}, token.Position))
-			}
+// 	term -> factor term'
+// 	term' -> MULOP factor term' | ε
+func (p *Parser) Term() NodeExpression {
+	result := p.Factor()
+	for p.lookahead.TokenType == MULOP {
+		token, _ := p.match(MULOP)
+		p.countNode()
+		if token.Operator == Modulo {
+			p.extension("the % operator", token.Position)
+		}
+		result = &Arithmetic{
+			Position: token.Position,
+			LHS:      result,
+			Operator: token.Operator,
+			RHS:      p.Factor(),
+		}
+	}
+	return result
+}
+
+// 	factor -> '(' value ')' | ID | ID index | call | cast | NUM | CHAR | TRUE | FALSE | STRING
+// 	        | ADDOP factor
+func (p *Parser) Factor() NodeExpression {
+	switch p.lookahead.TokenType {
+	case ADDOP:
+		return p.unary()
+	case LPAREN:
+		token, _ := p.match(LPAREN)
+		result := p.Value()
+		if _, ok := result.(*Condition); ok {
+			p.extension("a condition in parentheses", token.Position)
+		}
+		if token, ok := p.match(RPAREN); !ok {
+			p.addError(newError(token.Lexeme, []string{")"}, token.Position))
+		}
+		return result
+	case ID:
+		p.countNode()
+		token, _ := p.match(ID)
+		if p.lookahead.TokenType == LPAREN {
+			return p.Call(token)
+		}
+		name, index := p.reference(token)
+		if index != nil {
+			return &Element{Array: name, Index: index, Position: token.Position}
+		}
+		return &Variable{Variable: name, Position: token.Position}
+	case NUM:
+		token, _ := p.match(NUM)
+		return p.number(token, false)
+	case TRUE, FALSE:
+		p.countNode()
+		token, _ := p.match(TRUE, FALSE)
+		return &BoolLiteral{Value: token.TokenType == TRUE, Position: token.Position}
+	case STATICCAST:
+		return p.Cast()
+	case CHAR:
+		return p.Char()
+	case STRING:
+		p.countNode()
+		token, _ := p.match(STRING)
+		p.extension("a string literal", token.Position)
+		value, err := strconv.Unquote(token.Lexeme)
+		if err != nil {
+			p.addError(ErrorType{Code: CodeStringEscape, Message: fmt.Sprintf("invalid escape sequence in string %s", token.Lexeme), Pos: token.Position})
+		}
+		return &StringLiteral{Value: value, Position: token.Position}
+	}
+	if reserved(&p.lookahead) {
+		p.addError(idError(&p.lookahead))
+		p.skip()
+		return nil
+	}
+	p.addError(newError(p.lookahead.Lexeme, []string{"(", "ID", "NUM", "CHAR", "STRING", "true", "false", "static_cast"}, p.lookahead.Position))
+	return nil
+}
+
+//parses a factor with a sign: -5 is the number, +a is a, and -a is parsed as 0 - a
+func (p *Parser) unary() NodeExpression {
+	sign, _ := p.match(ADDOP)
+	p.extension("a unary "+sign.Lexeme, sign.Position)
+	if token, ok := p.match(NUM); ok {
+		return p.number(token, sign.Lexeme == "-")
+	}
+	operand := p.Factor()
+	if sign.Lexeme == "+" {
+		return operand
+	}
+	p.countNode()
+	return &Arithmetic{
+		Position: sign.Position,
+		LHS:      &IntNum{Position: sign.Position},
+		Operator: Subtract,
+		RHS:      operand,
+	}
+}
+
+// 	char -> CHAR
+func (p *Parser) Char() *CharLiteral {
+	p.countNode()
+	token, _ := p.match(CHAR)
+	p.extension("a character literal", token.Position)
+	result := &CharLiteral{Position: token.Position}
+	value, err := strconv.Unquote(token.Lexeme)
+	if runes := []rune(value); err != nil || len(runes) != 1 {
+		p.addError(ErrorType{Code: CodeCharLiteral, Message: fmt.Sprintf("%s is not a single character", token.Lexeme), Pos: token.Position})
+	} else {
+		result.Value = runes[0]
+	}
+	return result
+}
 
-			return &Not{Position: position, Value: expr}
+// 	reference -> ID [index] | ID [index] '.' ID [index]
+//returns the variable that the name after ID refers to, and its index or nil; the
+//field x of a struct p is the variable p_x
+func (p *Parser) reference(name *Token) (string, NodeExpression) {
+	var index NodeExpression
+	if p.lookahead.TokenType == LSQUARE {
+		index = p.Index()
+	}
+	if _, ok := p.match(DOT); !ok {
+		return name.Lexeme, index
+	}
+	field, ok := p.match(ID)
+	if !ok {
+		p.addError(idError(field))
+		return name.Lexeme, index
+	}
+	if s := p.structs[name.Lexeme]; s == nil {
+		p.addError(ErrorType{Code: CodeNotStruct, Message: fmt.Sprintf("%s is not a struct", name.Lexeme), Pos: name.Position})
+	} else if !s.hasField(field.Lexeme) {
+		p.addError(ErrorType{Code: CodeNoField, Message: fmt.Sprintf("%s has no field %s", name.Lexeme, field.Lexeme), Pos: field.Position})
+	}
+	if p.lookahead.TokenType == LSQUARE {
+		if index != nil {
+			p.addError(ErrorType{Code: CodeArrayOfStructsArray, Message: "an array of structs has no array fields", Pos: p.lookahead.Position})
+		}
+		index = p.Index()
+	}
+	return name.Lexeme + "_" + field.Lexeme, index
+}
+
+// 	cast -> STATIC_CAST '(' type ')' '(' expression ')' | STATIC_CAST '<' type '>' '(' expression ')'
+func (p *Parser) Cast() *Cast {
+	token, _ := p.match(STATICCAST)
+	if !p.castValue {
+		p.extension("a static_cast inside an expression", token.Position)
+	}
+	p.castValue = false
+	p.countNode()
+	result := &Cast{Position: token.Position}
+	if p.lookahead.Operator == LessThan && p.lookahead.TokenType == RELOP {
+		p.match(RELOP)
+		result.Type = p.ParseType()
+		if token, ok := p.match(RELOP, RPAREN); !ok || token.Operator != GreaterThan {
+			p.addError(newError(token.Lexeme, []string{">"}, token.Position))
+		}
+	} else {
+		if token, ok := p.match(LPAREN); !ok {
+			p.addError(newError(token.Lexeme, []string{"(", "<"}, token.Position))
+		}
+		result.Type = p.ParseType()
+		if token, ok := p.match(RPAREN); !ok {
+			p.addError(newError(token.Lexeme, []string{")"}, token.Position))
 		}
 	}
-	expr := p.BooleanExpression()
-	return &Not{Position: position, Value: expr}
+	if token, ok := p.match(LPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{"("}, token.Position))
+	}
+	result.Value = p.Expression()
+	if token, ok := p.match(RPAREN); !ok {
+		p.addError(newError(token.Lexeme, []string{")"}, token.Position))
+	}
+	return result
 }
@@ -0,0 +1,277 @@
+package cpq
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+//returns the shape of the ifs of a statement, as if(then)else(else) with the number an
+//output prints for the outputs and {...} for a block
+func ifShape(statement Statement) string {
+	switch node := statement.(type) {
+	case *IfStatement:
+		shape := "if(" + ifShape(node.IfBranch) + ")"
+		if node.ElseBranch != nil {
+			shape += "else(" + ifShape(node.ElseBranch) + ")"
+		}
+		return shape
+	case *Output:
+		if number, ok := node.Value.(*IntNum); ok {
+			return fmt.Sprint(number.Value)
+		}
+	case *Block:
+		shapes := []string{}
+		for _, statement := range node.Statements {
+			shapes = append(shapes, ifShape(statement))
+		}
+		return "{" + strings.Join(shapes, " ") + "}"
+	}
+	return "?"
+}
+
+//an else goes with the closest if that has none, with or without braces around the ifs
+func TestParseDanglingElse(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      string
+	}{
+		{"if (a > 0) if (a > 5) output(1); else output(2);", "if(if(1)else(2))"},
+		{"if (a > 0) if (a > 5) output(1); else output(2); else output(3);", "if(if(1)else(2))else(3)"},
+		{"if (a > 0) { if (a > 5) output(1); } else output(2);", "if({if(1)})else(2)"},
+		{"if (a == 1) output(1); else if (a == 2) output(2); else if (a == 3) output(3); else output(4);",
+			"if(1)else(if(2)else(if(3)else(4)))"},
+		{"if (a == 1) output(1); else if (a == 2) if (a > 0) output(2); else output(3);",
+			"if(1)else(if(if(2)else(3)))"},
+	}
+	for _, test := range tests {
+		program, errors := Parse("a : int;\n{ " + test.statement + " }\n")
+		if len(errors) > 0 {
+			t.Errorf("%s: %v", test.statement, errors)
+			continue
+		}
+		if got := ifShape(program.StatementsBlock.Statements[0]); got != test.want {
+			t.Errorf("%s\nparsed as %s, want %s", test.statement, got, test.want)
+		}
+	}
+}
+
+//case labels keep the text they are written with next to their values
+func TestParseCaseLabels(t *testing.T) {
+	src := "c : enum { red, green, blue };\nk : const int = 7;\nz : const int = 'z';\na : int;\n" +
+		"{ input(a); switch (a) { case blue: output(1); break; case k, -2: output(2); break; case 'a'..z, red..green: output(3); break; default: output(4); } }\n"
+	program, errors := Parse(src)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	labels := []string{}
+	for _, c := range program.StatementsBlock.Statements[1].(*Switch).Cases {
+		for _, label := range c.Labels {
+			labels = append(labels, fmt.Sprintf("%s=%d..%d", label.Text, label.Min, label.Max))
+		}
+	}
+	want := "blue=2..2 k=7..7 -2=-2..-2 'a'..z=97..122 red..green=0..1"
+	if got := strings.Join(labels, " "); got != want {
+		t.Errorf("labels = %s, want %s", got, want)
+	}
+	for input, want := range map[string]string{"2": "1\n", "7": "2\n", "98": "3\n", "1": "3\n", "5": "4\n"} {
+		if output, err := crossCheck(src, input, Options{}); err != nil || output != want {
+			t.Errorf("input %s printed %q, %v, want %q", input, output, err, want)
+		}
+	}
+	if _, errors := Parse("a : int;\nfunc f() : int k : const int = 1; { return k; }\n{ switch (a) { case k: output(1); default: output(0); } }\n"); len(errors) != 1 || errors[0].Code != CodeNotEnumValue {
+		t.Errorf("a local constant as a case label: %v", errors)
+	}
+}
+
+//an input over a limit is rejected with the one error that says which, whether the phases
+//are timed or not, and an input within every limit parses
+func TestParseLimits(t *testing.T) {
+	src := "a : int;\n{ input(a); while (a < 10) a = a + 1; output(a); }\n"
+	tests := []struct {
+		limits Limits
+		want   string
+	}{
+		{Limits{MaxSourceSize: 20}, fmt.Sprintf("input too large: %d bytes, the limit is 20", len(src))},
+		{Limits{MaxTokens: 12}, "input too large: more than 12 tokens"},
+		{Limits{MaxNodes: 5}, "input too large: more than 5 syntax nodes"},
+	}
+	for _, test := range tests {
+		for _, stats := range []*Stats{nil, {}} {
+			_, errors := ParseWithOptions(src, Options{Limits: test.limits, Stats: stats})
+			if len(errors) != 1 || errors[0].Code != CodeInputTooLarge || errors[0].Text() != test.want {
+				t.Errorf("%+v, timed %v: errors = %v, want %s", test.limits, stats != nil, errors, test.want)
+			}
+		}
+		if _, err := Compile(src, Options{Limits: test.limits}); err == nil {
+			t.Errorf("%+v: Compile accepted the input", test.limits)
+		}
+	}
+	limits := Limits{MaxSourceSize: len(src), MaxTokens: 100, MaxNodes: 100}
+	if _, errors := ParseWithOptions(src, Options{Limits: limits}); len(errors) > 0 {
+		t.Errorf("within the limits: %v", errors)
+	}
+	if _, errors := ParseWithOptions(src, Options{}); len(errors) > 0 {
+		t.Errorf("without limits: %v", errors)
+	}
+}
+
+//standard CPL rejects every extension by name, and the extended language accepts it
+func TestStandardCPL(t *testing.T) {
+	tests := []struct {
+		statement string
+		feature   string
+	}{
+		{"a += 2;", "a compound assignment"},
+		{"a++;", "the ++ operator"},
+		{"a = b = 1;", "a chained assignment"},
+		{"a = b % 2;", "the % operator"},
+		{"a = 'x';", "a character literal"},
+		{"output(\"hi\");", "a string literal"},
+		{"a = b > 1 ? 1 : 2;", "a conditional expression"},
+		{"a = 1 + static_cast<int>(x);", "a static_cast inside an expression"},
+		{"for (a = 0; a < 2; a = a + 1) output(a);", "a for loop"},
+		{"do a = a + 1; while (a < 3);", "a do-while loop"},
+		{"while (a < 3) { a = a + 1; continue; }", "a continue statement"},
+		{"switch (a) { case 1..2: output(1); default: output(0); }", "a case range"},
+		{"switch (a) { case 1, 2: output(1); default: output(0); }", "a list of case values"},
+		{"switch (a) { case -1: output(1); default: output(0); }", "a signed case label"},
+		{"input(a in 1..9);", "input range validation"},
+		{"a = 1; // note\n", "a // comment"},
+		{"x = 1e3;", "a number with an exponent"},
+		{"x = .5;", "a number without digits before its point"},
+	}
+	for _, test := range tests {
+		src := "a, b : int; x : float;\n{ " + test.statement + " }\n"
+		if _, errors := ParseWithOptions(src, Options{}); len(errors) > 0 {
+			t.Errorf("%s: extended errors = %v", test.statement, errors)
+		}
+		_, errors := ParseWithOptions(src, Options{Std: StdCPL})
+		want := test.feature + " is not part of standard CPL"
+		if len(errors) != 1 || errors[0].Code != CodeExtension || errors[0].Text() != want {
+			t.Errorf("%s: cpl errors = %v, want %s", test.statement, errors, want)
+		}
+	}
+	declarations := []struct {
+		declaration string
+		feature     string
+	}{
+		{"k : const int = 1;", "a constant"},
+		{"d : bool;", "the bool type"},
+		{"v[3] : int;", "an array"},
+		{"c : enum { red };", "an enum"},
+		{"p : struct { u : int; };", "a struct"},
+		{"func f() { output(1); }", "a function"},
+	}
+	for _, test := range declarations {
+		src := "a : int;\n" + test.declaration + "\n{ a = 1; }\n"
+		if strings.HasPrefix(test.declaration, "func") {
+			src = "a : int;\n" + test.declaration + "\n{ f(); }\n"
+		}
+		_, errors := ParseWithOptions(src, Options{Std: StdCPL})
+		want := test.feature + " is not part of standard CPL"
+		if len(errors) == 0 || errors[0].Code != CodeExtension || errors[0].Text() != want {
+			t.Errorf("%s: cpl errors = %v, want %s", test.declaration, errors, want)
+		}
+	}
+	//an if needs its else, and a /* inside a comment does not nest
+	src := "a : int;\n{ /* a /* b */ if (a > 0) output(1); else output(2); }\n"
+	if _, errors := ParseWithOptions(src, Options{Std: StdCPL}); len(errors) > 0 {
+		t.Errorf("standard program: errors = %v", errors)
+	}
+	if _, errors := ParseWithOptions("a : int;\n{ if (a > 0) output(1); }\n", Options{Std: StdCPL}); len(errors) != 1 {
+		t.Errorf("if without else: errors = %v", errors)
+	}
+	for name, want := range map[string]Standard{"cpl": StdCPL, "extended": StdExtended} {
+		if std, err := ParseStandard(name); err != nil || std != want || std.String() != name {
+			t.Errorf("ParseStandard(%s) = %v, %v", name, std, err)
+		}
+	}
+	if _, err := ParseStandard("c99"); err == nil {
+		t.Error("ParseStandard(c99) accepted it")
+	}
+}
+
+//a sign before a number is part of it, + keeps its operand and - subtracts it from 0
+func TestParseUnarySigns(t *testing.T) {
+	program, errors := Parse("a, b, c : int;\n{ a = -5; a = +b; a = b * -c; }\n")
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	values := []NodeExpression{}
+	for _, statement := range program.StatementsBlock.Statements {
+		values = append(values, statement.(*Assignment).Val)
+	}
+	if n, ok := values[0].(*IntNum); !ok || n.Value != -5 {
+		t.Errorf("-5 parsed as %#v", values[0])
+	}
+	if v, ok := values[1].(*Variable); !ok || v.Variable != "b" {
+		t.Errorf("+b parsed as %#v", values[1])
+	}
+	product, ok := values[2].(*Arithmetic)
+	if !ok || product.Operator != Multiply {
+		t.Fatalf("b * -c parsed as %#v", values[2])
+	}
+	if negated, ok := product.RHS.(*Arithmetic); !ok || negated.Operator != Subtract || negated.LHS.(*IntNum).Value != 0 {
+		t.Errorf("-c parsed as %#v", product.RHS)
+	}
+	output, err := crossCheck("a, b : int; x : float;\n{ input(a); input(x); b = -a * 2 - -3; output(b); output(+x / -2); output(- -a); }\n", "4 3.0", Options{})
+	if want := "-5\n-1.5\n4\n"; err != nil || output != want {
+		t.Errorf("the signs printed %q, %v, want %q", output, err, want)
+	}
+}
+
+//! applies to the single condition after it, and binds tighter than && and ||
+func TestParseNot(t *testing.T) {
+	program, errors := Parse("a, b : int; done : bool;\n{ if (!done && !!(a < b) || !a == b) output(1); else output(0); }\n")
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	or, ok := program.StatementsBlock.Statements[0].(*IfStatement).Condition.(*Or)
+	if !ok {
+		t.Fatalf("the condition is not an ||")
+	}
+	and, ok := or.LHS.(*And)
+	if !ok {
+		t.Fatalf("the left of || is not an &&: %#v", or.LHS)
+	}
+	if not, ok := and.LHS.(*Not); !ok {
+		t.Errorf("!done parsed as %#v", and.LHS)
+	} else if _, ok := not.Value.(*BoolTest); !ok {
+		t.Errorf("!done negates %#v", not.Value)
+	}
+	if not, ok := and.RHS.(*Not); !ok {
+		t.Errorf("!!(a < b) parsed as %#v", and.RHS)
+	} else if _, ok := not.Value.(*Not); !ok {
+		t.Errorf("!!(a < b) negates %#v", not.Value)
+	}
+	if not, ok := or.RHS.(*Not); !ok {
+		t.Errorf("!a == b parsed as %#v", or.RHS)
+	} else if compare, ok := not.Value.(*Compare); !ok || compare.Operator != EqualTo {
+		t.Errorf("!a == b negates %#v", not.Value)
+	}
+	output, err := crossCheck("a : int; done : bool;\n{ input(a); done = a > 2; if (!done) output(1); else output(0); while (!a == 0) a = a - 1; output(a); }\n", "5", Options{})
+	if want := "0\n0\n"; err != nil || output != want {
+		t.Errorf("! printed %q, %v, want %q", output, err, want)
+	}
+}
+
+//input takes a variable or an element, and an expression is one error
+func TestParseInputTarget(t *testing.T) {
+	program, errors := Parse("a[3] : int; i : int;\n{ input(i); input(a[i + 1]); }\n")
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	if input := program.StatementsBlock.Statements[1].(*Input); input.Variable != "a" || input.Index == nil {
+		t.Errorf("input(a[i + 1]) parsed as %#v", input)
+	}
+	for _, statement := range []string{"input(i + 1);", "input(a[0] * 2);", "input(3);"} {
+		_, errors := Parse("a[3] : int; i : int;\n{ " + statement + " }\n")
+		if len(errors) != 1 || errors[0].Code != CodeInputExpression || errors[0].Pos.Column != 8 {
+			t.Errorf("%s: errors = %v", statement, errors)
+		}
+	}
+	if _, errors := Parse("i : int;\n{ input(); }\n"); len(errors) != 1 || errors[0].Code == CodeInputExpression {
+		t.Errorf("input(): errors = %v", errors)
+	}
+}
@@ -0,0 +1,163 @@
+package cpq
+
+import (
+	"sort"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+//maps between byte offsets and line/column positions of a source.
+//Lines and columns follow the scanner: zero based, columns counted in runes,
+//and "\r\n" or a lone '\r' end a line.
+type LineIndex struct {
+	src   string
+	lines []int
+}
+
+//returns a new index over the original source
+func NewLineIndex(src string) *LineIndex {
+	lines := []int{0}
+	for i := 0; i < len(src); i++ {
+		switch src[i] {
+		case '\r':
+			if i+1 < len(src) && src[i+1] == '\n' {
+				i++
+			}
+			lines = append(lines, i+1)
+		case '\n':
+			lines = append(lines, i+1)
+		}
+	}
+	return &LineIndex{src: src, lines: lines}
+}
+
+//returns the number of lines in the source
+func (l *LineIndex) LineCount() int {
+	return len(l.lines)
+}
+
+//returns the text of a line without its line terminator
+func (l *LineIndex) Line(line int) string {
+	if line < 0 || line >= len(l.lines) {
+		return ""
+	}
+	return l.src[l.lines[line]:l.lineEnd(line)]
+}
+
+func (l *LineIndex) lineEnd(line int) int {
+	end := len(l.src)
+	if line+1 < len(l.lines) {
+		end = l.lines[line+1]
+	}
+	for end > l.lines[line] && (l.src[end-1] == '\n' || l.src[end-1] == '\r') {
+		end--
+	}
+	return end
+}
+
+// Position converts a byte offset to a Position.
+func (l *LineIndex) Position(offset int) Position {
+	if offset < 0 {
+		offset = 0
+	}
+	if offset > len(l.src) {
+		offset = len(l.src)
+	}
+	line := sort.Search(len(l.lines), func(i int) bool { return l.lines[i] > offset }) - 1
+	start := l.lines[line]
+	if end := l.lineEnd(line); offset > end {
+		offset = end
+	}
+	return Position{
+		Line:   line,
+		Column: utf8.RuneCountInString(l.src[start:offset]),
+		Offset: offset,
+	}
+}
+
+// Offset converts a line/column position to a byte offset, ignoring pos.Offset.
+func (l *LineIndex) Offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(l.lines) {
+		return len(l.src)
+	}
+	offset, end := l.lines[pos.Line], l.lineEnd(pos.Line)
+	for column := 0; column < pos.Column && offset < end; column++ {
+		_, size := utf8.DecodeRuneInString(l.src[offset:])
+		offset += size
+	}
+	return offset
+}
+
+// UTF16Column returns the column of pos counted in UTF-16 code units, as used by LSP.
+func (l *LineIndex) UTF16Column(pos Position) int {
+	if pos.Line < 0 || pos.Line >= len(l.lines) {
+		return 0
+	}
+	units := 0
+	for _, ch := range l.src[l.lines[pos.Line]:l.Offset(pos)] {
+		units += utf16.RuneLen(ch)
+	}
+	return units
+}
+
+// ByteColumn returns the column of pos counted in bytes from the start of its line.
+func (l *LineIndex) ByteColumn(pos Position) int {
+	if pos.Line < 0 || pos.Line >= len(l.lines) {
+		return 0
+	}
+	return l.Offset(pos) - l.lines[pos.Line]
+}
+
+// VisualColumn returns the column of pos on screen, where a tab moves to the next
+// multiple of tabWidth; with a tabWidth of 0 it is the column in runes.
+func (l *LineIndex) VisualColumn(pos Position, tabWidth int) int {
+	if pos.Line < 0 || pos.Line >= len(l.lines) {
+		return 0
+	}
+	return utf8.RuneCountInString(ExpandTabs(l.src[l.lines[pos.Line]:l.Offset(pos)], tabWidth))
+}
+
+// ExpandTabs replaces every tab of a line by the spaces up to the next multiple of
+// tabWidth, so the line looks the same in any terminal; a tabWidth of 0 keeps the tabs.
+func ExpandTabs(line string, tabWidth int) string {
+	if tabWidth <= 0 || !strings.ContainsRune(line, '\t') {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for _, ch := range line {
+		if ch != '\t' {
+			b.WriteRune(ch)
+			column++
+			continue
+		}
+		spaces := tabWidth - column%tabWidth
+		b.WriteString(strings.Repeat(" ", spaces))
+		column += spaces
+	}
+	return b.String()
+}
+
+// FromUTF16 converts an LSP line and UTF-16 character offset to a Position.
+func (l *LineIndex) FromUTF16(line, character int) Position {
+	if line < 0 {
+		return l.Position(0)
+	}
+	if line >= len(l.lines) {
+		return l.Position(len(l.src))
+	}
+	offset := l.lines[line]
+	units := 0
+	for _, ch := range l.Line(line) {
+		if units >= character {
+			break
+		}
+		units += utf16.RuneLen(ch)
+		offset += utf8.RuneLen(ch)
+	}
+	return l.Position(offset)
+}
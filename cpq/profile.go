@@ -0,0 +1,112 @@
+package cpq
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//limits of the QUAD interpreter that will run the generated program.
+//Zero limits and a nil opcode list mean unlimited.
+type Profile struct {
+	Name         string
+	MaxVariables int      // distinct variable and temporary names
+	MaxLines     int      // instructions
+	Opcodes      []string // opcodes the interpreter understands
+	IntBits      int      // width of integer constants
+}
+
+//known interpreter profiles, selected with --profile
+var Profiles = map[string]Profile{
+	"unlimited": {Name: "unlimited"},
+	"course": {
+		Name:    "course",
+		Opcodes: quadOpcodes(),
+		IntBits: 32,
+	},
+	"small": {
+		Name:         "small",
+		MaxVariables: 128,
+		MaxLines:     1000,
+		Opcodes:      quadOpcodes(),
+		IntBits:      16,
+	},
+}
+
+//returns the opcodes of the QUAD language
+func quadOpcodes() []string {
+	opcodes := make([]string, 0, len(quadOperands))
+	for op := range quadOperands {
+		opcodes = append(opcodes, op)
+	}
+	sort.Strings(opcodes)
+	return opcodes
+}
+
+//returns the profile with the given name
+func LookupProfile(name string) (Profile, error) {
+	if profile, ok := Profiles[name]; ok {
+		return profile, nil
+	}
+	names := make([]string, 0, len(Profiles))
+	for known := range Profiles {
+		names = append(names, known)
+	}
+	sort.Strings(names)
+	return Profile{}, fmt.Errorf("unknown profile %q, expected one of %s", name, strings.Join(names, ", "))
+}
+
+// CheckProfile validates a resolved QUAD program against the limits of a profile.
+func CheckProfile(quad string, profile Profile) []ErrorType {
+	errors := []ErrorType{}
+	lines := strings.Split(strings.TrimSuffix(quad, "\n"), "\n")
+	instructions := 0
+	for _, line := range lines {
+		if !isLabelLine(line) {
+			instructions++
+		}
+	}
+	if profile.MaxLines > 0 && instructions > profile.MaxLines {
+		errors = append(errors, ErrorType{Code: CodeProfileInstructions, Message: fmt.Sprintf(
+			"program has %d instructions, the %s profile allows %d; simplify the program or choose another profile",
+			instructions, profile.Name, profile.MaxLines)})
+	}
+	allowed := map[string]bool{}
+	for _, op := range profile.Opcodes {
+		allowed[op] = true
+	}
+	variables := map[string]bool{}
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 || isLabelLine(line) {
+			continue
+		}
+		if len(allowed) > 0 && !allowed[fields[0]] {
+			errors = append(errors, ErrorType{Code: CodeProfileOpcode, Message: fmt.Sprintf(
+				"line %d: the %s profile does not support %s", i+1, profile.Name, fields[0])})
+		}
+		for j, operand := range fields[1:] {
+			if (fields[0] == "JUMP" || fields[0] == "JMPZ") && j == 0 {
+				continue
+			}
+			if letter(rune(operand[0])) || operand[0] == '_' {
+				variables[operand] = true
+				continue
+			}
+			if profile.IntBits > 0 && !strings.ContainsAny(operand, ".eE") {
+				if _, err := strconv.ParseInt(operand, 10, profile.IntBits); err != nil {
+					errors = append(errors, ErrorType{Code: CodeProfileInteger, Message: fmt.Sprintf(
+						"line %d: integer constant %s does not fit in the %d bits of the %s profile",
+						i+1, operand, profile.IntBits, profile.Name)})
+				}
+			}
+		}
+	}
+	if profile.MaxVariables > 0 && len(variables) > profile.MaxVariables {
+		errors = append(errors, ErrorType{Code: CodeProfileVariables, Message: fmt.Sprintf(
+			"program uses %d variables and temporaries, the %s profile allows %d; reuse variables or split expressions",
+			len(variables), profile.Name, profile.MaxVariables)})
+	}
+	return errors
+}
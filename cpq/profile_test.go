@@ -0,0 +1,66 @@
+package cpq
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestCheckProfile(t *testing.T) {
+	quad := "IASN a 40000\nL1:\nIPRT a\nJUMP 1\nHALT\n"
+	tests := []struct {
+		profile string
+		quad    string
+		want    []string
+	}{
+		{"unlimited", quad + "XYZ a\n", nil},
+		{"course", quad, nil},
+		{"course", "IASN a 5000000000\nJUMP 3\nHALT\n", []string{"line 1: integer constant 5000000000 does not fit in the 32 bits of the course profile"}},
+		{"course", "PRINT a\nHALT\n", []string{"line 1: the course profile does not support PRINT"}},
+		{"small", quad, []string{"line 1: integer constant 40000 does not fit in the 16 bits of the small profile"}},
+		{"small", "RASN x 40000.5\nHALT\n", nil},
+		{"small", strings.Repeat("IPRT a\n", 1000) + "HALT\n",
+			[]string{"program has 1001 instructions, the small profile allows 1000; simplify the program or choose another profile"}},
+	}
+	for _, test := range tests {
+		profile, err := LookupProfile(test.profile)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := []string{}
+		for _, e := range CheckProfile(test.quad, profile) {
+			got = append(got, e.Text())
+		}
+		if strings.Join(got, "\n") != strings.Join(test.want, "\n") {
+			t.Errorf("%s profile of %.30q: errors = %q, want %q", test.profile, test.quad, got, test.want)
+		}
+	}
+}
+
+//the variables and temporaries are counted once each, the jump targets not at all
+func TestCheckProfileVariables(t *testing.T) {
+	var quad strings.Builder
+	for n := 0; n < 129; n++ {
+		fmt.Fprintf(&quad, "IASN v%d %d\n", n, n)
+	}
+	quad.WriteString("IADD v0 v0 v1\nJMPZ 1 v0\nHALT\n")
+	errors := CheckProfile(quad.String(), Profiles["small"])
+	want := "program uses 129 variables and temporaries, the small profile allows 128; reuse variables or split expressions"
+	if len(errors) != 1 || errors[0].Code != CodeProfileVariables || errors[0].Text() != want {
+		t.Errorf("errors = %v", errors)
+	}
+}
+
+//a compiled program fits the course profile, and an unknown profile names the known ones
+func TestLookupProfile(t *testing.T) {
+	result, err := Compile("a : int; x : float;\n{ input(a); x = a / 2.0; while (a < 10) a = a + 1; output(x); }\n", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errors := CheckProfile(result.Quad, Profiles["course"]); len(errors) > 0 {
+		t.Errorf("course profile errors: %v", errors)
+	}
+	if _, err := LookupProfile("tiny"); err == nil || err.Error() != `unknown profile "tiny", expected one of course, small, unlimited` {
+		t.Errorf("LookupProfile(tiny) error = %v", err)
+	}
+}
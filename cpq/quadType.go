@@ -7,8 +7,21 @@ const (
 	Unknown DataType = iota
 	Float   DataType = 1
 	Integer DataType = 2
+	Bool    DataType = 3 // stored as an int, 0 or 1
 )
 
+func (t DataType) String() string {
+	switch t {
+	case Float:
+		return "float"
+	case Integer:
+		return "int"
+	case Bool:
+		return "bool"
+	}
+	return "unknown"
+}
+
 //operator in CPL.
 type Operator int
 
@@ -18,6 +31,7 @@ const (
 	Subtract                             // -
 	Multiply                             // *
 	Divide                               // /
+	Modulo                               // %
 	EqualTo                              // ==
 	NotEqualTo                           // !=
 	GreaterThan                          // >
@@ -43,14 +57,70 @@ type NodeBoolean interface {
 // a CPL program.
 type Program struct {
 	Declarations    []Declaration
+	Functions       []*Function
 	StatementsBlock *Block
 	Pos             Position
 }
 
+//a function, or a procedure when it has no return type
+type Function struct {
+	Name         string
+	Params       []Parameter
+	ReturnType   DataType // Unknown for a procedure
+	Declarations []Declaration
+	Body         *Block
+	Pos          Position
+}
+
+//returns the number of elements of the i-th name, 0 for a scalar
+func (d *Declaration) Size(i int) int64 {
+	if i < len(d.Sizes) {
+		return d.Sizes[i]
+	}
+	return 0
+}
+
+type Parameter struct {
+	Name string
+	Type DataType
+	Pos  Position
+}
+
 type Declaration struct {
-	Names []string
-	Type  DataType
-	Pos   Position
+	Names  []string
+	Sizes  []int64 // elements of each name, 0 for a scalar
+	Type   DataType
+	Const  bool
+	Value  NodeExpression // value of the constants
+	Enum   *Enum          // enum of the variables, or of the constants that are its values
+	Struct *Struct        // struct whose fields the variables are
+	Pos    Position
+}
+
+//a struct type. ParseDeclarations replaces its declaration by a declaration of every
+//field of every variable, named NAME_field; p.x is the variable p_x.
+type Struct struct {
+	Names  []string
+	Sizes  []int64 // an array of structs is an array of every field
+	Fields []Declaration
+}
+
+func (s *Struct) hasField(name string) bool {
+	for _, field := range s.Fields {
+		for _, fieldName := range field.Names {
+			if fieldName == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+//an enum type, named after the first variable declared with it; its values are
+//int constants 0, 1, 2...
+type Enum struct {
+	Name   string
+	Values []string
 }
 
 type Statement interface {
@@ -58,20 +128,38 @@ type Statement interface {
 	statement()
 }
 
+//an assignment statement, or the value of another assignment in a = b = 1. The compound
+//assignment a[i] += 2 is a[i] = a[i] + 2 where both elements have the same Index node,
+//which is computed once.
 type Assignment struct {
 	Variable string
-	Val      Expression
-	CastType DataType
+	Index    NodeExpression // element of an array, nil for a scalar
+	Val      NodeExpression
+	Type     DataType // type of Val found by Analyze, Unknown before it or on an error
 	Pos      Position
 }
 
+//returns the element of a compound assignment to an element, a[i] in a[i] += 2, which
+//has the Index of the assignment, or nil for other assignments
+func (a *Assignment) compoundElement() *Element {
+	if compound, ok := a.Val.(*Arithmetic); ok && a.Index != nil {
+		if element, ok := compound.LHS.(*Element); ok && element.Index == a.Index {
+			return element
+		}
+	}
+	return nil
+}
+
 type Input struct {
 	Variable string
+	Index    NodeExpression // element of an array, nil for a scalar
+	Min      NodeExpression // bounds of input(x in Min..Max), nil without a range
+	Max      NodeExpression
 	Pos      Position
 }
 
 type Output struct {
-	Value    Expression
+	Value    NodeExpression
 	Position Position
 }
 
@@ -88,26 +176,72 @@ type WhileStatement struct {
 	Position  Position
 }
 
+//do Body while (Condition);
+type DoWhileStatement struct {
+	Body      Statement
+	Condition Boolean
+	Position  Position
+}
+
+//for (Init; Condition; Step) Body, where Init and Step may be nil
+type ForStatement struct {
+	Init      Statement
+	Condition Boolean
+	Step      Statement
+	Body      Statement
+	Position  Position
+}
+
 type Switch struct {
-	Expression  Expression
+	Expression  NodeExpression
 	Cases       []SwitchCase
 	DefaultCase []Statement
 	Position    Position
 }
 
 type SwitchCase struct {
-	Value      int64
+	Labels     []CaseLabel
 	Statements []Statement
 	Position   Position
 }
 
+//a value of a case, or a range of values case Min..Max; a single value has Min == Max
+type CaseLabel struct {
+	Min  int64
+	Max  int64
+	Text string // the label as written, RED, 'a' or 1..9, for printing the source back
+}
+
 type Break struct {
 	Position Position
 }
 
+type Continue struct {
+	Position Position
+}
+
+//ends a switch case that continues into the next one, when cases break by themselves
+type Fallthrough struct {
+	Position Position
+}
+
+//a call of a function or procedure, as a statement or inside an expression
+type Call struct {
+	Function string
+	Args     []NodeExpression
+	Type     DataType // type of the returned value found by Analyze, Unknown for a procedure
+	Position Position
+}
+
+type Return struct {
+	Value    NodeExpression // nil in a procedure
+	Position Position
+}
+
 type Block struct {
 	Statements []Statement
 	Position   Position
+	End        Position // the closing }
 }
 
 type Boolean interface {
@@ -117,6 +251,60 @@ type Boolean interface {
 
 type Variable struct {
 	Variable string
+	Type     DataType // found by Analyze
+	Position Position
+}
+
+//an element of an array
+type Element struct {
+	Array    string
+	Index    NodeExpression
+	Type     DataType // found by Analyze
+	Position Position
+}
+
+type BoolLiteral struct {
+	Value    bool
+	Position Position
+}
+
+//a condition used as a bool value, b = x < y
+type Condition struct {
+	Value    Boolean
+	Position Position
+}
+
+//cond ? Then : Else
+type Conditional struct {
+	Condition Boolean
+	Then      NodeExpression
+	Else      NodeExpression
+	Type      DataType // found by Analyze
+	Position  Position
+}
+
+//a bool value used as a condition, if (b)
+type BoolTest struct {
+	Value    NodeExpression
+	Position Position
+}
+
+//static_cast(Type)(Value)
+type Cast struct {
+	Type     DataType
+	Value    NodeExpression
+	Position Position
+}
+
+//a string, which only output can use
+type StringLiteral struct {
+	Value    string
+	Position Position
+}
+
+//a character, the int value of its code
+type CharLiteral struct {
+	Value    rune
 	Position Position
 }
 
@@ -131,9 +319,10 @@ type FloatNum struct {
 }
 
 type Arithmetic struct {
-	LHS      Expression
+	LHS      NodeExpression
 	Operator Operator
-	RHS      Expression
+	RHS      NodeExpression
+	Type     DataType // found by Analyze
 	Position Position
 }
 
@@ -155,44 +344,75 @@ type Not struct {
 }
 
 type Compare struct {
-	LHS      Expression
+	LHS      NodeExpression
 	Operator Operator
-	RHS      Expression
-	Position Position
-}
-
-func (*Program) node()             {}
-func (*Declaration) node()         {}
-func (*Assignment) node()          {}
-func (*Input) node()               {}
-func (*Output) node()              {}
-func (*IfStatement) node()         {}
-func (*WhileStatement) node()      {}
-func (*Switch) node()              {}
-func (*SwitchCase) node()          {}
-func (*Break) node()               {}
-func (*Block) node()               {}
-func (*Variable) node()            {}
-func (*IntNum) node()              {}
-func (*FloatNum) node()            {}
-func (*Arithmetic) node()          {}
-func (*Or) node()                  {}
-func (*And) node()                 {}
-func (*Not) node()                 {}
-func (*Compare) node()             {}
-func (*Assignment) statement()     {}
-func (*Input) statement()          {}
-func (*Output) statement()         {}
-func (*IfStatement) statement()    {}
-func (*WhileStatement) statement() {}
-func (*Switch) statement()         {}
-func (*Break) statement()          {}
-func (*Block) statement()          {}
-func (*Variable) expression()      {}
-func (*IntNum) expression()        {}
-func (*FloatNum) expression()      {}
-func (*Arithmetic) expression()    {}
-func (*Or) boolexpr()              {}
-func (*And) boolexpr()             {}
-func (*Not) boolexpr()             {}
-func (*Compare) boolexpr()         {}
+	RHS      NodeExpression
+	Position Position
+}
+
+func (*Program) node()               {}
+func (*Declaration) node()           {}
+func (*Assignment) node()            {}
+func (*Input) node()                 {}
+func (*Output) node()                {}
+func (*IfStatement) node()           {}
+func (*WhileStatement) node()        {}
+func (*ForStatement) node()          {}
+func (*DoWhileStatement) node()      {}
+func (*Switch) node()                {}
+func (*SwitchCase) node()            {}
+func (*Break) node()                 {}
+func (*Continue) node()              {}
+func (*Fallthrough) node()           {}
+func (*Function) node()              {}
+func (*Call) node()                  {}
+func (*Return) node()                {}
+func (*Block) node()                 {}
+func (*Variable) node()              {}
+func (*Element) node()               {}
+func (*IntNum) node()                {}
+func (*BoolLiteral) node()           {}
+func (*StringLiteral) node()         {}
+func (*CharLiteral) node()           {}
+func (*Cast) node()                  {}
+func (*Conditional) node()           {}
+func (*Condition) node()             {}
+func (*BoolTest) node()              {}
+func (*FloatNum) node()              {}
+func (*Arithmetic) node()            {}
+func (*Or) node()                    {}
+func (*And) node()                   {}
+func (*Not) node()                   {}
+func (*Compare) node()               {}
+func (*Assignment) statement()       {}
+func (*Input) statement()            {}
+func (*Output) statement()           {}
+func (*IfStatement) statement()      {}
+func (*WhileStatement) statement()   {}
+func (*ForStatement) statement()     {}
+func (*DoWhileStatement) statement() {}
+func (*Switch) statement()           {}
+func (*Break) statement()            {}
+func (*Continue) statement()         {}
+func (*Fallthrough) statement()      {}
+func (*Call) statement()             {}
+func (*Return) statement()           {}
+func (*Block) statement()            {}
+func (*Variable) expression()        {}
+func (*Element) expression()         {}
+func (*IntNum) expression()          {}
+func (*BoolLiteral) expression()     {}
+func (*StringLiteral) expression()   {}
+func (*CharLiteral) expression()     {}
+func (*Assignment) expression()      {}
+func (*Cast) expression()            {}
+func (*Conditional) expression()     {}
+func (*Condition) expression()       {}
+func (*FloatNum) expression()        {}
+func (*Arithmetic) expression()      {}
+func (*Call) expression()            {}
+func (*Or) boolexpr()                {}
+func (*And) boolexpr()               {}
+func (*Not) boolexpr()               {}
+func (*BoolTest) boolexpr()          {}
+func (*Compare) boolexpr()           {}
@@ -0,0 +1,160 @@
+package cpq
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//executes resolved QUAD output like the course interpreter does. Input and output follow
+//interpret, so that the output of a program and of its compiled code can be compared.
+//Variables that were never assigned read as zero.
+func runQuad(quad string, in io.Reader, out io.Writer, maxSteps int) error {
+	if err := verifyQuad(quad); err != nil {
+		return err
+	}
+	input := bufio.NewScanner(in)
+	input.Split(bufio.ScanWords)
+	output := bufio.NewWriter(out)
+	err := execute(strings.Split(strings.TrimSuffix(quad, "\n"), "\n"), input, output, maxSteps)
+	if flushErr := output.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
+
+func execute(lines []string, input *bufio.Scanner, output *bufio.Writer, maxSteps int) error {
+	variables := map[string]value{}
+	//returns an operand: a variable or a literal of the instruction's type
+	operand := func(text string, t DataType) (value, error) {
+		if v, ok := variables[text]; ok {
+			return v.cast(t), nil
+		}
+		if letter(rune(text[0])) || text[0] == '_' {
+			return value{Type: t}, nil
+		}
+		return parseValue(text, t)
+	}
+	for pc, steps := 0, 0; pc < len(lines); steps++ {
+		if maxSteps > 0 && steps > maxSteps {
+			return fmt.Errorf("program executed more than %d instructions", maxSteps)
+		}
+		fields := strings.Fields(lines[pc])
+		op, args := fields[0], fields[1:]
+		pc++
+		t, sourceType := Integer, Integer
+		if op[0] == 'R' {
+			t, sourceType = Float, Float
+		}
+		switch op {
+		case "ITOR":
+			t = Float
+		case "RTOI":
+			t = Integer
+		}
+		//operands read by the instruction, after the variable it writes
+		var sources []value
+		switch op {
+		case "IPRT", "RPRT":
+			sources = make([]value, 1)
+		case "IASN", "RASN", "ITOR", "RTOI", "JMPZ":
+			sources = make([]value, 1)
+			args = args[1:]
+		case "HALT", "JUMP", "IINP", "RINP":
+		default:
+			sources = make([]value, 2)
+			args = args[1:]
+		}
+		for n := range sources {
+			v, err := operand(args[n], sourceType)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", pc, err)
+			}
+			sources[n] = v
+		}
+		switch op {
+		case "HALT":
+			return nil
+		case "JUMP":
+			pc, _ = strconv.Atoi(args[0])
+			pc--
+		case "JMPZ":
+			if sources[0].Int == 0 {
+				pc, _ = strconv.Atoi(fields[1])
+				pc--
+			}
+		case "IINP", "RINP":
+			if !input.Scan() {
+				return fmt.Errorf("line %d: no more input", pc)
+			}
+			v, err := parseValue(input.Text(), t)
+			if err != nil {
+				return fmt.Errorf("line %d: %s", pc, err)
+			}
+			variables[args[0]] = v
+		case "IPRT", "RPRT":
+			output.WriteString(formatValue(sources[0]))
+			output.WriteByte('\n')
+		case "IASN", "RASN", "ITOR", "RTOI":
+			variables[fields[1]] = sources[0].cast(t)
+		default:
+			result, err := quadOperation(op[1:], sources[0], sources[1])
+			if err != nil {
+				return fmt.Errorf("line %d: %s", pc, err)
+			}
+			variables[fields[1]] = result
+		}
+	}
+	return fmt.Errorf("program ended without HALT")
+}
+
+//applies the operation of a three-operand instruction without its I or R prefix
+func quadOperation(op string, a, b value) (value, error) {
+	var operator Operator
+	switch op {
+	case "ADD":
+		return arithmetic(Add, a, b)
+	case "SUB":
+		return arithmetic(Subtract, a, b)
+	case "MLT":
+		return arithmetic(Multiply, a, b)
+	case "DIV":
+		return arithmetic(Divide, a, b)
+	case "EQL":
+		operator = EqualTo
+	case "NQL":
+		operator = NotEqualTo
+	case "LSS":
+		operator = LessThan
+	default:
+		operator = GreaterThan
+	}
+	if compare(operator, a, b, 0) {
+		return value{Type: Integer, Int: 1}, nil
+	}
+	return value{Type: Integer}, nil
+}
+
+//compiles src, runs the program with interpret and its QUAD with runQuad on the same
+//input, and reports any difference in their output. A difference is a bug in the code
+//generator (or in one of the interpreters). Returns the output of the program.
+func crossCheck(src, input string, opts Options) (string, error) {
+	opts.Opcodes = nil
+	result, err := Compile(src, opts)
+	if err != nil {
+		return "", err
+	}
+	var expected, actual bytes.Buffer
+	interpretErr := interpret(result.Program, strings.NewReader(input), &expected, opts)
+	quadErr := runQuad(result.Quad, strings.NewReader(input), &actual, defaultMaxSteps)
+	if (interpretErr == nil) != (quadErr == nil) {
+		return "", fmt.Errorf("interpreter error %v, QUAD error %v", interpretErr, quadErr)
+	}
+	if expected.String() != actual.String() {
+		return "", fmt.Errorf("interpreter output %q, QUAD output %q", expected.String(), actual.String())
+	}
+	return expected.String(), interpretErr
+}
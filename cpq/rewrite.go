@@ -0,0 +1,258 @@
+package cpq
+
+import "math"
+
+// Rewrite calls rewrite on every node of the tree of node, the children of a node before
+// the node, and puts the node rewrite returns in the place of the node, which returns
+// itself to keep it. The tree is changed in place and its new root returned. A node must
+// be replaced by one that fits its place: a statement by a statement, an expression by
+// an expression and a condition by a condition. The passes below, like LowerComparison,
+// are rewrite functions:
+//
+//	program = cpq.Rewrite(program, cpq.FoldConstants).(*cpq.Program)
+func Rewrite(node Node, rewrite func(Node) Node) Node {
+	switch n := node.(type) {
+	case *Program:
+		rewriteDeclarations(n.Declarations, rewrite)
+		for i, function := range n.Functions {
+			n.Functions[i] = Rewrite(function, rewrite).(*Function)
+		}
+		n.StatementsBlock = rewriteBlock(n.StatementsBlock, rewrite)
+	case *Function:
+		rewriteDeclarations(n.Declarations, rewrite)
+		n.Body = rewriteBlock(n.Body, rewrite)
+	case *Declaration:
+		n.Value = rewriteExpression(n.Value, rewrite)
+	case *Assignment:
+		n.Index = rewriteExpression(n.Index, rewrite)
+		n.Val = rewriteExpression(n.Val, rewrite)
+	case *Input:
+		n.Index = rewriteExpression(n.Index, rewrite)
+		n.Min = rewriteExpression(n.Min, rewrite)
+		n.Max = rewriteExpression(n.Max, rewrite)
+	case *Output:
+		n.Value = rewriteExpression(n.Value, rewrite)
+	case *IfStatement:
+		n.Condition = rewriteBoolean(n.Condition, rewrite)
+		n.IfBranch = rewriteStatement(n.IfBranch, rewrite)
+		n.ElseBranch = rewriteStatement(n.ElseBranch, rewrite)
+	case *WhileStatement:
+		n.Condition = rewriteBoolean(n.Condition, rewrite)
+		n.Body = rewriteStatement(n.Body, rewrite)
+	case *DoWhileStatement:
+		n.Body = rewriteStatement(n.Body, rewrite)
+		n.Condition = rewriteBoolean(n.Condition, rewrite)
+	case *ForStatement:
+		n.Init = rewriteStatement(n.Init, rewrite)
+		n.Condition = rewriteBoolean(n.Condition, rewrite)
+		n.Step = rewriteStatement(n.Step, rewrite)
+		n.Body = rewriteStatement(n.Body, rewrite)
+	case *Switch:
+		n.Expression = rewriteExpression(n.Expression, rewrite)
+		for i := range n.Cases {
+			rewriteStatements(n.Cases[i].Statements, rewrite)
+		}
+		rewriteStatements(n.DefaultCase, rewrite)
+	case *Call:
+		for i, arg := range n.Args {
+			n.Args[i] = rewriteExpression(arg, rewrite)
+		}
+	case *Return:
+		n.Value = rewriteExpression(n.Value, rewrite)
+	case *Block:
+		rewriteStatements(n.Statements, rewrite)
+	case *Element:
+		n.Index = rewriteExpression(n.Index, rewrite)
+	case *Condition:
+		n.Value = rewriteBoolean(n.Value, rewrite)
+	case *Conditional:
+		n.Condition = rewriteBoolean(n.Condition, rewrite)
+		n.Then = rewriteExpression(n.Then, rewrite)
+		n.Else = rewriteExpression(n.Else, rewrite)
+	case *BoolTest:
+		n.Value = rewriteExpression(n.Value, rewrite)
+	case *Cast:
+		n.Value = rewriteExpression(n.Value, rewrite)
+	case *Arithmetic:
+		n.LHS = rewriteExpression(n.LHS, rewrite)
+		n.RHS = rewriteExpression(n.RHS, rewrite)
+	case *Or:
+		n.LHS = rewriteBoolean(n.LHS, rewrite)
+		n.RHS = rewriteBoolean(n.RHS, rewrite)
+	case *And:
+		n.LHS = rewriteBoolean(n.LHS, rewrite)
+		n.RHS = rewriteBoolean(n.RHS, rewrite)
+	case *Not:
+		n.Value = rewriteBoolean(n.Value, rewrite)
+	case *Compare:
+		n.LHS = rewriteExpression(n.LHS, rewrite)
+		n.RHS = rewriteExpression(n.RHS, rewrite)
+	}
+	return rewrite(node)
+}
+
+func rewriteDeclarations(declarations []Declaration, rewrite func(Node) Node) {
+	for i := range declarations {
+		declarations[i].Value = rewriteExpression(declarations[i].Value, rewrite)
+	}
+}
+
+func rewriteStatements(statements []Statement, rewrite func(Node) Node) {
+	for i, statement := range statements {
+		statements[i] = rewriteStatement(statement, rewrite)
+	}
+}
+
+func rewriteBlock(block *Block, rewrite func(Node) Node) *Block {
+	if block == nil {
+		return nil
+	}
+	return Rewrite(block, rewrite).(*Block)
+}
+
+func rewriteStatement(statement Statement, rewrite func(Node) Node) Statement {
+	if statement == nil {
+		return nil
+	}
+	return Rewrite(statement, rewrite).(Statement)
+}
+
+func rewriteExpression(exp NodeExpression, rewrite func(Node) Node) NodeExpression {
+	if exp == nil {
+		return nil
+	}
+	return Rewrite(exp, rewrite).(NodeExpression)
+}
+
+func rewriteBoolean(b Boolean, rewrite func(Node) Node) Boolean {
+	if b == nil {
+		return nil
+	}
+	return Rewrite(b, rewrite).(Boolean)
+}
+
+// LowerComparison replaces a >= b by a == b || a > b and a <= b by a == b || a < b, the
+// comparisons QUAD has. Other nodes are kept.
+func LowerComparison(node Node) Node {
+	compare, ok := node.(*Compare)
+	if !ok {
+		return node
+	}
+	operator := GreaterThan
+	switch compare.Operator {
+	case GreaterThanOrEqualTo:
+	case LessThenOrEqualTo:
+		operator = LessThan
+	default:
+		return node
+	}
+	return &Or{
+		LHS: &Compare{
+			LHS:      compare.LHS,
+			Operator: EqualTo,
+			RHS:      compare.RHS,
+			Position: compare.Position,
+		},
+		RHS: &Compare{
+			LHS:      compare.LHS,
+			Operator: operator,
+			RHS:      compare.RHS,
+			Position: compare.Position,
+		},
+		Position: compare.Position,
+	}
+}
+
+// FoldConstants replaces an arithmetic operation on two int or float literals by its
+// result, computed as the QUAD program would. An operation that fails when it runs, like
+// a division by zero, is kept so that it is reported.
+func FoldConstants(node Node) Node {
+	arithmeticNode, ok := node.(*Arithmetic)
+	if !ok {
+		return node
+	}
+	lhs, ok := literalValue(arithmeticNode.LHS)
+	if !ok {
+		return node
+	}
+	rhs, ok := literalValue(arithmeticNode.RHS)
+	if !ok {
+		return node
+	}
+	result, err := arithmetic(arithmeticNode.Operator, lhs, rhs)
+	if err != nil {
+		return node
+	}
+	if result.Type == Float {
+		if math.IsInf(result.Float, 0) || math.IsNaN(result.Float) {
+			return node
+		}
+		return &FloatNum{Value: result.Float, Position: arithmeticNode.Position}
+	}
+	return &IntNum{Value: result.Int, Position: arithmeticNode.Position}
+}
+
+//returns the value of an int or float literal
+func literalValue(exp NodeExpression) (value, bool) {
+	switch n := exp.(type) {
+	case *IntNum:
+		return value{Type: Integer, Int: n.Value}, true
+	case *FloatNum:
+		return value{Type: Float, Float: n.Value}, true
+	}
+	return value{}, false
+}
+
+// LowerFor replaces for (init; condition; step) body by the block
+// { init; while (condition) { body step } }. A loop whose body has a continue of its
+// own is kept, as the continue would skip the step.
+func LowerFor(node Node) Node {
+	loop, ok := node.(*ForStatement)
+	if !ok || continues(loop.Body) {
+		return node
+	}
+	body := &Block{Statements: []Statement{loop.Body}, Position: loop.Position}
+	if loop.Step != nil {
+		body.Statements = append(body.Statements, loop.Step)
+	}
+	block := &Block{Position: loop.Position}
+	if loop.Init != nil {
+		block.Statements = append(block.Statements, loop.Init)
+	}
+	block.Statements = append(block.Statements, &WhileStatement{
+		Condition: loop.Condition,
+		Body:      body,
+		Position:  loop.Position,
+	})
+	return block
+}
+
+//reports whether a statement has a continue of the loop it is in, leaving out the
+//continues of the loops inside it
+func continues(statement Statement) bool {
+	switch s := statement.(type) {
+	case *Continue:
+		return true
+	case *Block:
+		return anyContinues(s.Statements)
+	case *IfStatement:
+		return continues(s.IfBranch) || continues(s.ElseBranch)
+	case *Switch:
+		for _, c := range s.Cases {
+			if anyContinues(c.Statements) {
+				return true
+			}
+		}
+		return anyContinues(s.DefaultCase)
+	}
+	return false
+}
+
+func anyContinues(statements []Statement) bool {
+	for _, statement := range statements {
+		if continues(statement) {
+			return true
+		}
+	}
+	return false
+}
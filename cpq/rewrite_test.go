@@ -0,0 +1,114 @@
+package cpq
+
+import (
+	"strings"
+	"testing"
+)
+
+//parses src and returns its program after the rewrite
+func rewriteSource(t *testing.T, src string, rewrite func(Node) Node) *Program {
+	t.Helper()
+	program, errors := Parse(src)
+	if len(errors) > 0 {
+		t.Fatal(errors)
+	}
+	return Rewrite(program, rewrite).(*Program)
+}
+
+//runs the QUAD of a syntax tree and returns what it printed
+func runProgram(t *testing.T, program *Program, input string) string {
+	t.Helper()
+	code, errors, _ := CodegenInstructions(program, Options{})
+	if len(errors) > 0 {
+		t.Fatalf("errors: %v", errors)
+	}
+	resolved, err := ResolveLabels(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out strings.Builder
+	if err := runQuad(FormatInstructions(resolved, nil), strings.NewReader(input), &out, defaultMaxSteps); err != nil {
+		t.Fatal(err)
+	}
+	return out.String()
+}
+
+//a rewritten program prints what the program prints
+func checkRewrite(t *testing.T, src, input string, rewrite func(Node) Node) *Program {
+	t.Helper()
+	want, err := crossCheck(src, input, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := rewriteSource(t, src, rewrite)
+	if got := runProgram(t, program, input); got != want {
+		t.Errorf("the rewritten program printed %q, want %q", got, want)
+	}
+	return program
+}
+
+//the children of a node are rewritten before it, and the node returned takes its place
+func TestRewriteOrder(t *testing.T) {
+	var visited []string
+	program := rewriteSource(t, "x : int;\n{ x = 1 + 2 * 3; }\n", func(node Node) Node {
+		switch n := node.(type) {
+		case *IntNum:
+			visited = append(visited, "num")
+		case *Arithmetic:
+			visited = append(visited, "arithmetic")
+		case *Assignment:
+			visited = append(visited, "assignment")
+			return &Output{Value: n.Val}
+		}
+		return node
+	})
+	if want := "num num num arithmetic arithmetic assignment"; strings.Join(visited, " ") != want {
+		t.Errorf("visited %v, want %s", visited, want)
+	}
+	if _, ok := program.StatementsBlock.Statements[0].(*Output); !ok {
+		t.Errorf("the assignment was not replaced: %T", program.StatementsBlock.Statements[0])
+	}
+}
+
+func TestLowerComparison(t *testing.T) {
+	src := "a, b : int;\n{ input(a); input(b); if (a >= b) output(1); else output(0); while (a <= b) a = a + 1; output(a); }\n"
+	for _, input := range []string{"3 3", "4 3", "1 3"} {
+		program := checkRewrite(t, src, input, LowerComparison)
+		condition := program.StatementsBlock.Statements[2].(*IfStatement).Condition
+		if or, ok := condition.(*Or); !ok || or.LHS.(*Compare).Operator != EqualTo || or.RHS.(*Compare).Operator != GreaterThan {
+			t.Errorf("a >= b was lowered to %#v", condition)
+		}
+	}
+}
+
+func TestFoldConstants(t *testing.T) {
+	program := checkRewrite(t, "x : int; y : float;\n{ x = 1 + 2 * 3 - 7 / 2; y = 7.0 / 2 + x; output(x); output(y); }\n", "", FoldConstants)
+	statements := program.StatementsBlock.Statements
+	if n, ok := statements[0].(*Assignment).Val.(*IntNum); !ok || n.Value != 4 {
+		t.Errorf("1 + 2 * 3 - 7 / 2 was folded to %#v", statements[0].(*Assignment).Val)
+	}
+	if a, ok := statements[1].(*Assignment).Val.(*Arithmetic); !ok || a.LHS.(*FloatNum).Value != 3.5 {
+		t.Errorf("7.0 / 2 + x was folded to %#v", statements[1].(*Assignment).Val)
+	}
+	program = rewriteSource(t, "x : int;\n{ x = 1 / 0; }\n", FoldConstants)
+	if _, ok := program.StatementsBlock.Statements[0].(*Assignment).Val.(*Arithmetic); !ok {
+		t.Errorf("the division by zero was folded")
+	}
+}
+
+func TestLowerFor(t *testing.T) {
+	src := "i, j : int;\n{ for (i = 0; i < 3; i = i + 1) { for (j = 0; j < 3; j = j + 1) { if (j == i) continue; else output(j); } } }\n"
+	program := checkRewrite(t, src, "", LowerFor)
+	outer, ok := program.StatementsBlock.Statements[0].(*Block)
+	if !ok || len(outer.Statements) != 2 {
+		t.Fatalf("the for loop was lowered to %#v", program.StatementsBlock.Statements[0])
+	}
+	loop, ok := outer.Statements[1].(*WhileStatement)
+	if !ok {
+		t.Fatalf("the for loop has no while: %#v", outer.Statements[1])
+	}
+	inner := loop.Body.(*Block).Statements[0].(*Block).Statements[0]
+	if _, ok := inner.(*ForStatement); !ok {
+		t.Errorf("the loop with a continue was lowered to %#v", inner)
+	}
+}
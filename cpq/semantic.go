@@ -0,0 +1,138 @@
+package cpq
+
+import (
+	"sort"
+	"strings"
+)
+
+//classification of a semantic token.
+type SemanticKind int
+
+const (
+	SemanticVariable SemanticKind = iota
+	SemanticConstant              // a number, a constant or a value of an enum
+	SemanticField                 // p.x, classified by the name of the struct variable
+	SemanticParameter
+	SemanticFunction
+)
+
+//the semantic kind of the names of every kind of symbol
+var semanticKinds = map[SymbolKind]SemanticKind{
+	SymbolVariable:  SemanticVariable,
+	SymbolConstant:  SemanticConstant,
+	SymbolField:     SemanticField,
+	SymbolParameter: SemanticParameter,
+	SymbolFunction:  SemanticFunction,
+}
+
+//an identifier or constant occurrence with its span, for editor highlighting and hovers
+type SemanticToken struct {
+	Kind        SemanticKind
+	Type        DataType // Unknown for undeclared variables
+	Declaration bool     // the occurrence declares the variable
+	Name        string
+	Pos         Position
+	End         Position // position just after the last character
+	DeclPos     Position // where the variable is declared
+}
+
+// SemanticTokens classifies every identifier and number in src. The names are resolved
+// by Parse and AnalyzeSymbols, so every occurrence gets the kind and type of the
+// declaration it refers to in its function, and a name that is not declared is a
+// variable of type Unknown. The fields of struct types are left out, and p.x is
+// classified at p.
+func SemanticTokens(src string) []SemanticToken {
+	program, _ := Parse(src)
+	symbols, _ := AnalyzeSymbols(program, Options{})
+
+	tokens := []Token{}
+	scanner := NewScanner(strings.NewReader(src))
+	for token := scanner.Scan(); token.TokenType != EOF; token = scanner.Scan() {
+		tokens = append(tokens, token)
+	}
+	declarations, positions := declarationTokens(tokens, symbols)
+	uses := map[int]*Symbol{} // by offset
+	for _, symbol := range symbols.Symbols {
+		for _, use := range symbol.Uses {
+			uses[use.Offset] = symbol
+		}
+	}
+	fields := fieldTokens(tokens)
+
+	result := []SemanticToken{}
+	for i, token := range tokens {
+		item := SemanticToken{Name: token.Lexeme, Pos: token.Position, End: token.End}
+		switch token.TokenType {
+		case NUM:
+			item.Kind, item.Type = SemanticConstant, Integer
+			if strings.ContainsAny(token.Lexeme, ".eE") {
+				item.Type = Float
+			}
+		case ID:
+			if fields[i] {
+				continue
+			}
+			symbol, declaration := declarations[i]
+			if !declaration {
+				symbol = uses[token.Position.Offset]
+			}
+			item.Declaration = declaration
+			if symbol != nil {
+				item.Kind, item.Type = semanticKinds[symbol.Kind], symbol.Type
+				item.DeclPos = positions[symbol]
+			}
+		default:
+			continue
+		}
+		result = append(result, item)
+	}
+	return result
+}
+
+//returns the symbol declared by every token that declares one, by the index of the token,
+//and the position of the declaration of every symbol: the first occurrence of its name
+//from the start of its declaration. A field is declared inside the braces of its struct,
+//after the name of the variable, which declares it.
+func declarationTokens(tokens []Token, symbols *SymbolTable) (map[int]*Symbol, map[*Symbol]Position) {
+	declarations := map[int]*Symbol{}
+	positions := map[*Symbol]Position{}
+	for _, symbol := range symbols.Symbols {
+		name, step := symbol.Name, 1
+		start := sort.Search(len(tokens), func(i int) bool { return tokens[i].Position.Offset >= symbol.Pos.Offset })
+		if symbol.Kind == SymbolField {
+			name, step = name[:strings.IndexByte(name, '.')], -1
+			start--
+		}
+		positions[symbol] = symbol.Pos
+		for i := start; i >= 0 && i < len(tokens); i += step {
+			if tokens[i].TokenType != ID || tokens[i].Lexeme != name {
+				continue
+			}
+			positions[symbol] = tokens[i].Position
+			// every field of a struct variable is declared by its name; the first one classifies it
+			if _, declared := declarations[i]; !declared {
+				declarations[i] = symbol
+			}
+			break
+		}
+	}
+	return declarations, positions
+}
+
+//returns the identifiers that are fields: the fields declared in the braces of a struct,
+//and the field after the dot of p.x
+func fieldTokens(tokens []Token) map[int]bool {
+	result := map[int]bool{}
+	body := false
+	for i, token := range tokens {
+		switch token.TokenType {
+		case LBRACKET:
+			body = i > 0 && tokens[i-1].TokenType == STRUCT
+		case RBRACKET:
+			body = false
+		case ID:
+			result[i] = body || i > 0 && tokens[i-1].TokenType == DOT
+		}
+	}
+	return result
+}
@@ -0,0 +1,68 @@
+package cpq
+
+import (
+	"fmt"
+	"testing"
+)
+
+//returns the tokens of src as "line:column name kind type", with " decl" for declarations
+//and " @line:column" for the declaration of a declared name
+func semanticSummary(src string) []string {
+	summary := []string{}
+	for _, token := range SemanticTokens(src) {
+		text := fmt.Sprintf("%d:%d %s %d %s", token.Pos.Line+1, token.Pos.Column+1, token.Name, token.Kind, token.Type)
+		if token.Declaration {
+			text += " decl"
+		} else if letter(rune(token.Name[0])) && token.Type != Unknown {
+			text += fmt.Sprintf(" @%d:%d", token.DeclPos.Line+1, token.DeclPos.Column+1)
+		}
+		summary = append(summary, text)
+	}
+	return summary
+}
+
+func TestSemanticTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			"constant",
+			"k : const float = 2.5;\na : int;\n{ a = k; }\n",
+			[]string{"1:1 k 1 float decl", "1:19 2.5 1 float", "2:1 a 0 int decl", "3:3 a 0 int @2:1", "3:7 k 1 float @1:1"},
+		},
+		{
+			//the braces of an enum do not end the declarations: the variable after them is declared
+			"enum",
+			"c : enum { red, green }; x : float;\n{ c = green; x = 1; }\n",
+			[]string{"1:1 c 0 int decl", "1:12 red 1 int decl", "1:17 green 1 int decl", "1:26 x 0 float decl",
+				"2:3 c 0 int @1:1", "2:7 green 1 int @1:17", "2:14 x 0 float @1:26", "2:18 1 1 int"},
+		},
+		{
+			"struct",
+			"p, q : struct { u : int; v : float; };\n{ q.u = 1; }\n",
+			[]string{"1:1 p 2 int decl", "1:4 q 2 int decl", "2:3 q 2 int @1:4", "2:9 1 1 int"},
+		},
+		{
+			//a local variable hides a global of the same name inside its function only
+			"function",
+			"a : int;\nfunc f(p : int) : float a : float; { a = p; return a; }\n{ a = 1; }\n",
+			[]string{"1:1 a 0 int decl", "2:6 f 4 float decl", "2:8 p 3 int decl", "2:25 a 0 float decl",
+				"2:38 a 0 float @2:25", "2:42 p 3 int @2:8", "2:52 a 0 float @2:25", "3:3 a 0 int @1:1", "3:7 1 1 int"},
+		},
+		{
+			"undeclared",
+			"a : int;\n{ b = 1; }\n",
+			[]string{"1:1 a 0 int decl", "2:3 b 0 unknown", "2:7 1 1 int"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := semanticSummary(test.src)
+			if fmt.Sprint(got) != fmt.Sprint(test.want) {
+				t.Errorf("SemanticTokens =\n%q\nwant\n%q", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package cpq
+
+import "encoding/json"
+
+//the source position of a line of resolved QUAD, with lines and columns counted from 1
+//like error messages
+type SourceMapping struct {
+	Quad   int `json:"quad"`   // line of the .qud file
+	Line   int `json:"line"`   // line of the statement in the source
+	Column int `json:"column"` // column of the statement
+}
+
+//maps the lines of a .qud file to the statements of the source that generated them,
+//written next to the output as NAME.qud.map
+type SourceMap struct {
+	Version  int             `json:"version"`
+	Source   string          `json:"source"` // name of the source file
+	Mappings []SourceMapping `json:"mappings"`
+}
+
+// NewSourceMap returns the source map of code after ResolveLabels, a mapping for every
+// instruction. Instructions added by the compiler, like the HALT of the main block or the
+// return of a function, have the position of the } that ends the block.
+func NewSourceMap(source string, code []Instruction) SourceMap {
+	m := SourceMap{Version: 1, Source: source, Mappings: make([]SourceMapping, 0, len(code))}
+	for _, ins := range code {
+		if ins.Label != "" {
+			continue
+		}
+		m.Mappings = append(m.Mappings, SourceMapping{
+			Quad:   len(m.Mappings) + 1,
+			Line:   ins.Pos.Line + 1,
+			Column: ins.Pos.Column + 1,
+		})
+	}
+	return m
+}
+
+//returns the source map as indented JSON
+func (m SourceMap) JSON() ([]byte, error) {
+	return json.MarshalIndent(m, "", "  ")
+}
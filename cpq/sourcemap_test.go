@@ -0,0 +1,74 @@
+package cpq
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+//every line of the output maps to the keyword of its statement, and the instructions the
+//compiler adds to the } that ends the block
+func TestSourceMap(t *testing.T) {
+	src := `a : int;
+func f(x : int) : int {
+    return x + 1;
+}
+{
+    input(a);
+    if (a > 0)
+        output(f(a));
+    while (a < 3) a = a + 1;
+}
+`
+	result, err := Compile(src, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := ResolveLabels(result.Instructions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(FormatInstructions(resolved, nil), "\n"), "\n")
+	m := NewSourceMap("prog.ou", resolved)
+	if len(m.Mappings) != len(lines) {
+		t.Fatalf("%d mappings for %d lines", len(m.Mappings), len(lines))
+	}
+	got := []string{}
+	for i, mapping := range m.Mappings {
+		if mapping.Quad != i+1 {
+			t.Errorf("mapping %d is of line %d", i+1, mapping.Quad)
+		}
+		got = append(got, fmt.Sprintf("%d:%d %s", mapping.Line, mapping.Column, strings.Fields(lines[i])[0]))
+	}
+	want := []string{
+		"6:5 IINP",
+		"7:5 IGRT", "7:5 JMPZ",
+		"8:9 IASN", "8:9 IASN", "8:9 JUMP", "8:9 IASN", "8:9 IPRT",
+		"9:5 ILSS", "9:5 JMPZ", "9:19 IADD", "9:19 JUMP",
+		"10:1 HALT",
+		"3:5 IADD",
+		"4:1 INQL", "4:1 JMPZ", "4:1 HALT",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("mappings:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	comments := []string{}
+	for _, line := range strings.Split(FormatWithSource(resolved, src, nil), "\n") {
+		if strings.HasPrefix(line, "#") {
+			comments = append(comments, line)
+		}
+	}
+	wantComments := []string{
+		"# line 6, char 5: input(a);",
+		"# line 7, char 5: if (a > 0)",
+		"# line 8, char 9: output(f(a));",
+		"# line 9, char 5: while (a < 3) a = a + 1;",
+		"# line 9, char 19: while (a < 3) a = a + 1;",
+		"# line 10, char 1: }",
+		"# line 3, char 5: return x + 1;",
+		"# line 4, char 1: }",
+	}
+	if strings.Join(comments, "\n") != strings.Join(wantComments, "\n") {
+		t.Errorf("source comments:\n%s\nwant:\n%s", strings.Join(comments, "\n"), strings.Join(wantComments, "\n"))
+	}
+}
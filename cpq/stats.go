@@ -0,0 +1,61 @@
+package cpq
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+)
+
+//wall time and allocations of one compiler phase
+type PhaseStats struct {
+	Phase    string
+	Duration time.Duration
+	Allocs   uint64 // heap objects allocated
+	Bytes    uint64 // heap bytes allocated
+}
+
+//per-phase statistics of a compilation
+type Stats struct {
+	Phases []PhaseStats
+}
+
+//runs fn as the named phase and records its time and allocations; a nil Stats only runs it
+func (s *Stats) Measure(phase string, fn func()) {
+	if s == nil {
+		fn()
+		return
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	fn()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	s.Phases = append(s.Phases, PhaseStats{
+		Phase:    phase,
+		Duration: elapsed,
+		Allocs:   after.Mallocs - before.Mallocs,
+		Bytes:    after.TotalAlloc - before.TotalAlloc,
+	})
+}
+
+//returns the total time of all phases
+func (s *Stats) Total() time.Duration {
+	var total time.Duration
+	for _, phase := range s.Phases {
+		total += phase.Duration
+	}
+	return total
+}
+
+//returns the stats as a table, one phase per line
+func (s *Stats) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-10s %12s %10s %12s\n", "phase", "time", "allocs", "bytes")
+	for _, phase := range s.Phases {
+		fmt.Fprintf(&b, "%-10s %12s %10d %12d\n", phase.Phase, phase.Duration, phase.Allocs, phase.Bytes)
+	}
+	fmt.Fprintf(&b, "%-10s %12s\n", "total", s.Total())
+	return b.String()
+}
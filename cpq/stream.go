@@ -0,0 +1,154 @@
+package cpq
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+)
+
+// CompileStream compiles CPL read from r into QUAD written to w without holding the
+// whole source, AST or output in memory. Statements of the main block are parsed and
+// generated one at a time into a temporary file, whose labels are resolved while it is
+// copied to w with the opcodes of opts. Nothing is written to w when there are errors.
+// As with CodegenStream the code is not optimized, so opts.MaxTemps and opts.Codegen
+// do not apply. Reading stops after opts.Limits.MaxSourceSize bytes, the input being
+// then only reported as too large. The errors are returned before the warnings.
+func CompileStream(r io.Reader, w io.Writer, opts Options) ([]ErrorType, []ErrorType) {
+	var size *sizeLimit
+	if opts.Limits.MaxSourceSize > 0 {
+		size = &sizeLimit{r: r, limit: opts.Limits.MaxSourceSize}
+		r = size
+	}
+	reader := bufio.NewReader(r)
+	if bom, _ := reader.Peek(len(bomUTF8)); bytes.Equal(bom, bomUTF8) {
+		_, _ = reader.Discard(len(bomUTF8))
+	}
+	tmp, err := os.CreateTemp("", "cpq-*.quad")
+	if err != nil {
+		return []ErrorType{{Code: CodeTempFileCreate, Message: fmt.Sprintf("cannot create temporary file: %s", err)}}, nil
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	p := newParserWithOptions(reader, opts)
+	a := newAnalyzer(opts)
+	c := newCodegen(tmp, nil, opts)
+	declarations := p.ParseDeclarations()
+	a.declarations(declarations)
+	c.CodegenDeclarations(declarations)
+	functions := p.ParseFunctions()
+	a.declareFunctions(functions)
+	c.DeclareFunctions(functions)
+
+	// stmt_block, one statement at a time
+	startBlockToken, startBlock := p.match(LBRACKET)
+	if !startBlock {
+		p.addError(newError(startBlockToken.Lexeme, []string{"{"}, startBlockToken.Position))
+	}
+	var writeErr error // the first one, the statements after it are still checked
+	for {
+		statement := p.nextStatement()
+		if statement == nil {
+			break
+		}
+		a.statement(statement)
+		c.CodegenStatement(statement)
+		if err := c.writeCode(); err != nil && writeErr == nil {
+			writeErr = err
+		}
+	}
+	endBlockToken, ok := p.match(RBRACKET)
+	if !ok && startBlock {
+		p.addError(newError(endBlockToken.Lexeme, []string{"}"}, endBlockToken.Position))
+	}
+	if token, ok := p.match(EOF); !ok {
+		p.addError(newError(token.Lexeme, []string{"EOF"}, token.Position))
+	}
+	a.analyzeFunctions()
+	c.closingBrace(endBlockToken.Position)
+	c.emit("HALT")
+	c.CodegenFunctions()
+	if writeErr == nil {
+		writeErr = c.Flush()
+	}
+	if writeErr != nil {
+		c.addError(ErrorType{Code: CodeTempFileWrite, Message: fmt.Sprintf("cannot write temporary file: %s", writeErr)})
+	}
+
+	if size != nil && size.read > size.limit {
+		return []ErrorType{{Code: CodeInputTooLarge, Message: fmt.Sprintf("input too large: more than %d bytes", size.limit)}}, nil
+	}
+	errors := append(append(p.Errors, a.Errors...), c.Errors...)
+	if len(errors) > 0 {
+		return errors, c.Warnings
+	}
+	if err := resolveLabelsStream(tmp, w, opts.Opcodes); err != nil {
+		if _, ok := err.(outputError); ok {
+			return []ErrorType{{Code: CodeOutputWrite, Message: fmt.Sprintf("cannot write output: %s", err)}}, c.Warnings
+		}
+		return []ErrorType{{Code: CodeInternal, Message: err.Error()}}, c.Warnings
+	}
+	return nil, c.Warnings
+}
+
+//a reader that ends one byte after limit, so that a longer input is read no further
+//than needed to know it is too long
+type sizeLimit struct {
+	r     io.Reader
+	read  int
+	limit int
+}
+
+func (s *sizeLimit) Read(p []byte) (int, error) {
+	if s.read > s.limit {
+		return 0, io.EOF
+	}
+	if len(p) > s.limit+1-s.read {
+		p = p[:s.limit+1-s.read]
+	}
+	n, err := s.r.Read(p)
+	s.read += n
+	return n, err
+}
+
+// CodegenStream generates the code of a parsed program straight to w: the instructions of
+// every statement of the main block, then of every function, are written as soon as they
+// are generated instead of being held until the end. The labels are left for the reader
+// to resolve, as RemoveLabels does, and the code is neither optimized nor given the
+// temporary names of opts.Codegen. The generation stops at the first error of w, which
+// is returned after the errors and warnings; w is flushed but not closed. When there
+// are errors the output is incomplete.
+func CodegenStream(program *Program, w io.Writer, opts Options) ([]ErrorType, []ErrorType, error) {
+	c := newCodegen(w, AnalyzeWithOptions(program, opts), opts)
+	c.Opcodes = opts.Opcodes
+	if c.Diagnostics.Full() {
+		return c.Errors, c.Warnings, nil
+	}
+	c.CodegenDeclarations(program.Declarations)
+	c.DeclareFunctions(program.Functions)
+	for _, statement := range program.StatementsBlock.Statements {
+		c.CodegenStatement(statement)
+		if err := c.writeCode(); err != nil {
+			return c.Errors, c.Warnings, err
+		}
+	}
+	c.closingBrace(program.StatementsBlock.End)
+	c.emit("HALT")
+	c.CodegenFunctions()
+	return c.Errors, c.Warnings, c.Flush()
+}
+
+func scanQuadLines(file io.ReadSeeker, fn func(string) error) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if err := fn(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,115 @@
+package cpq
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestCompileStreamReportsSemanticErrors(t *testing.T) {
+	src := "a : int; b : bool;\nfunc f(q : int) : int { output(q); }\n{ a = b + 1; c = 2; a = f(1); }\n"
+	var out bytes.Buffer
+	errors, _ := CompileStream(strings.NewReader(src), &out, Options{})
+	want := []string{
+		"cannot use bool values in arithmetic",
+		"undefined variable c",
+		"missing return at the end of function f",
+	}
+	if len(errors) != len(want) {
+		t.Fatalf("errors = %v, want %q", errors, want)
+	}
+	for i, e := range errors {
+		if e.Text() != want[i] {
+			t.Errorf("error %d = %q, want %q", i, e.Text(), want[i])
+		}
+	}
+	if out.Len() > 0 {
+		t.Errorf("wrote %q for a program with errors", out.String())
+	}
+}
+
+func TestCompileStreamLimits(t *testing.T) {
+	src := "a : int;\n{ input(a); while (a < 10) a = a + 1; output(a); }\n"
+	tests := []struct {
+		limits  Limits
+		message string
+	}{
+		{Limits{MaxSourceSize: 20}, "input too large: more than 20 bytes"},
+		{Limits{MaxTokens: 12}, "input too large: more than 12 tokens"},
+		{Limits{MaxNodes: 5}, "input too large: more than 5 syntax nodes"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		errors, _ := CompileStream(strings.NewReader(src), &out, Options{Limits: test.limits})
+		found := false
+		for _, e := range errors {
+			found = found || e.Code == CodeInputTooLarge && e.Text() == test.message
+		}
+		if !found || out.Len() > 0 {
+			t.Errorf("%+v: errors = %v, output %q", test.limits, errors, out.String())
+		}
+	}
+	var out bytes.Buffer
+	limits := Limits{MaxSourceSize: len(src), MaxTokens: 100, MaxNodes: 100}
+	if errors, _ := CompileStream(strings.NewReader(src), &out, Options{Limits: limits}); len(errors) > 0 || out.Len() == 0 {
+		t.Errorf("within the limits: errors = %v, output %q", errors, out.String())
+	}
+}
+
+//a reader of an endless input, of which CompileStream reads only the limit
+type endless struct{ read int }
+
+func (e *endless) Read(p []byte) (int, error) {
+	for n := range p {
+		p[n] = " a = a + 1;"[(e.read+n)%11]
+	}
+	e.read += len(p)
+	return len(p), nil
+}
+
+func TestCompileStreamStopsReading(t *testing.T) {
+	in := &endless{}
+	errors, _ := CompileStream(in, &bytes.Buffer{}, Options{Limits: Limits{MaxSourceSize: 1000}})
+	if len(errors) != 1 || errors[0].Code != CodeInputTooLarge || in.read > 1001 {
+		t.Errorf("errors = %v after reading %d bytes", errors, in.read)
+	}
+}
+
+//a write error of the output is returned whether it happens while the buffer fills up or
+//when it is flushed
+func TestCodegenStreamWriteError(t *testing.T) {
+	tests := []struct {
+		src  string
+		left []int // bytes written before the error, fewer than the output
+	}{
+		{"a : int;\n{ input(a); output(a); }\n", []int{0, 10}},
+		{generateStressProgram(stressConfig{Statements: 2000}), []int{0, 10, 5000, 50000}},
+	}
+	for _, test := range tests {
+		program, _ := Parse(test.src)
+		for _, left := range test.left {
+			_, _, err := CodegenStream(program, &failingWriter{left: left}, Options{})
+			if err == nil || err.Error() != "disk full" {
+				t.Errorf("%d bytes of source, writer failing after %d bytes: error = %v", len(test.src), left, err)
+			}
+			errors, _ := CompileStream(strings.NewReader(test.src), &failingWriter{left: left}, Options{})
+			if len(errors) != 1 || errors[0].Code != CodeOutputWrite || errors[0].Text() != "cannot write output: disk full" {
+				t.Errorf("%d bytes of source, writer failing after %d bytes: CompileStream errors = %v", len(test.src), left, errors)
+			}
+		}
+	}
+}
+
+//the warnings of the generated code are returned with the output
+func TestCompileStreamWarnings(t *testing.T) {
+	src := "a : int; x : float;\n{ input(a); x = a * 1.5; output(x); }\n"
+	var out bytes.Buffer
+	errors, warnings := CompileStream(strings.NewReader(src), &out, Options{})
+	if len(errors) > 0 || len(warnings) != 1 || warnings[0].Code != CodeWarnPromotion || out.Len() == 0 {
+		t.Errorf("errors = %v, warnings = %v, output %q", errors, warnings, out.String())
+	}
+	errors, _ = CompileStream(strings.NewReader(src), &bytes.Buffer{}, Options{Werror: true})
+	if len(errors) != 1 || errors[0].Code != CodeWarnPromotion {
+		t.Errorf("with Werror: errors = %v", errors)
+	}
+}
@@ -0,0 +1,175 @@
+package cpq
+
+import (
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+//shape of a generated stress program
+type stressConfig struct {
+	Statements int // statements in the main block
+	Depth      int // nesting depth of blocks, ifs and loops
+	Switches   int // switch statements, each with several case labels
+}
+
+//standard stress shapes, each compiled within the budget
+var stressSuite = []stressConfig{
+	{Statements: 20000},
+	{Statements: 100, Depth: 500},
+	{Statements: 100, Switches: 200},
+	{Statements: 40000, Depth: 50, Switches: 50},
+}
+
+//resources a stress compilation may use
+const (
+	stressTime   = 10 * time.Second
+	stressMemory = 1 << 30 // bytes allocated during the compilation
+)
+
+//returns a valid CPL program of the given shape, to stress the scanner, parser and code
+//generator with inputs far bigger than class exercises
+func generateStressProgram(cfg stressConfig) string {
+	var b strings.Builder
+	b.WriteString("a, b, i : int;\nx, y : float;\n{\n")
+	b.WriteString("input(a);\ninput(x);\n")
+	for n := 0; n < cfg.Statements; n++ {
+		switch n % 4 {
+		case 0:
+			fmt.Fprintf(&b, "b = a + %d * i;\n", n)
+		case 1:
+			fmt.Fprintf(&b, "y = x / %d.5 - b;\n", n)
+		case 2:
+			fmt.Fprintf(&b, "if (a < %d) output(a); else output(y);\n", n)
+		case 3:
+			b.WriteString("i = static_cast(int) (y);\n")
+		}
+	}
+	for d := 0; d < cfg.Depth; d++ {
+		fmt.Fprintf(&b, "while (i < %d && !(a == b)) {\ni = i + 1;\n", d+1)
+	}
+	b.WriteString("output(i);\n")
+	for d := 0; d < cfg.Depth; d++ {
+		b.WriteString("}\n")
+	}
+	for n := 0; n < cfg.Switches; n++ {
+		b.WriteString("switch (a) {\n")
+		for c := 0; c < 8; c++ {
+			fmt.Fprintf(&b, "case %d: output(%d); break;\n", c, n*8+c)
+		}
+		b.WriteString("default: output(a);\n}\n")
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
+
+//compiles a generated program to resolved QUAD
+func stressCompile(src string) (string, error) {
+	program, parseErrors := Parse(src)
+	code, codegenErrors, _ := CodegenInstructions(program, Options{})
+	if errors := append(parseErrors, codegenErrors...); len(errors) > 0 {
+		return "", fmt.Errorf("%d errors, first: %s", len(errors), errors[0].Error())
+	}
+	resolved, err := ResolveLabels(code)
+	if err != nil {
+		return "", err
+	}
+	return FormatInstructions(resolved, nil), nil
+}
+
+//checks that resolved QUAD output is well formed: known opcodes with the right number of
+//operands, jump targets inside the program, and a final HALT
+func verifyQuad(quad string) error {
+	lines := strings.Split(strings.TrimSuffix(quad, "\n"), "\n")
+	for i, line := range lines {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return fmt.Errorf("line %d: empty instruction", i+1)
+		}
+		operands, ok := quadOperands[fields[0]]
+		if !ok {
+			return fmt.Errorf("line %d: unknown instruction %s", i+1, fields[0])
+		}
+		if len(fields)-1 != operands {
+			return fmt.Errorf("line %d: %s takes %d operands, found %d", i+1, fields[0], operands, len(fields)-1)
+		}
+		if fields[0] == "JUMP" || fields[0] == "JMPZ" {
+			target, err := strconv.Atoi(fields[1])
+			if err != nil || target < 1 || target > len(lines) {
+				return fmt.Errorf("line %d: jump target %s is outside the program", i+1, fields[1])
+			}
+		}
+	}
+	if lines[len(lines)-1] != "HALT" {
+		return fmt.Errorf("program does not end with HALT")
+	}
+	return nil
+}
+
+func TestStress(t *testing.T) {
+	if testing.Short() {
+		t.Skip("compiles programs of tens of thousands of statements")
+	}
+	for _, cfg := range stressSuite {
+		t.Run(fmt.Sprintf("%+v", cfg), func(t *testing.T) {
+			src := generateStressProgram(cfg)
+			var before, after runtime.MemStats
+			runtime.ReadMemStats(&before)
+			start := time.Now()
+			quad, err := stressCompile(src)
+			elapsed := time.Since(start)
+			runtime.ReadMemStats(&after)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := verifyQuad(quad); err != nil {
+				t.Fatal(err)
+			}
+			allocated := after.TotalAlloc - before.TotalAlloc
+			t.Logf("%d bytes -> %d lines in %s, %d bytes allocated", len(src), strings.Count(quad, "\n"), elapsed, allocated)
+			if elapsed > stressTime {
+				t.Errorf("compilation took %s, the budget is %s", elapsed, stressTime)
+			}
+			if allocated > stressMemory {
+				t.Errorf("compilation allocated %d bytes, the budget is %d", allocated, stressMemory)
+			}
+		})
+	}
+}
+
+func TestVerifyQuad(t *testing.T) {
+	tests := []struct {
+		quad string
+		err  string
+	}{
+		{"IASN a 1\nJUMP 1\nHALT\n", ""},
+		{"IASN a\nHALT\n", "line 1: IASN takes 2 operands, found 1"},
+		{"JMPZ 4 a\nHALT\n", "line 1: jump target 4 is outside the program"},
+		{"MOVE a b\nHALT\n", "line 1: unknown instruction MOVE"},
+		{"IPRT a\n", "program does not end with HALT"},
+	}
+	for _, test := range tests {
+		err := verifyQuad(test.quad)
+		if (err == nil && test.err != "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("verifyQuad(%q) = %v, want %q", test.quad, err, test.err)
+		}
+	}
+}
+
+func BenchmarkStressCompile(b *testing.B) {
+	for _, cfg := range stressSuite {
+		src := generateStressProgram(cfg)
+		b.Run(fmt.Sprintf("%+v", cfg), func(b *testing.B) {
+			b.ReportAllocs()
+			b.SetBytes(int64(len(src)))
+			for n := 0; n < b.N; n++ {
+				if _, err := stressCompile(src); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package cpq
+
+import "fmt"
+
+//returns the message of an undefined variable, with the closest declared name when one
+//is near enough to be a typo: undefined variable conut; did you mean count?
+func undefinedVariableMessage(name string, scopes ...map[string]DataType) string {
+	if suggestion := closestName(name, scopes...); suggestion != "" {
+		return fmt.Sprintf("undefined variable %s; did you mean %s?", name, suggestion)
+	}
+	return fmt.Sprintf("undefined variable %s", name)
+}
+
+//returns the name of the scopes with the smallest edit distance to name, the first in
+//alphabetical order on a tie; "" when every name needs more than a third of the edits
+func closestName(name string, scopes ...map[string]DataType) string {
+	limit := (len([]rune(name)) + 1) / 3
+	best, bestDistance := "", limit+1
+	for _, scope := range scopes {
+		for candidate := range scope {
+			if candidate == name {
+				continue
+			}
+			distance := editDistance(name, candidate)
+			if distance < bestDistance || distance == bestDistance && candidate < best {
+				best, bestDistance = candidate, distance
+			}
+		}
+	}
+	return best
+}
+
+//returns the Levenshtein distance of two names: the insertions, deletions and
+//substitutions of characters that change one into the other
+func editDistance(a, b string) int {
+	s, t := []rune(a), []rune(b)
+	row := make([]int, len(t)+1)
+	for j := range row {
+		row[j] = j
+	}
+	for i := 1; i <= len(s); i++ {
+		diagonal := row[0]
+		row[0] = i
+		for j := 1; j <= len(t); j++ {
+			cost := 1
+			if s[i-1] == t[j-1] {
+				cost = 0
+			}
+			above := row[j]
+			row[j] = min(above+1, row[j-1]+1, diagonal+cost)
+			diagonal = above
+		}
+	}
+	return row[len(t)]
+}
@@ -0,0 +1,146 @@
+package cpq
+
+import "sort"
+
+//kind of a declared name.
+type SymbolKind int
+
+const (
+	SymbolVariable SymbolKind = iota
+	SymbolConstant            // also the values of an enum
+	SymbolField               // a field of a struct variable, p.x
+	SymbolParameter
+	SymbolFunction // a function or a procedure
+)
+
+func (kind SymbolKind) String() string {
+	switch kind {
+	case SymbolConstant:
+		return "constant"
+	case SymbolField:
+		return "field"
+	case SymbolParameter:
+		return "parameter"
+	case SymbolFunction:
+		return "function"
+	}
+	return "variable"
+}
+
+//a declared name with the places it is used
+type Symbol struct {
+	Name     string // as written in the source, p.x for a field
+	Kind     SymbolKind
+	Type     DataType   // the return type of a function, Unknown for a procedure
+	Size     int64      // elements of an array, 0 for a scalar
+	Function string     // function whose parameter or local variable it is, "" for a global
+	Pos      Position   // the declaration
+	Uses     []Position // every use, in the order of the source
+}
+
+//the names declared by a program, built by AnalyzeSymbols
+type SymbolTable struct {
+	Symbols []*Symbol // in the order of their declarations
+}
+
+//returns the symbol a name refers to inside function, "" for the main block: a parameter
+//or local variable of the function, or a global; nil when it is not declared
+func (t *SymbolTable) Lookup(name, function string) *Symbol {
+	var global *Symbol
+	for _, symbol := range t.Symbols {
+		if symbol.Name != name {
+			continue
+		}
+		if function != "" && symbol.Function == function {
+			return symbol
+		}
+		if symbol.Function == "" && global == nil {
+			global = symbol
+		}
+	}
+	return global
+}
+
+//returns the symbol declared or used at the line and column of pos, nil for none
+func (t *SymbolTable) At(pos Position) *Symbol {
+	same := func(p Position) bool { return p.Line == pos.Line && p.Column == pos.Column }
+	for _, symbol := range t.Symbols {
+		if same(symbol.Pos) {
+			return symbol
+		}
+		for _, use := range symbol.Uses {
+			if same(use) {
+				return symbol
+			}
+		}
+	}
+	return nil
+}
+
+// AnalyzeSymbols analyzes a program like AnalyzeWithOptions and also returns its symbol
+// table, for tools that go to the declaration of a name or rename it. A name declared
+// twice has the symbol of its first declaration.
+func AnalyzeSymbols(program *Program, opts Options) (*SymbolTable, []ErrorType) {
+	a := newAnalyzer(opts)
+	a.symbols = &SymbolTable{Symbols: []*Symbol{}}
+	a.analyzeProgram(program)
+	for _, symbol := range a.symbols.Symbols {
+		sortUses(symbol)
+	}
+	return a.symbols, a.Errors
+}
+
+//sorts the uses of a symbol by position; the functions are analyzed after the main block,
+//and a compound assignment a += 1 uses a twice at the same place
+func sortUses(symbol *Symbol) {
+	uses := symbol.Uses
+	sort.Slice(uses, func(i, j int) bool {
+		if uses[i].Line != uses[j].Line {
+			return uses[i].Line < uses[j].Line
+		}
+		return uses[i].Column < uses[j].Column
+	})
+	unique := uses[:0]
+	for _, use := range uses {
+		if n := len(unique); n == 0 || unique[n-1] != use {
+			unique = append(unique, use)
+		}
+	}
+	symbol.Uses = unique
+}
+
+//adds the symbol of a variable declared under its QUAD name
+func (a *analyzer) declareSymbol(qname string, symbol *Symbol) {
+	if a.symbols == nil {
+		return
+	}
+	a.symbols.Symbols = append(a.symbols.Symbols, symbol)
+	a.variableSymbols[qname] = symbol
+}
+
+//adds the symbol of the i-th name of a declaration
+func (a *analyzer) declarationSymbol(declaration *Declaration, i int, qname string) {
+	symbol := &Symbol{
+		Name: declaration.Names[i],
+		Kind: SymbolVariable,
+		Type: declaration.Type,
+		Size: declaration.Size(i),
+		Pos:  declaration.Pos,
+	}
+	if a.function != nil {
+		symbol.Function = a.function.Name
+	}
+	if name, isField := fieldName(declaration, symbol.Name); isField {
+		symbol.Name, symbol.Kind = name, SymbolField
+	} else if declaration.Const {
+		symbol.Kind = SymbolConstant
+	}
+	a.declareSymbol(qname, symbol)
+}
+
+//records a use of the variable with a QUAD name
+func (a *analyzer) use(qname string, pos Position) {
+	if symbol := a.variableSymbols[qname]; symbol != nil {
+		symbol.Uses = append(symbol.Uses, pos)
+	}
+}
@@ -4,7 +4,10 @@ import (
 	"bufio"
 	"bytes"
 	"io"
+	"iter"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
 var eof = rune(0)
@@ -43,17 +46,42 @@ const (
 	NOT
 	ID
 	NUM
+	DOTDOT
+	FUNC
+	RETURN
+	LSQUARE
+	RSQUARE
+	FOR
+	DO
+	CONTINUE
+	CONST
+	BOOL
+	TRUE
+	FALSE
+	ASSIGNOP
+	INCDEC
+	FALLTHROUGH
+	STRING
+	CHAR
+	QUESTION
+	ENUM
+	STRUCT
+	DOT
 )
 
+//place of a character in the source; src[Offset:End.Offset] is the lexeme of a token
 type Position struct {
-	Line   int
-	Column int
+	Line   int // zero based
+	Column int // zero based, in runes
+	Offset int // bytes before the character, "\r\n" counting as two
 }
 
 type Token struct {
 	TokenType TokenType
 	Lexeme    string
+	Operator  Operator // of an ADDOP, MULOP, RELOP, ASSIGNOP or INCDEC: + of +=, - of --
 	Position  Position
+	End       Position // position just after the last character
 }
 
 var tokens = [...]string{
@@ -71,26 +99,83 @@ var tokens = [...]string{
 	EQUALS:    "=",
 
 	// Keywords
-	BREAK:      "break",
-	CASE:       "case",
-	DEFAULT:    "default",
-	ELSE:       "else",
-	FLOAT:      "float",
-	IF:         "if",
-	INPUT:      "input",
-	INT:        "int",
-	OUTPUT:     "output",
-	STATICCAST: "static_cast",
-	SWITCH:     "switch",
-	WHILE:      "while",
-	RELOP:      "RELOP",
-	ADDOP:      "ADDOP",
-	MULOP:      "MULOP",
-	OR:         "||",
-	AND:        "&&",
-	NOT:        "!",
-	ID:         "ID",
-	NUM:        "NUM",
+	BREAK:       "break",
+	CASE:        "case",
+	DEFAULT:     "default",
+	ELSE:        "else",
+	FLOAT:       "float",
+	IF:          "if",
+	INPUT:       "input",
+	INT:         "int",
+	OUTPUT:      "output",
+	STATICCAST:  "static_cast",
+	SWITCH:      "switch",
+	WHILE:       "while",
+	RELOP:       "RELOP",
+	ADDOP:       "ADDOP",
+	MULOP:       "MULOP",
+	OR:          "||",
+	AND:         "&&",
+	NOT:         "!",
+	ID:          "ID",
+	NUM:         "NUM",
+	DOTDOT:      "..",
+	FUNC:        "func",
+	RETURN:      "return",
+	LSQUARE:     "[",
+	RSQUARE:     "]",
+	FOR:         "for",
+	DO:          "do",
+	CONTINUE:    "continue",
+	CONST:       "const",
+	BOOL:        "bool",
+	TRUE:        "true",
+	FALSE:       "false",
+	ASSIGNOP:    "ASSIGNOP",
+	INCDEC:      "INCDEC",
+	FALLTHROUGH: "fallthrough",
+	STRING:      "STRING",
+	CHAR:        "CHAR",
+	QUESTION:    "?",
+	ENUM:        "enum",
+	STRUCT:      "struct",
+	DOT:         ".",
+}
+
+//operator of every character of an ADDOP or MULOP
+var arithmeticOperators = map[rune]Operator{
+	'+': Add,
+	'-': Subtract,
+	'*': Multiply,
+	'/': Divide,
+	'%': Modulo,
+}
+
+var keywords = map[string]TokenType{
+	"bool":        BOOL,
+	"break":       BREAK,
+	"case":        CASE,
+	"const":       CONST,
+	"continue":    CONTINUE,
+	"default":     DEFAULT,
+	"do":          DO,
+	"else":        ELSE,
+	"enum":        ENUM,
+	"false":       FALSE,
+	"fallthrough": FALLTHROUGH,
+	"float":       FLOAT,
+	"for":         FOR,
+	"func":        FUNC,
+	"if":          IF,
+	"input":       INPUT,
+	"int":         INT,
+	"output":      OUTPUT,
+	"return":      RETURN,
+	"static_cast": STATICCAST,
+	"struct":      STRUCT,
+	"switch":      SWITCH,
+	"true":        TRUE,
+	"while":       WHILE,
 }
 
 const MaxIdentifierLength = 9
@@ -106,6 +191,17 @@ type Scanner struct {
 		position Position
 	}
 	DisablePositions bool
+	MaxTokens        int
+	FlatComments     bool // a comment ends at the first */, as in standard CPL, instead of nesting
+	tokenCount       int
+	exceeded         bool
+	identifiers      map[string]string
+	lineComments     []Position // where the // comments scanned start, not standard CPL
+	prescanned       []scanned  // tokens Scan returns instead of scanning, see prescan
+
+	//identifiers may have any Unicode letter, not only the ASCII ones; without it an
+	//identifier with other letters is an ILLEGAL token
+	UnicodeIdentifiers bool
 }
 
 func (tok TokenType) String() string {
@@ -129,7 +225,8 @@ func digit(ch rune) bool {
 
 func NewScanner(reader io.Reader) *Scanner {
 	return &Scanner{
-		Reader: bufio.NewReader(reader),
+		Reader:      bufio.NewReader(reader),
+		identifiers: map[string]string{},
 	}
 }
 
@@ -139,13 +236,15 @@ func (s *Scanner) read() (rune, Position) {
 		s.bufferSize--
 		return s.curr()
 	}
-	ch, _, err := s.Reader.ReadRune()
+	ch, size, err := s.Reader.ReadRune()
 	if err != nil {
 		ch = eof
 	} else if ch == '\r' {
 		if ch, _, err := s.Reader.ReadRune(); err != nil {
 		} else if ch != '\n' {
 			_ = s.Reader.UnreadRune()
+		} else {
+			size++
 		}
 		ch = '\n'
 	}
@@ -153,6 +252,7 @@ func (s *Scanner) read() (rune, Position) {
 	buffer := &s.buffer[s.bufferIndex]
 	buffer.ch, buffer.position = ch, s.position
 
+	s.position.Offset += size
 	if ch == '\n' {
 		s.position.Line++
 		s.position.Column = 0
@@ -178,30 +278,122 @@ func (s *Scanner) curr() (ch rune, pos Position) {
 	return buffer.ch, buffer.position
 }
 
+//reports whether scanning stopped early because of MaxTokens
+func (s *Scanner) LimitExceeded() bool {
+	return s.exceeded
+}
+
+//returns the position of the next character to read
+func (s *Scanner) nextPosition() Position {
+	if s.DisablePositions {
+		return Position{}
+	}
+	if s.bufferSize > 0 {
+		bufferIndex := (s.bufferIndex - s.bufferSize + 1 + len(s.buffer)) % len(s.buffer)
+		return s.buffer[bufferIndex].position
+	}
+	return s.position
+}
+
 func (s *Scanner) Unscan() {
 	s.bufferSize++
 }
 
+//skips the rest of a comment after its /*, with the comments nested in it unless
+//FlatComments is set; returns io.EOF when the comment is not closed
 func (s *Scanner) moveEnd() error {
-	for {
-		if ch, _ := s.read(); ch == '*' {
-		star:
-			ch2, _ := s.read()
-			if ch2 == '/' {
+	depth := 1
+	for previous := rune(0); ; {
+		ch, _ := s.read()
+		switch {
+		case ch == eof:
+			return io.EOF
+		case previous == '*' && ch == '/':
+			if depth--; depth == 0 {
 				return nil
-			} else if ch2 == '*' {
-				goto star
-			} else if ch2 == eof {
-				return io.EOF
 			}
-		} else if ch == eof {
-			return io.EOF
+			ch = 0 // the / of */ starts no comment
+		case previous == '/' && ch == '*' && !s.FlatComments:
+			depth++
+			ch = 0 // nor does the * of /* end one
 		}
+		previous = ch
 	}
 }
 
 //Scan returns next token
 func (s *Scanner) Scan() Token {
+	if len(s.prescanned) > 0 {
+		next := s.prescanned[0]
+		if len(s.prescanned) > 1 {
+			s.prescanned = s.prescanned[1:]
+		}
+		s.exceeded = next.exceeded
+		return next.token
+	}
+	token := s.scan()
+	token.End = s.nextPosition()
+	return token
+}
+
+//a token scanned ahead by prescan, with whether MaxTokens was exceeded once it was
+type scanned struct {
+	token    Token
+	exceeded bool
+}
+
+//scans all the tokens up to EOF, which Scan then returns again with the same
+//LimitExceeded, so that the scanning can be timed apart from the parsing
+func (s *Scanner) prescan() {
+	tokens := []scanned{}
+	for {
+		token := s.Scan()
+		tokens = append(tokens, scanned{token, s.exceeded})
+		if token.TokenType == EOF {
+			break
+		}
+	}
+	s.prescanned, s.exceeded = tokens, false
+}
+
+// All returns the tokens left to scan, without the final EOF.
+func (s *Scanner) All() []Token {
+	tokens := []Token{}
+	for token := s.Scan(); token.TokenType != EOF; token = s.Scan() {
+		tokens = append(tokens, token)
+	}
+	return tokens
+}
+
+// Tokens returns an iterator over the tokens of src, with their lexemes, positions and
+// ends, for tools like syntax highlighters that need the tokens without parsing:
+//
+//	for token := range cpq.Tokens(src) {
+//		fmt.Println(token.TokenType, token.Lexeme, token.Position.Line)
+//	}
+//
+// A character that starts no token is an ILLEGAL token, and comments and spaces are
+// skipped, so they are the text between the End of a token and the next one. The
+// iteration ends before EOF.
+func Tokens(src string) iter.Seq[Token] {
+	return func(yield func(Token) bool) {
+		scanner := NewScanner(strings.NewReader(src))
+		for token := scanner.Scan(); token.TokenType != EOF; token = scanner.Scan() {
+			if !yield(token) {
+				return
+			}
+		}
+	}
+}
+
+func (s *Scanner) scan() Token {
+	if s.MaxTokens > 0 {
+		if s.tokenCount >= s.MaxTokens {
+			s.exceeded = true
+			return Token{TokenType: EOF, Lexeme: "EOF", Position: s.position}
+		}
+		s.tokenCount++
+	}
 
 	ch, pos := s.read()
 	for {
@@ -209,8 +401,11 @@ func (s *Scanner) Scan() Token {
 			ch2, _ := s.read()
 			if ch2 == '*' {
 				if err := s.moveEnd(); err != nil {
-					return Token{TokenType: ILLEGAL, Lexeme: "", Position: pos}
+					return Token{TokenType: ILLEGAL, Lexeme: "/*", Position: pos}
 				}
+			} else if ch2 == '/' {
+				s.lineComments = append(s.lineComments, pos)
+				s.skipLine()
 			} else {
 				s.Unscan()
 				break
@@ -222,7 +417,7 @@ func (s *Scanner) Scan() Token {
 		}
 		ch, pos = s.read()
 	}
-	if letter(ch) {
+	if unicode.IsLetter(ch) {
 		s.Unscan()
 		return s.findIdentifier()
 	} else if digit(ch) {
@@ -234,17 +429,21 @@ func (s *Scanner) Scan() Token {
 		return Token{TokenType: EOF, Lexeme: "EOF", Position: pos}
 
 	case '>', '<':
+		operator, orEqual := GreaterThan, GreaterThanOrEqualTo
+		if ch == '<' {
+			operator, orEqual = LessThan, LessThenOrEqualTo
+		}
 		ch2, _ := s.read()
 		if ch2 == '=' {
-			return Token{TokenType: RELOP, Lexeme: string(ch) + string(ch2), Position: pos}
+			return Token{TokenType: RELOP, Lexeme: string(ch) + string(ch2), Operator: orEqual, Position: pos}
 		}
 		s.Unscan()
-		return Token{TokenType: RELOP, Lexeme: string(ch), Position: pos}
+		return Token{TokenType: RELOP, Lexeme: string(ch), Operator: operator, Position: pos}
 
 	case '=':
 		ch2, _ := s.read()
 		if ch2 == '=' {
-			return Token{TokenType: RELOP, Lexeme: "==", Position: pos}
+			return Token{TokenType: RELOP, Lexeme: "==", Operator: EqualTo, Position: pos}
 		}
 		s.Unscan()
 		return Token{TokenType: EQUALS, Lexeme: string(ch), Position: pos}
@@ -252,7 +451,7 @@ func (s *Scanner) Scan() Token {
 	case '!':
 		ch2, _ := s.read()
 		if ch2 == '=' {
-			return Token{TokenType: RELOP, Lexeme: "!=", Position: pos}
+			return Token{TokenType: RELOP, Lexeme: "!=", Operator: NotEqualTo, Position: pos}
 		}
 		s.Unscan()
 		return Token{TokenType: NOT, Lexeme: string(ch), Position: pos}
@@ -274,10 +473,22 @@ func (s *Scanner) Scan() Token {
 		return Token{TokenType: ILLEGAL, Lexeme: string(ch), Position: pos}
 
 	case '+', '-':
-		return Token{TokenType: ADDOP, Lexeme: string(ch), Position: pos}
+		operator := arithmeticOperators[ch]
+		if ch2, _ := s.read(); ch2 == '=' {
+			return Token{TokenType: ASSIGNOP, Lexeme: string(ch) + "=", Operator: operator, Position: pos}
+		} else if ch2 == ch {
+			return Token{TokenType: INCDEC, Lexeme: string(ch) + string(ch), Operator: operator, Position: pos}
+		}
+		s.Unscan()
+		return Token{TokenType: ADDOP, Lexeme: string(ch), Operator: operator, Position: pos}
 
-	case '*', '/':
-		return Token{TokenType: MULOP, Lexeme: string(ch), Position: pos}
+	case '*', '/', '%':
+		operator := arithmeticOperators[ch]
+		if ch2, _ := s.read(); ch2 == '=' {
+			return Token{TokenType: ASSIGNOP, Lexeme: string(ch) + "=", Operator: operator, Position: pos}
+		}
+		s.Unscan()
+		return Token{TokenType: MULOP, Lexeme: string(ch), Operator: operator, Position: pos}
 
 	case ';':
 		return Token{TokenType: SEMICOLON, Lexeme: string(ch), Position: pos}
@@ -291,6 +502,12 @@ func (s *Scanner) Scan() Token {
 	case '{':
 		return Token{TokenType: LBRACKET, Lexeme: string(ch), Position: pos}
 
+	case '[':
+		return Token{TokenType: LSQUARE, Lexeme: string(ch), Position: pos}
+
+	case ']':
+		return Token{TokenType: RSQUARE, Lexeme: string(ch), Position: pos}
+
 	case '}':
 		return Token{TokenType: RBRACKET, Lexeme: string(ch), Position: pos}
 
@@ -299,11 +516,46 @@ func (s *Scanner) Scan() Token {
 
 	case ':':
 		return Token{TokenType: COLON, Lexeme: string(ch), Position: pos}
+
+	case '?':
+		return Token{TokenType: QUESTION, Lexeme: string(ch), Position: pos}
+
+	case '.':
+		ch2, _ := s.read()
+		if ch2 == '.' {
+			return Token{TokenType: DOTDOT, Lexeme: "..", Position: pos}
+		}
+		s.Unscan()
+		if digit(ch2) {
+			s.Unscan()
+			return s.findNum()
+		}
+		return Token{TokenType: DOT, Lexeme: string(ch), Position: pos}
+
+	case '"':
+		s.Unscan()
+		return s.findQuoted(STRING)
+
+	case '\'':
+		s.Unscan()
+		return s.findQuoted(CHAR)
 	}
 
 	return Token{TokenType: ILLEGAL, Lexeme: string(ch), Position: pos}
 }
 
+//skips the rest of a // comment, up to the end of the line
+func (s *Scanner) skipLine() {
+	for {
+		if ch, _ := s.read(); ch == '\n' {
+			return
+		} else if ch == eof {
+			s.Unscan()
+			return
+		}
+	}
+}
+
 func (s *Scanner) findspace() {
 	for {
 		if ch, _ := s.read(); ch == eof {
@@ -315,6 +567,34 @@ func (s *Scanner) findspace() {
 	}
 }
 
+//reads a string or character literal; the lexeme keeps the quotes and escape sequences
+func (s *Scanner) findQuoted(tokenType TokenType) Token {
+	ch, pos := s.read()
+	quote := ch
+
+	var buf bytes.Buffer
+	buf.WriteRune(ch)
+	for {
+		ch, _ = s.read()
+		if ch == eof || ch == '\n' {
+			// unterminated, a literal cannot span lines
+			s.Unscan()
+			return Token{TokenType: ILLEGAL, Lexeme: buf.String(), Position: pos}
+		}
+		buf.WriteRune(ch)
+		if ch == quote {
+			return Token{TokenType: tokenType, Lexeme: buf.String(), Position: pos}
+		}
+		if ch == '\\' {
+			if ch, _ = s.read(); ch == eof || ch == '\n' {
+				s.Unscan()
+				return Token{TokenType: ILLEGAL, Lexeme: buf.String(), Position: pos}
+			}
+			buf.WriteRune(ch)
+		}
+	}
+}
+
 func (s *Scanner) findIdentifier() Token {
 	ch, pos := s.read()
 
@@ -325,56 +605,94 @@ func (s *Scanner) findIdentifier() Token {
 	for {
 		if ch, _ = s.read(); ch == eof {
 			break
-		} else if !letter(ch) && digit(ch) && ch != '_' {
+		} else if !unicode.IsLetter(ch) && !digit(ch) && ch != '_' {
 			s.Unscan()
 			break
 		} else {
 			_, _ = buf.WriteRune(ch)
 		}
 	}
-	switch buf.String() {
-	case "break":
-		return Token{TokenType: BREAK, Lexeme: buf.String(), Position: pos}
-	case "case":
-		return Token{TokenType: CASE, Lexeme: buf.String(), Position: pos}
-	case "default":
-		return Token{TokenType: DEFAULT, Lexeme: buf.String(), Position: pos}
-	case "else":
-		return Token{TokenType: ELSE, Lexeme: buf.String(), Position: pos}
-	case "float":
-		return Token{TokenType: FLOAT, Lexeme: buf.String(), Position: pos}
-	case "if":
-		return Token{TokenType: IF, Lexeme: buf.String(), Position: pos}
-	case "input":
-		return Token{TokenType: INPUT, Lexeme: buf.String(), Position: pos}
-	case "int":
-		return Token{TokenType: INT, Lexeme: buf.String(), Position: pos}
-	case "output":
-		return Token{TokenType: OUTPUT, Lexeme: buf.String(), Position: pos}
-	case "switch":
-		return Token{TokenType: SWITCH, Lexeme: buf.String(), Position: pos}
-	case "while":
-		return Token{TokenType: WHILE, Lexeme: buf.String(), Position: pos}
-	case "static_cast":
-		return Token{TokenType: STATICCAST, Lexeme: buf.String(), Position: pos}
-	}
-	if len(buf.String()) <= MaxIdentifierLength && !strings.ContainsRune(buf.String(), '_') {
-		return Token{TokenType: ID, Lexeme: buf.String(), Position: pos}
+	if tokType, ok := keywords[string(buf.Bytes())]; ok {
+		return Token{TokenType: tokType, Lexeme: tokens[tokType], Position: pos}
+	}
+	if !s.UnicodeIdentifiers && utf8.RuneCount(buf.Bytes()) != buf.Len() {
+		return Token{TokenType: ILLEGAL, Lexeme: buf.String(), Position: pos}
+	}
+	if utf8.RuneCount(buf.Bytes()) <= MaxIdentifierLength && !bytes.ContainsRune(buf.Bytes(), '_') {
+		return Token{TokenType: ID, Lexeme: s.intern(buf.Bytes()), Position: pos}
 	}
 	return Token{TokenType: ILLEGAL, Lexeme: buf.String(), Position: pos}
 }
 
+//returns the shared string for an identifier, so repeated names use one allocation
+func (s *Scanner) intern(name []byte) string {
+	if lexeme, ok := s.identifiers[string(name)]; ok {
+		return lexeme
+	}
+	if s.identifiers == nil {
+		s.identifiers = map[string]string{}
+	}
+	lexeme := string(name)
+	s.identifiers[lexeme] = lexeme
+	return lexeme
+}
+
+//reads a number: digits with an optional fraction, 5. or 2.5, or only a fraction, .5, and an
+//optional exponent, 1e5 or 2.5E-3. A number followed by more of a number, 1.2.3, 12abc or
+//1e, is malformed: its lexeme takes all of it and its token is ILLEGAL
 func (s *Scanner) findNum() Token {
 	var buf bytes.Buffer
-	ch, pos := s.read()
-
+	pos := s.nextPosition()
+	valid := s.digits(&buf) > 0
+	if ch, _ := s.read(); ch == '.' && !s.dotdot() {
+		_, _ = buf.WriteRune(ch)
+		valid = s.digits(&buf) > 0 || valid
+	} else {
+		s.Unscan()
+	}
+	if ch, _ := s.read(); ch == 'e' || ch == 'E' {
+		_, _ = buf.WriteRune(ch)
+		if sign, _ := s.read(); sign == '+' || sign == '-' {
+			_, _ = buf.WriteRune(sign)
+		} else {
+			s.Unscan()
+		}
+		valid = s.digits(&buf) > 0 && valid
+	} else {
+		s.Unscan()
+	}
 	for {
-		if !digit(ch) && ch != '.' {
+		ch, _ := s.read()
+		if !letter(ch) && !digit(ch) && ch != '_' && (ch != '.' || s.dotdot()) {
 			s.Unscan()
 			break
 		}
+		valid = false
 		_, _ = buf.WriteRune(ch)
-		ch, _ = s.read()
+	}
+	if !valid {
+		return Token{TokenType: ILLEGAL, Lexeme: buf.String(), Position: pos}
 	}
 	return Token{TokenType: NUM, Lexeme: buf.String(), Position: pos}
 }
+
+//reads digits into buf and returns how many
+func (s *Scanner) digits(buf *bytes.Buffer) int {
+	count := 0
+	for {
+		ch, _ := s.read()
+		if !digit(ch) {
+			s.Unscan()
+			return count
+		}
+		_, _ = buf.WriteRune(ch)
+		count++
+	}
+}
+
+//reports whether the . just read starts a .., as in 1..10, which is a range, not a number
+func (s *Scanner) dotdot() bool {
+	ch, _ := s.read()
+	s.Unscan()
+	return ch == '.'
+}
@@ -0,0 +1,80 @@
+package cpq
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+//returns the tokens of src as "TYPE lexeme"
+func scanAll(src string) []string {
+	result := []string{}
+	scanner := NewScanner(strings.NewReader(src))
+	for token := scanner.Scan(); token.TokenType != EOF; token = scanner.Scan() {
+		result = append(result, fmt.Sprintf("%s %s", tokens[token.TokenType], token.Lexeme))
+	}
+	return result
+}
+
+//an identifier goes on over letters and digits and ends at anything else
+func TestScanIdentifiers(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"a1 b", []string{"ID a1", "ID b"}},
+		{"x2y3=z", []string{"ID x2y3", "= =", "ID z"}},
+		{"n9;", []string{"ID n9", "; ;"}},
+		{"while(i)", []string{"while while", "( (", "ID i", ") )"}},
+	}
+	for _, test := range tests {
+		if got := scanAll(test.src); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("scan %q = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+//a // comment ends at the end of its line or of the source, and the tokens before it on
+//its line are kept
+func TestScanLineComments(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []string
+	}{
+		{"a = 1; // no newline after", []string{"ID a", "= =", "NUM 1", "; ;"}},
+		{"a = 1; //", []string{"ID a", "= =", "NUM 1", "; ;"}},
+		{"//", []string{}},
+		{"a = b // half an expression\n + 2;", []string{"ID a", "= =", "ID b", "ADDOP +", "NUM 2", "; ;"}},
+		{"x = y / 2; // not a division\n", []string{"ID x", "= =", "ID y", "MULOP /", "NUM 2", "; ;"}},
+	}
+	for _, test := range tests {
+		if got := scanAll(test.src); fmt.Sprint(got) != fmt.Sprint(test.want) {
+			t.Errorf("scan %q = %q, want %q", test.src, got, test.want)
+		}
+	}
+}
+
+//the parser takes the tokens around a // comment, and reports every one in standard CPL
+func TestParseLineComments(t *testing.T) {
+	tests := []struct {
+		src      string
+		comments int
+	}{
+		{"a : int;\n{ a = 1 // the value\n + 2; output(a); } // end", 2},
+		{"a : int; { a = 1; } //", 1},
+	}
+	for _, test := range tests {
+		if _, errors := Parse(test.src); len(errors) > 0 {
+			t.Errorf("%q: %v", test.src, errors)
+		}
+		_, errors := ParseWithOptions(test.src, Options{Std: StdCPL})
+		if len(errors) != test.comments {
+			t.Errorf("%q in standard CPL: %v, want %d errors", test.src, errors, test.comments)
+		}
+		for _, e := range errors {
+			if e.Text() != "a // comment is not part of standard CPL" {
+				t.Errorf("%q in standard CPL: %v", test.src, e)
+			}
+		}
+	}
+}
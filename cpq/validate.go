@@ -0,0 +1,26 @@
+package cpq
+
+import "strings"
+
+//a problem found in CPL source, as reported to editors
+type Diagnostic struct {
+	Message string
+	Pos     Position
+	End     Position // just after the offending token
+}
+
+// Validate checks the syntax of src by running only the scanner and the parser
+// with its error recovery. No code is generated, so it is cheap enough to run
+// on every keystroke.
+func Validate(src string) []Diagnostic {
+	parser := NewParser(NewScanner(strings.NewReader(src)))
+	parser.ParseProgram()
+	if len(parser.Errors) == 0 {
+		return nil
+	}
+	diagnostics := make([]Diagnostic, len(parser.Errors))
+	for i := range parser.Errors {
+		diagnostics[i] = Diagnostic{Message: parser.Errors[i].Text(), Pos: parser.Errors[i].Pos, End: parser.Errors[i].End}
+	}
+	return diagnostics
+}
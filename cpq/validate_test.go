@@ -0,0 +1,51 @@
+package cpq
+
+import "testing"
+
+//Validate reports the syntax errors, every one after the recovery of the parser, and
+//none of the semantic ones
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		src  string
+		want []Diagnostic
+	}{
+		{"a : int;\n{ a = 1; }\n", nil},
+		{"a : int;\n{ b = 1; a = 1.5; }\n", nil},
+		{"a : int;\n{ a = 1 }\n", []Diagnostic{
+			{"found }, expected ;", Position{Line: 1, Column: 8, Offset: 17}, Position{Line: 1, Column: 9, Offset: 18}},
+		}},
+		{"a : int;\n{ if (a > ) output(1); a = 2 +; }\n", []Diagnostic{
+			{"found ), expected (, ID, NUM, CHAR, STRING, true, false, static_cast",
+				Position{Line: 1, Column: 10, Offset: 19}, Position{Line: 1, Column: 11, Offset: 20}},
+			{"found ;, expected (, ID, NUM, CHAR, STRING, true, false, static_cast",
+				Position{Line: 1, Column: 30, Offset: 39}, Position{Line: 1, Column: 31, Offset: 40}},
+		}},
+	}
+	for _, test := range tests {
+		got := Validate(test.src)
+		if len(got) != len(test.want) {
+			t.Errorf("%q: diagnostics = %+v, want %+v", test.src, got, test.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.want[i] {
+				t.Errorf("%q: diagnostic %d = %+v, want %+v", test.src, i, got[i], test.want[i])
+			}
+		}
+	}
+}
+
+//the diagnostics of Validate are the syntax errors of Compile
+func TestValidateLikeCompile(t *testing.T) {
+	src := "a : int;\nfunc f( : int { return 1; }\n{ a = (1 + ; output(a) }\n"
+	result, _ := Compile(src, Options{})
+	diagnostics := Validate(src)
+	if len(diagnostics) == 0 || len(diagnostics) != len(result.Errors) {
+		t.Fatalf("Validate = %+v, Compile errors = %v", diagnostics, result.Errors)
+	}
+	for i, e := range result.Errors {
+		if diagnostics[i].Message != e.Text() || diagnostics[i].Pos != e.Pos {
+			t.Errorf("diagnostic %d = %+v, Compile error %v", i, diagnostics[i], e)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package cpq
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+//a CPL runtime value
+type value struct {
+	Type  DataType
+	Int   int64
+	Float float64
+}
+
+func (v value) float() float64 {
+	if v.Type == Float {
+		return v.Float
+	}
+	return float64(v.Int)
+}
+
+//converts a value the way ITOR and RTOI do
+func (v value) cast(t DataType) value {
+	if t == Float {
+		return value{Type: Float, Float: v.float()}
+	}
+	if v.Type == Float {
+		return value{Type: Integer, Int: int64(v.Float)}
+	}
+	return v
+}
+
+//applies an arithmetic operator, promoting to float like the code generator
+func arithmetic(operator Operator, lhs, rhs value) (value, error) {
+	if calculateExpressionType(lhs.Type, rhs.Type) == Float {
+		a, b := lhs.float(), rhs.float()
+		switch operator {
+		case Add:
+			return value{Type: Float, Float: a + b}, nil
+		case Subtract:
+			return value{Type: Float, Float: a - b}, nil
+		case Multiply:
+			return value{Type: Float, Float: a * b}, nil
+		}
+		return value{Type: Float, Float: a / b}, nil
+	}
+	a, b := lhs.Int, rhs.Int
+	switch operator {
+	case Add:
+		return value{Type: Integer, Int: a + b}, nil
+	case Subtract:
+		return value{Type: Integer, Int: a - b}, nil
+	case Multiply:
+		return value{Type: Integer, Int: a * b}, nil
+	}
+	if b == 0 {
+		return value{}, fmt.Errorf("division by zero")
+	}
+	if operator == Modulo {
+		return value{Type: Integer, Int: a % b}, nil
+	}
+	return value{Type: Integer, Int: a / b}, nil
+}
+
+//compares two values, floats for equality within epsilon when it is not 0
+func compare(operator Operator, lhs, rhs value, epsilon float64) bool {
+	if calculateExpressionType(lhs.Type, rhs.Type) == Integer {
+		a, b := lhs.Int, rhs.Int
+		switch operator {
+		case EqualTo:
+			return a == b
+		case NotEqualTo:
+			return a != b
+		case GreaterThan:
+			return a > b
+		case LessThan:
+			return a < b
+		case GreaterThanOrEqualTo:
+			return a >= b
+		}
+		return a <= b
+	}
+	a, b := lhs.float(), rhs.float()
+	equal := a == b
+	if epsilon > 0 {
+		equal = math.Abs(a-b) < epsilon
+	}
+	switch operator {
+	case EqualTo:
+		return equal
+	case NotEqualTo:
+		return !equal
+	case GreaterThan:
+		return a > b
+	case LessThan:
+		return a < b
+	case GreaterThanOrEqualTo:
+		return equal || a > b
+	}
+	return equal || a < b
+}
+
+//parses an input value of the type of the variable it is read into
+func parseValue(text string, t DataType) (value, error) {
+	if t == Float {
+		f, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return value{}, fmt.Errorf("%q is not a number", text)
+		}
+		return value{Type: Float, Float: f}, nil
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return value{}, fmt.Errorf("%q is not an int", text)
+	}
+	return value{Type: Integer, Int: n}, nil
+}
@@ -0,0 +1,98 @@
+package cpq
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+//a kind of warning, named by --warn
+type WarningKind string
+
+const (
+	WarnPromotion     WarningKind = "promotion"     // an int operand of float arithmetic is converted implicitly
+	WarnTruncation    WarningKind = "truncation"    // static_cast(int) of a float literal drops its fraction
+	WarnFloatEqual    WarningKind = "float-equal"   // floats compared for exact equality
+	WarnEnum          WarningKind = "enum"          // enum values mixed with other values
+	WarnUnreachable   WarningKind = "unreachable"   // code or functions that never run
+	WarnUnused        WarningKind = "unused"        // variables never read, and assigned values never read
+	WarnUninitialized WarningKind = "uninitialized" // variables that may be read before they are assigned
+)
+
+//every kind of warning, for --warn
+var warningKinds = []WarningKind{WarnPromotion, WarnTruncation, WarnFloatEqual, WarnEnum, WarnUnreachable, WarnUnused, WarnUninitialized}
+
+//how a kind of warning is reported
+type Severity int
+
+const (
+	SeverityWarning Severity = iota // reported with the warnings, the default
+	SeverityIgnore                  // not reported
+	SeverityError                   // reported as an error, so no output is written
+)
+
+//returns the severity named in --warn
+func parseSeverity(name string) (Severity, error) {
+	switch name {
+	case "warning":
+		return SeverityWarning, nil
+	case "ignore":
+		return SeverityIgnore, nil
+	case "error":
+		return SeverityError, nil
+	}
+	return SeverityWarning, fmt.Errorf("unknown severity %q, expected warning, ignore or error", name)
+}
+
+// ParseWarnings reads the severities of --warn, a comma-separated list of KIND=SEVERITY
+// such as "promotion=ignore,truncation=error".
+func ParseWarnings(text string) (map[WarningKind]Severity, error) {
+	severities := map[WarningKind]Severity{}
+	if text == "" {
+		return severities, nil
+	}
+	known := map[WarningKind]bool{}
+	names := make([]string, len(warningKinds))
+	for n, kind := range warningKinds {
+		known[kind] = true
+		names[n] = string(kind)
+	}
+	sort.Strings(names)
+	for _, entry := range strings.Split(text, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("expected KIND=SEVERITY, found %q", entry)
+		}
+		kind := WarningKind(parts[0])
+		if !known[kind] {
+			return nil, fmt.Errorf("unknown warning %q, expected one of %s", parts[0], strings.Join(names, ", "))
+		}
+		severity, err := parseSeverity(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		severities[kind] = severity
+	}
+	return severities, nil
+}
+
+//reports a warning with the severity of its kind, once per message and position
+func (c *CodeGen) warn(kind WarningKind, e ErrorType) {
+	severity := c.Severities[kind]
+	if c.Werror && severity == SeverityWarning {
+		severity = SeverityError
+	}
+	switch severity {
+	case SeverityIgnore:
+		return
+	case SeverityError:
+		c.addError(e)
+		return
+	}
+	key := reportedError{message: e.Text(), pos: e.Pos}
+	if c.reported[key] {
+		return
+	}
+	c.reported[key] = true
+	c.Warnings = append(c.Warnings, e)
+}
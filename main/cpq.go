@@ -1,45 +1,415 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path"
+	"path/filepath"
+	"strings"
 
 	"github.com/nof-sh/CPL-to-QUAD-compiler/cpq"
 )
 
+var (
+	encoding   = flag.String("encoding", cpq.EncodingAuto, "input file encoding: auto, utf-8, utf-16le, utf-16be or latin-1")
+	stream     = flag.Bool("stream", false, "compile statement by statement without loading the whole program (UTF-8 input only)")
+	cpuprofile = flag.String("cpuprofile", "", "write a CPU profile of the compilation to `file`")
+	memprofile = flag.String("memprofile", "", "write a heap profile after the compilation to `file`")
+	traceFile  = flag.String("trace", "", "write an execution trace of the compilation to `file`")
+	maxSource  = flag.Int("max-source-size", cpq.DefaultLimits.MaxSourceSize, "maximum size of the input in bytes, 0 for no limit")
+	maxTokens  = flag.Int("max-tokens", cpq.DefaultLimits.MaxTokens, "maximum number of tokens in the input, 0 for no limit")
+	maxNodes   = flag.Int("max-nodes", cpq.DefaultLimits.MaxNodes, "maximum number of syntax tree nodes, 0 for no limit")
+	std        = flag.String("std", "extended", "language standard: cpl (exact course grammar) or extended (all added features)")
+	profile    = flag.String("profile", "unlimited", "limits of the target QUAD interpreter: unlimited, course or small")
+	newline    = flag.String("newline", "lf", "line terminator of the output: lf or crlf")
+	trailingNL = flag.Bool("trailing-newline", false, "end the output file with a line terminator")
+	blankLine  = flag.Bool("blank-before-signature", true, "put an empty line between HALT and the signature")
+	metadata   = flag.Bool("metadata", false, "append the compiler version, source name and hash and the options used to the output")
+	outExt     = flag.String("out-ext", ".qud", "extension of the output file, e.g. .quad or .txt")
+	epsilon    = flag.Float64("float-epsilon", 0, "compare floats with == and != within this distance instead of exactly")
+	inputRange = flag.String("input-range", "retry", "what input(x in a..b) does with out of range values: retry or halt")
+	switchMode = flag.String("switch", "fallthrough", "what the end of a switch case does: fallthrough into the next case, or break")
+	switchFind = flag.Bool("switch-search", false, "find the case of a switch with a binary search of the case values instead of testing them in order")
+	stringOp   = flag.String("string-opcode", "", "opcode of the target interpreter that prints a quoted string; by default output(\"...\") prints character codes with IPRT")
+	maxTemps   = flag.Int("max-temps", 0, "most temporary names the output may use, 0 for no limit")
+	temps      = flag.String("temps", "error", "when --max-temps is exceeded: error, or spill (keep the values of the other temporaries in variables)")
+	lineNums   = flag.Bool("line-numbers", false, "prefix every instruction with its line number")
+	opcodeFile = flag.String("opcodes", "", "`file` mapping opcodes to the spelling of an alternate interpreter, one \"JUMP JMP\" per line")
+	lowerOps   = flag.Bool("lowercase-opcodes", false, "write opcodes in lower case")
+	keepLabels = flag.Bool("keep-labels", false, "emit symbolic labels (L1: and JUMP L1) instead of line numbers")
+	emitLabels = flag.Bool("emit-labeled", false, "also write the program with symbolic labels to NAME.lbl.qud")
+	srcComment = flag.Bool("source-comments", false, "precede the instructions of every statement with a # comment giving its source line (the output is for reading, not for running)")
+	sourceMap  = flag.Bool("source-map", false, "also write NAME.qud.map, JSON mapping every line of the output to its source line and column")
+	warnKinds  = flag.String("warn", "", "severity of kinds of warnings, e.g. promotion=ignore,truncation=error (kinds: promotion, truncation, float-equal, enum, unreachable)")
+	werror     = flag.Bool("Werror", false, "report every warning as an error")
+	maxErrors  = flag.Int("max-errors", cpq.DefaultMaxErrors, "stop the compilation after this many errors, 0 for no limit")
+	tabWidth   = flag.Int("tab-width", 0, "columns of a tab in errors and warnings: their column is the one on screen and the source line is printed with its tabs expanded; 0 counts a tab as one column")
+	noColor    = flag.Bool("no-color", false, "print errors and warnings without ANSI colors (they are colored only on a terminal)")
+	showStats  = flag.Bool("stats", false, "print the time and allocations of every compiler phase")
+	dumpAST    = flag.Bool("dump-ast", false, "print the syntax tree as JSON to stdout, with the types found by the analysis")
+	dumpCFG    = flag.Bool("dump-cfg", false, "print the control flow graph of the generated code as Graphviz DOT to stdout")
+	unicodeIDs = flag.Bool("unicode-identifiers", false, "accept identifiers with letters that are not ASCII, like é or π (not with --std=cpl)")
+)
+
 //****************************  Main  ********************************//
 func main() {
 
 	fmt.Fprintln(os.Stderr, "CPL to Quad compiler by Nof Shabtay.")
-	if len(os.Args) != 2 {
+	if len(os.Args) > 1 && os.Args[1] == "fmt" {
+		formatFiles(os.Args[2:])
+		return
+	}
+	flag.Parse()
+	stopProfiling, err := startProfiling()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot start profiling: %s\n", err)
+		return
+	}
+	compile()
+	if err := stopProfiling(); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write profile: %s\n", err)
+	}
+}
+
+//compiles the input file named on the command line
+func compile() {
+	if flag.NArg() != 1 {
 		fmt.Fprintln(os.Stderr, "No input file found for compilation, Please run this program with an input file with '.ou' extension")
 		return
 	}
-	if path.Ext(os.Args[1]) != ".ou" {
+	if path.Ext(flag.Arg(0)) != ".ou" {
 		fmt.Fprintln(os.Stderr, "Input file extension must be .ou")
 		return
 	}
+	infile := flag.Arg(0)
+	standard, err := cpq.ParseStandard(*std)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	if *inputRange != "retry" && *inputRange != "halt" {
+		fmt.Fprintln(os.Stderr, "--input-range must be retry or halt")
+		return
+	}
+	if *switchMode != "fallthrough" && *switchMode != "break" {
+		fmt.Fprintln(os.Stderr, "--switch must be fallthrough or break")
+		return
+	}
+	if *temps != "error" && *temps != "spill" {
+		fmt.Fprintln(os.Stderr, "--temps must be error or spill")
+		return
+	}
+	severities, err := cpq.ParseWarnings(*warnKinds)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "--warn: %s\n", err)
+		return
+	}
+	tempPolicy := cpq.TempsError
+	if *temps == "spill" {
+		tempPolicy = cpq.TempsSpill
+	}
+	if *newline != "lf" && *newline != "crlf" {
+		fmt.Fprintln(os.Stderr, "--newline must be lf or crlf")
+		return
+	}
+	format := cpq.OutputFormat{
+		CRLF:                 *newline == "crlf",
+		TrailingNewline:      *trailingNL,
+		BlankBeforeSignature: *blankLine,
+	}
+	var opcodes map[string]string
+	if *opcodeFile != "" {
+		text, err := ioutil.ReadFile(*opcodeFile)
+		if err == nil {
+			opcodes, err = cpq.ParseOpcodeTable(string(text))
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot read opcode table: %s\n", err)
+			return
+		}
+	}
+	if *lowerOps {
+		opcodes = cpq.LowercaseOpcodes(opcodes)
+	}
+	target, err := cpq.LookupProfile(*profile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return
+	}
+	opts := cpq.Options{
+		Limits:       cpq.Limits{MaxSourceSize: *maxSource, MaxTokens: *maxTokens, MaxNodes: *maxNodes},
+		Std:          standard,
+		FloatEpsilon: *epsilon,
+
+		UnicodeIdentifiers: *unicodeIDs,
+
+		HaltOnBadInput: *inputRange == "halt",
+		SwitchBreak:    *switchMode == "break",
+		SwitchSearch:   *switchFind,
+		StringOpcode:   *stringOp,
+		MaxTemps:       *maxTemps,
+		TempPolicy:     tempPolicy,
+		Severities:     severities,
+		Werror:         *werror,
+		Opcodes:        opcodes,
+		Diagnostics:    cpq.NewDiagnostics(*maxErrors),
+	}
+	if *showStats {
+		opts.Stats = &cpq.Stats{}
+	}
+	if *stream {
+		compileStream(infile, opts)
+		return
+	}
 	//Read
-	infile := os.Args[1]
-	code, err := ioutil.ReadFile(infile)
+	data, err := readSource(infile, opts.Limits.MaxSourceSize)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, "Cannot open input CPL file.")
 		return
 	}
-	ast, parseErrors := cpq.Parse(string(code))
-	for _, err := range parseErrors {
-		fmt.Fprintf(os.Stderr, "ParseError: %s\n", err.Message)
+	if opts.Limits.MaxSourceSize > 0 && len(data) > opts.Limits.MaxSourceSize {
+		newReporter(infile, "").report("ParseError", cpq.ErrorType{
+			Code:    cpq.CodeInputTooLarge,
+			Message: fmt.Sprintf("input too large: more than %d bytes", opts.Limits.MaxSourceSize),
+		})
+		return
+	}
+	//the limit is on the bytes of the file, not on the decoded source, which is larger
+	//for latin-1
+	opts.Limits.MaxSourceSize = 0
+	code, err := cpq.Decode(data, *encoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot decode input CPL file: %s\n", err)
+		return
+	}
+	if opts.Stats != nil {
+		defer func() { fmt.Fprint(os.Stderr, opts.Stats.String()) }()
+	}
+	ast, parseErrors := cpq.ParseWithOptions(code, opts)
+	report := newReporter(infile, code)
+	for _, err := range cpq.SortErrors(parseErrors) {
+		report.report("ParseError", err)
+	}
+	instructions, codegenErrors, warnings := cpq.CodegenInstructions(ast, opts)
+	cpq.SetErrorEnds(code, codegenErrors)
+	cpq.SetErrorEnds(code, warnings)
+	for _, err := range cpq.SortErrors(codegenErrors) {
+		report.report("CodegenError", err)
+	}
+	if *dumpAST {
+		if tree, err := cpq.MarshalAST(ast); err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write the syntax tree: %s\n", err)
+		} else {
+			fmt.Println(string(tree))
+		}
+	}
+	if *dumpCFG && len(parseErrors) == 0 && len(codegenErrors) == 0 {
+		fmt.Print(cpq.CFGDot(instructions))
+	}
+	if opts.Diagnostics.Full() {
+		fmt.Fprintf(os.Stderr, "Error: too many errors, stopped after %d\n", *maxErrors)
 	}
-	output, codegenErrors := cpq.Codegen(ast)
-	for _, err := range codegenErrors {
-		fmt.Fprintf(os.Stderr, "CodegenError: %s\n", err.Message)
+	for _, warning := range warnings {
+		report.report("Warning", warning)
 	}
 	// output QUAD
 	if len(parseErrors) == 0 && len(codegenErrors) == 0 {
-		// Write file
-		outfile := infile[0:len(infile)-3] + ".qud"
-		ioutil.WriteFile(outfile, []byte(cpq.RemoveLabels(output)+"\n"+"CPL to Quad compiler by Nof Shabtay."), 0644)
+		opts.Stats.Measure("emit", func() {
+			resolved, err := cpq.ResolveLabels(instructions)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "CodegenError: %s\n", err)
+				return
+			}
+			//the profile lists the standard opcodes, so it checks the program before --opcodes
+			standard := cpq.FormatInstructions(resolved, nil)
+			if *keepLabels {
+				standard = cpq.SymbolicLabels(cpq.FormatInstructions(instructions, nil))
+			}
+			profileErrors := cpq.CheckProfile(standard, target)
+			for _, err := range profileErrors {
+				fmt.Fprintf(os.Stderr, "ProfileError: %s\n", describe(err))
+			}
+			if len(profileErrors) > 0 {
+				return
+			}
+			output := cpq.FormatInstructions(instructions, opts.Opcodes)
+			quad := cpq.FormatInstructions(resolved, opts.Opcodes)
+			if *keepLabels {
+				quad = cpq.SymbolicLabels(output)
+			}
+			if *srcComment {
+				output = cpq.FormatWithSource(instructions, code, opts.Opcodes)
+				quad = cpq.FormatWithSource(resolved, code, opts.Opcodes)
+				if *keepLabels {
+					quad = cpq.SymbolicLabels(output)
+				}
+			}
+			trailer := []string{"CPL to Quad compiler by Nof Shabtay."}
+			if *metadata {
+				trailer = append(trailer, cpq.NewMetadata(filepath.Base(infile), data, usedOptions()).Lines()...)
+			}
+			// Write file
+			writeQuad(outputName(infile, ""), quad, format, trailer)
+			if *emitLabels {
+				writeQuad(outputName(infile, ".lbl"), cpq.SymbolicLabels(output), format, trailer)
+			}
+			if *sourceMap {
+				writeSourceMap(outputName(infile, "")+".map", cpq.NewSourceMap(filepath.Base(infile), resolved))
+			}
+		})
+	}
+}
+
+//returns the text of an error preceded by its code
+func describe(e cpq.ErrorType) string {
+	if e.Code == "" {
+		return e.Text()
+	}
+	return "[" + e.Code + "] " + e.Text()
+}
+
+//returns the position of an error as ErrorType.Error writes it
+func positionOf(e cpq.ErrorType) string {
+	return fmt.Sprintf(" at line %d, char %d", e.Pos.Line+1, e.Pos.Column+1)
+}
+
+//writes one output file
+func writeQuad(outfile, quad string, format cpq.OutputFormat, trailer []string) {
+	if *lineNums {
+		quad = cpq.NumberLines(quad)
+	}
+	if err := ioutil.WriteFile(outfile, []byte(cpq.FormatOutput(quad, format, trailer...)), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write output QUAD file: %s\n", err)
+	}
+}
+
+//writes the source map of the output
+func writeSourceMap(mapfile string, m cpq.SourceMap) {
+	data, err := m.JSON()
+	if err == nil {
+		err = ioutil.WriteFile(mapfile, append(data, '\n'), 0644)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write source map file: %s\n", err)
+	}
+}
+
+//returns the output file name: the input path with its extension replaced by
+//the variant (such as ".lbl") and --out-ext
+func outputName(infile, variant string) string {
+	ext := *outExt
+	if ext != "" && !strings.HasPrefix(ext, ".") {
+		ext = "." + ext
+	}
+	return strings.TrimSuffix(infile, filepath.Ext(infile)) + variant + ext
+}
+
+//options that do not change the generated program, left out of the metadata so that
+//the same source and options give byte-identical output on every machine
+var diagnosticOptions = map[string]bool{
+	"cpuprofile": true,
+	"memprofile": true,
+	"trace":      true,
+	"stats":      true,
+	"dump-ast":   true,
+	"dump-cfg":   true,
+	"no-color":   true,
+}
+
+//returns the options given on the command line that affect the output, sorted by name
+func usedOptions() []string {
+	options := []string{}
+	flag.Visit(func(f *flag.Flag) {
+		if !diagnosticOptions[f.Name] {
+			options = append(options, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return options
+}
+
+//options the stream compilation cannot honor, as it neither holds the whole output nor
+//optimizes it
+var streamUnsupported = map[string]bool{
+	"profile":                true,
+	"newline":                true,
+	"trailing-newline":       true,
+	"blank-before-signature": true,
+	"metadata":               true,
+	"max-temps":              true,
+	"temps":                  true,
+	"line-numbers":           true,
+	"keep-labels":            true,
+	"emit-labeled":           true,
+	"source-comments":        true,
+	"source-map":             true,
+	"tab-width":              true,
+	"stats":                  true,
+	"dump-ast":               true,
+	"dump-cfg":               true,
+}
+
+//compiles huge inputs with bounded memory
+func compileStream(infile string, opts cpq.Options) {
+	if *encoding != cpq.EncodingAuto && *encoding != cpq.EncodingUTF8 {
+		fmt.Fprintln(os.Stderr, "Stream compilation only supports UTF-8 input.")
+		return
+	}
+	unsupported := []string{}
+	flag.Visit(func(f *flag.Flag) {
+		if streamUnsupported[f.Name] {
+			unsupported = append(unsupported, "--"+f.Name)
+		}
+	})
+	if len(unsupported) > 0 {
+		fmt.Fprintf(os.Stderr, "--stream cannot be used with %s\n", strings.Join(unsupported, ", "))
+		return
+	}
+	in, err := os.Open(infile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot open input CPL file.")
+		return
+	}
+	defer in.Close()
+	outfile := outputName(infile, "")
+	out, err := os.Create(outfile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Cannot create output QUAD file.")
+		return
+	}
+	errors, warnings := cpq.CompileStream(in, out, opts)
+	for _, err := range errors {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", describe(err)+positionOf(err))
+	}
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", describe(warning)+positionOf(warning))
+	}
+	if len(errors) == 0 {
+		_, err = out.WriteString("\n" + "CPL to Quad compiler by Nof Shabtay.")
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if len(errors) > 0 || err != nil {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Cannot write output QUAD file: %s\n", err)
+		}
+		os.Remove(outfile)
+	}
+}
+
+//reads the input file, but no more than one byte past limit bytes, so a file larger than
+//the limit is not read whole; 0 is no limit
+func readSource(file string, limit int) ([]byte, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if limit <= 0 {
+		return io.ReadAll(f)
 	}
+	return io.ReadAll(io.LimitReader(f, int64(limit)+1))
 }
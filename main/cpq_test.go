@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+//the test binary runs the compiler instead of the tests when this variable is set, so the
+//tests can run it with command line flags like the cpq command
+const runCompiler = "CPQ_TEST_RUN_COMPILER"
+
+func TestMain(m *testing.M) {
+	if os.Getenv(runCompiler) != "" {
+		os.Args = append(os.Args[:1], strings.Fields(os.Getenv(runCompiler))...)
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+//writes src to prog.ou in a temporary directory, runs the compiler on it with the flags,
+//and returns what it printed to stderr and the output file, empty when it wrote none
+func runCPQ(t *testing.T, src string, flags ...string) (string, string) {
+	t.Helper()
+	dir := t.TempDir()
+	infile := filepath.Join(dir, "prog.ou")
+	if err := os.WriteFile(infile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0])
+	cmd.Env = append(os.Environ(), runCompiler+"="+strings.Join(append(flags, infile), " "))
+	stderr, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("%s: %s", err, stderr)
+	}
+	quad, _ := os.ReadFile(filepath.Join(dir, "prog.qud"))
+	return string(stderr), string(quad)
+}
+
+//the course profile allows the standard opcodes; it accepts a program written with
+//other spellings of them
+func TestProfileWithOpcodes(t *testing.T) {
+	src := "a : int;\n{ input(a); while (a < 10) a = a + 1; output(a); }\n"
+	table := filepath.Join(t.TempDir(), "opcodes.txt")
+	if err := os.WriteFile(table, []byte("JUMP JMP\nIPRT PRINT\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		flags []string
+		want  []string
+	}{
+		{[]string{"--profile=course", "--lowercase-opcodes"}, []string{"iinp a", "jump ", "iprt a", "halt"}},
+		{[]string{"--profile=course", "--opcodes=" + table}, []string{"IINP a", "JMP ", "PRINT a", "HALT"}},
+		{[]string{"--profile=course", "--opcodes=" + table, "--keep-labels"}, []string{"JMP L1", "PRINT a"}},
+	}
+	for _, test := range tests {
+		t.Run(strings.Join(test.flags, " "), func(t *testing.T) {
+			stderr, quad := runCPQ(t, src, test.flags...)
+			if strings.Contains(stderr, "ProfileError") {
+				t.Fatalf("profile errors:\n%s", stderr)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(quad, want) {
+					t.Errorf("output has no %q:\n%s", want, quad)
+				}
+			}
+		})
+	}
+}
+
+//a program outside the profile is still rejected with other opcode spellings
+func TestProfileRejectsWithOpcodes(t *testing.T) {
+	src := "a : int;\n{ a = 5000000000; output(a); }\n"
+	stderr, quad := runCPQ(t, src, "--profile=course", "--lowercase-opcodes")
+	if !strings.Contains(stderr, "ProfileError") || quad != "" {
+		t.Errorf("stderr:\n%s\noutput:\n%s", stderr, quad)
+	}
+}
+
+//the stream compilation honors the options of the generated code and rejects the ones it
+//cannot apply
+func TestStreamOptions(t *testing.T) {
+	src := "a : int;\n{ input(a); while (a < 10) a = a + 1; output(a); }\n"
+	_, quad := runCPQ(t, src, "--stream", "--lowercase-opcodes")
+	if !strings.HasPrefix(quad, "iinp a\n") || !strings.Contains(quad, "jump ") {
+		t.Errorf("--stream --lowercase-opcodes wrote:\n%s", quad)
+	}
+	stderr, _ := runCPQ(t, "a : int;\n{ a = 1; a += 2; }\n", "--stream", "--std=cpl")
+	if !strings.Contains(stderr, "not part of standard CPL") {
+		t.Errorf("--stream --std=cpl printed:\n%s", stderr)
+	}
+	stderr, quad = runCPQ(t, src, "--stream", "--keep-labels", "--max-temps=3")
+	if !strings.Contains(stderr, "--stream cannot be used with --keep-labels, --max-temps") || quad != "" {
+		t.Errorf("stderr:\n%s\noutput:\n%s", stderr, quad)
+	}
+}
+
+func TestStreamLimits(t *testing.T) {
+	src := "a : int;\n{ input(a); while (a < 10) a = a + 1; output(a); }\n"
+	for _, limit := range []string{"--max-source-size=20", "--max-tokens=12", "--max-nodes=5"} {
+		stderr, quad := runCPQ(t, src, "--stream", limit)
+		if !strings.Contains(stderr, "[CPQ0200] input too large") || quad != "" {
+			t.Errorf("%s: stderr:\n%s\noutput:\n%s", limit, stderr, quad)
+		}
+	}
+}
+
+//the size limit is on the bytes of the file, checked before the file is read whole and
+//decoded
+func TestSourceSizeLimit(t *testing.T) {
+	src := "a : int;\n{ a = 1; output(a); }\n"
+	stderr, quad := runCPQ(t, src, "--max-source-size=20")
+	if !strings.Contains(stderr, "[CPQ0200] input too large: more than 20 bytes") || quad != "" {
+		t.Errorf("stderr:\n%s\noutput:\n%s", stderr, quad)
+	}
+	//the é of the comment is one byte in latin-1 and two once decoded
+	src = "a : int; /* \xe9\xe9\xe9\xe9 */\n{ a = 1; output(a); }\n"
+	stderr, quad = runCPQ(t, src, "--encoding=latin-1", "--max-source-size="+strconv.Itoa(len(src)))
+	if !strings.Contains(quad, "IPRT a") {
+		t.Errorf("a file of the limit: stderr:\n%s\noutput:\n%s", stderr, quad)
+	}
+}
+
+func TestStreamWarnings(t *testing.T) {
+	stderr, quad := runCPQ(t, "a : int; x : float;\n{ input(a); x = a * 1.5; output(x); }\n", "--stream")
+	if !strings.Contains(stderr, "Warning: [CPQ1001]") || quad == "" {
+		t.Errorf("stderr:\n%s\noutput:\n%s", stderr, quad)
+	}
+}
+
+//the output file is the same wherever the source is and however its path is written, the
+//line terminators of the source do not change the code, and --newline=crlf changes only
+//the line terminators of the output
+func TestReproducibleOutput(t *testing.T) {
+	src := "a : int; x : float;\n{ input(a); x = a / 3.0; output(x); }\n"
+	_, quad := runCPQ(t, src, "--metadata")
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "prog.ou"), []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cmd := exec.Command(os.Args[0])
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), runCompiler+"=--metadata prog.ou")
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("%s: %s", err, out)
+	}
+	relative, _ := os.ReadFile(filepath.Join(dir, "prog.qud"))
+	if quad == "" || string(relative) != quad {
+		t.Errorf("with a relative path:\n%s\nwant:\n%s", relative, quad)
+	}
+	_, lf := runCPQ(t, src)
+	_, crlfSource := runCPQ(t, strings.ReplaceAll(src, "\n", "\r\n"))
+	if lf == "" || crlfSource != lf {
+		t.Errorf("a CRLF source:\n%s\nwant:\n%s", crlfSource, lf)
+	}
+	_, crlf := runCPQ(t, src, "--newline=crlf")
+	if crlf != strings.ReplaceAll(lf, "\n", "\r\n") {
+		t.Errorf("--newline=crlf:\n%q\nwant:\n%q", crlf, lf)
+	}
+}
+
+//the metadata lists the options that change the output, sorted, and not the diagnostic ones
+func TestMetadataOptions(t *testing.T) {
+	_, quad := runCPQ(t, "a : int;\n{ a = 1; output(a); }\n", "--no-color", "--std=cpl", "--metadata", "--stats", "--keep-labels")
+	want := "# options: --keep-labels=true --metadata=true --std=cpl"
+	if !strings.HasSuffix(quad, want) || !strings.Contains(quad, "\n# source: prog.ou\n") {
+		t.Errorf("output:\n%s\nwant it to end with %s", quad, want)
+	}
+}
+
+//the compiler reports that it stopped after --max-errors errors
+func TestMaxErrors(t *testing.T) {
+	src := "x : int;\n{ x = a; x = b; x = c; }\n"
+	stderr, quad := runCPQ(t, src, "--no-color", "--max-errors=2")
+	if strings.Count(stderr, "undefined variable") != 2 || !strings.Contains(stderr, "Error: too many errors, stopped after 2\n") || quad != "" {
+		t.Errorf("--max-errors=2:\n%s", stderr)
+	}
+	if stderr, _ := runCPQ(t, src, "--no-color", "--max-errors=0"); strings.Count(stderr, "undefined variable") != 3 || strings.Contains(stderr, "too many errors") {
+		t.Errorf("--max-errors=0:\n%s", stderr)
+	}
+}
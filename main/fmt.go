@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/nof-sh/CPL-to-QUAD-compiler/cplfmt"
+	"github.com/nof-sh/CPL-to-QUAD-compiler/cpq"
+)
+
+//cpq fmt [--indent=N] [--list] FILE.ou...: rewrites every file in the canonical layout of
+//cplfmt, leaving the files with errors or comments as they are
+func formatFiles(args []string) {
+	flags := flag.NewFlagSet("fmt", flag.ExitOnError)
+	indent := flags.Int("indent", 4, "spaces of one level of indentation, 0 to indent with tabs")
+	list := flags.Bool("list", false, "only print the names of the files whose layout differs, without rewriting them")
+	flags.BoolVar(noColor, "no-color", false, "print errors without ANSI colors")
+	flags.IntVar(tabWidth, "tab-width", 0, "columns of a tab in errors, 0 to count a tab as one column")
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: cpq fmt [--indent=N] [--list] FILE.ou...")
+		return
+	}
+	config := cplfmt.Config{Indent: "\t"}
+	if *indent > 0 {
+		config.Indent = strings.Repeat(" ", *indent)
+	}
+	for _, file := range flags.Args() {
+		formatFile(file, config, *list)
+	}
+}
+
+//formats one file
+func formatFile(file string, config cplfmt.Config, list bool) {
+	if path.Ext(file) != ".ou" {
+		fmt.Fprintf(os.Stderr, "%s: input file extension must be .ou\n", file)
+		return
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot open %s.\n", file)
+		return
+	}
+	code, err := cpq.Decode(data, *encoding)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot decode %s: %s\n", file, err)
+		return
+	}
+	program, parseErrors := cpq.Parse(code)
+	if len(parseErrors) > 0 {
+		report := newReporter(file, code)
+		for _, err := range cpq.SortErrors(parseErrors) {
+			report.report("ParseError", err)
+		}
+		return
+	}
+	if cplfmt.HasComments(code) {
+		fmt.Fprintf(os.Stderr, "%s: not formatted, it has comments, which formatting would remove\n", file)
+		return
+	}
+	formatted := cplfmt.Format(program, config)
+	if formatted == string(data) {
+		return
+	}
+	if list {
+		fmt.Println(file)
+		return
+	}
+	if err := ioutil.WriteFile(file, []byte(formatted), 0644); err != nil {
+		fmt.Fprintf(os.Stderr, "Cannot write %s: %s\n", file, err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+)
+
+//starts the profilers requested on the command line.
+//The returned function stops them and writes the heap profile.
+func startProfiling() (func() error, error) {
+	var cpuFile, traceOut *os.File
+	stop := func() error {
+		var result error
+		if cpuFile != nil {
+			pprof.StopCPUProfile()
+			result = cpuFile.Close()
+		}
+		if traceOut != nil {
+			trace.Stop()
+			if err := traceOut.Close(); result == nil {
+				result = err
+			}
+		}
+		if *memprofile != "" {
+			if err := writeHeapProfile(*memprofile); result == nil {
+				result = err
+			}
+		}
+		return result
+	}
+
+	if *cpuprofile != "" {
+		f, err := os.Create(*cpuprofile)
+		if err != nil {
+			return nil, err
+		}
+		if err := pprof.StartCPUProfile(f); err != nil {
+			f.Close()
+			return nil, err
+		}
+		cpuFile = f
+	}
+	if *traceFile != "" {
+		f, err := os.Create(*traceFile)
+		if err == nil {
+			if err = trace.Start(f); err != nil {
+				f.Close()
+			}
+		}
+		if err != nil {
+			if cpuFile != nil {
+				pprof.StopCPUProfile()
+				cpuFile.Close()
+			}
+			return nil, err
+		}
+		traceOut = f
+	}
+	return stop, nil
+}
+
+func writeHeapProfile(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	runtime.GC()
+	if err := pprof.WriteHeapProfile(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/nof-sh/CPL-to-QUAD-compiler/cpq"
+)
+
+//ANSI escapes of the parts of a diagnostic
+const (
+	colorReset  = "\x1b[0m"
+	colorBold   = "\x1b[1m"
+	colorRed    = "\x1b[1;31m"
+	colorYellow = "\x1b[1;33m"
+	colorBlue   = "\x1b[1;34m"
+)
+
+//prints errors and warnings with the line of the source they point at
+type reporter struct {
+	out      io.Writer
+	file     string
+	lines    *cpq.LineIndex
+	color    bool
+	tabWidth int // columns of a tab, 0 to count a tab as one column and print it as it is
+}
+
+//returns a reporter on stderr for the source src of file
+func newReporter(file, src string) *reporter {
+	return &reporter{out: os.Stderr, file: file, lines: cpq.NewLineIndex(src), color: useColor(), tabWidth: *tabWidth}
+}
+
+//reports whether diagnostics are colored: not with --no-color or NO_COLOR, nor when
+//stderr is redirected to a file or a pipe
+func useColor() bool {
+	if *noColor || os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	info, err := os.Stderr.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+//returns text in color, or as it is without colors
+func (r *reporter) paint(color, text string) string {
+	if !r.color {
+		return text
+	}
+	return color + text + colorReset
+}
+
+//prints a diagnostic of a kind, ParseError, CodegenError or Warning, followed by its
+//place and the source line with the offending text underlined:
+//
+//	CodegenError: [CPQ0001] undefined variable conut; did you mean count?
+//	 --> a.ou:6:3
+//	  |
+//	6 |   conut = 3;
+//	  |   ^^^^^
+func (r *reporter) report(kind string, e cpq.ErrorType) {
+	color := colorRed
+	if kind == "Warning" {
+		color = colorYellow
+	}
+	fmt.Fprintf(r.out, "%s %s\n", r.paint(color, kind+":"), r.paint(colorBold, describe(e)))
+	//the limits of the input have no place in the source
+	if e.Pos == (cpq.Position{}) && strings.HasPrefix(e.Code, "CPQ02") {
+		return
+	}
+	line := r.lines.Line(e.Pos.Line)
+	if r.tabWidth > 0 {
+		//the columns on screen of the line with its tabs expanded
+		if e.End.Line == e.Pos.Line {
+			e.End.Column = r.lines.VisualColumn(e.End, r.tabWidth)
+		}
+		e.Pos.Column = r.lines.VisualColumn(e.Pos, r.tabWidth)
+		line = cpq.ExpandTabs(line, r.tabWidth)
+	}
+	number := fmt.Sprint(e.Pos.Line + 1)
+	gutter := strings.Repeat(" ", len(number))
+	fmt.Fprintf(r.out, "%s %s:%d:%d\n", r.paint(colorBlue, gutter+"-->"), r.file, e.Pos.Line+1, e.Pos.Column+1)
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	fmt.Fprintln(r.out, r.paint(colorBlue, gutter+" |"))
+	fmt.Fprintf(r.out, "%s %s\n", r.paint(colorBlue, number+" |"), line)
+	fmt.Fprintf(r.out, "%s %s%s\n", r.paint(colorBlue, gutter+" |"), indent(line, e.Pos.Column), r.paint(color, underline(line, e)))
+}
+
+//returns the blanks before a column of a line, keeping its tabs so the underline lines up
+func indent(line string, column int) string {
+	var b strings.Builder
+	for _, ch := range line {
+		if column == 0 {
+			break
+		}
+		if ch == '\t' {
+			b.WriteRune('\t')
+		} else {
+			b.WriteRune(' ')
+		}
+		column--
+	}
+	return b.String()
+}
+
+//returns the marks under the text of an error: ^ under every character up to its End,
+//a single ^ when its End is unknown or on a later line
+func underline(line string, e cpq.ErrorType) string {
+	width := 1
+	if e.End.Line == e.Pos.Line && e.End.Column > e.Pos.Column {
+		width = e.End.Column - e.Pos.Column
+	}
+	if rest := len([]rune(line)) - e.Pos.Column; width > rest && rest > 0 {
+		width = rest
+	}
+	return strings.Repeat("^", width)
+}